@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/bazooka-ci/bazooka/client"
+	lib "github.com/bazooka-ci/bazooka/commons"
+	bzklog "github.com/bazooka-ci/bazooka/commons/logs"
+)
+
+const (
+	BazookaEnvApiUrl        = "BZK_API_URL"
+	BazookaEnvUsername      = "BZK_USERNAME"
+	BazookaEnvPassword      = "BZK_PASSWORD"
+	BazookaEnvAgentName     = "BZK_AGENT_NAME"
+	BazookaEnvDockerURL     = "BZK_AGENT_DOCKER_URL"
+	BazookaEnvAgentLabels   = "BZK_AGENT_LABELS"
+	BazookaEnvAgentCapacity = "BZK_AGENT_CAPACITY"
+)
+
+func init() {
+	log.SetFormatter(&bzklog.BzkFormatter{})
+}
+
+// The agent registers the Docker host it runs on with the bazooka server, and keeps its registration alive
+// until it is stopped. The orchestration builds and runs the variants on this host through its Docker API
+func main() {
+	agent, err := agentFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, err := client.New(&client.Config{
+		URL:      os.Getenv(BazookaEnvApiUrl),
+		Username: os.Getenv(BazookaEnvUsername),
+		Password: os.Getenv(BazookaEnvPassword),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := client.Agent.Register(agent); err != nil {
+		log.Fatalf("Failed to register the agent %s: %v", agent.Name, err)
+	}
+	log.WithFields(log.Fields{
+		"name":       agent.Name,
+		"docker_url": agent.DockerURL,
+		"labels":     agent.Labels,
+		"capacity":   agent.Capacity,
+	}).Info("Agent registered")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	heartbeat := time.NewTicker(lib.AgentHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-heartbeat.C:
+			// the server may have been restarted, or the agent removed, in the meantime: registering again covers both
+			if _, err := client.Agent.Register(agent); err != nil {
+				log.Errorf("Heartbeat of agent %s failed: %v\n", agent.Name, err)
+			}
+		case <-stop:
+			if err := client.Agent.Remove(agent.Name); err != nil {
+				log.Fatalf("Failed to unregister the agent %s: %v", agent.Name, err)
+			}
+			log.Info("Agent unregistered")
+			return
+		}
+	}
+}
+
+func agentFromEnv() (*lib.Agent, error) {
+	name := os.Getenv(BazookaEnvAgentName)
+	if len(name) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		name = hostname
+	}
+
+	dockerURL := os.Getenv(BazookaEnvDockerURL)
+	if len(dockerURL) == 0 {
+		return nil, fmt.Errorf("%s is required, it is the address of the Docker API of this host as reached from the bazooka server", BazookaEnvDockerURL)
+	}
+
+	capacity := 1
+	if v := os.Getenv(BazookaEnvAgentCapacity); len(v) > 0 {
+		var err error
+		capacity, err = strconv.Atoi(v)
+		if err != nil || capacity <= 0 {
+			return nil, fmt.Errorf("%s should be a positive number of variants, got %s", BazookaEnvAgentCapacity, v)
+		}
+	}
+
+	var labels []string
+	for _, label := range strings.Split(os.Getenv(BazookaEnvAgentLabels), ",") {
+		if label = strings.TrimSpace(label); len(label) > 0 {
+			labels = append(labels, label)
+		}
+	}
+
+	return &lib.Agent{
+		Name:      name,
+		DockerURL: dockerURL,
+		Labels:    labels,
+		Capacity:  capacity,
+	}, nil
+}
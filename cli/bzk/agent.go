@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jawher/mow.cli"
+)
+
+func listAgentsCommand(cmd *cli.Cmd) {
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		res, err := client.Agent.List()
+		if err != nil {
+			log.Fatal(err)
+		}
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+
+		fmt.Fprint(w, "NAME\tDOCKER URL\tLABELS\tCAPACITY\tRUNNING\tLAST SEEN\tSTATUS\n")
+		for _, item := range res {
+			status := "UP"
+			if !item.Alive(now) {
+				status = "DOWN"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n", item.Name, item.DockerURL, strings.Join(item.Labels, ","), item.Capacity, len(item.Leases), fmtTime(item.LastSeen), status)
+		}
+		w.Flush()
+	}
+}
+
+func removeAgentCommand(cmd *cli.Cmd) {
+	name := cmd.String(cli.StringArg{
+		Name: "NAME",
+		Desc: "the agent name",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := client.Agent.Remove(*name); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
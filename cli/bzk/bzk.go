@@ -20,22 +20,31 @@ func main() {
 		cmd.Command("list", "List bazooka projects", listProjectsCommand)
 		cmd.Command("create", "Create a new bazooka project", createProjectCommand)
 		cmd.Command("show", "Display specific information about a bazooka project", showProjectCommand)
+		cmd.Command("delete", "Delete a bazooka project with its jobs, logs, keys, files and images", deleteProjectCommand)
 		cmd.Command("config", "View or modify a bazooka project configuration", func(cfgCmd *cli.Cmd) {
 			cfgCmd.Command("list", "List full project configuration", listProjectConfigCommand)
 			cfgCmd.Command("get", "Get a specific project configuration key", getProjectConfigKeyCommand)
 			cfgCmd.Command("set", "Set a specific project configuration key", setProjectConfigKeyCommand)
 			cfgCmd.Command("unset", "Delete a specific project configuration key", unsetProjectConfigKeyCommand)
 		})
+		cmd.Command("cache", "Manage the cached directories of a bazooka project", func(cacheCmd *cli.Cmd) {
+			cacheCmd.Command("clear", "Clear the cached directories of a project, forcing the next builds to start afresh", clearProjectCacheCommand)
+		})
 	})
 
 	app.Command("job", "Actions on jobs", func(cmd *cli.Cmd) {
 		cmd.Command("list", "List jobs associated with a project", listJobsCommand)
 		cmd.Command("start", "Start a new bazooka job on a project", startJobCommand)
+		cmd.Command("show", "Display a job with the reason why it did not succeed", showJobCommand)
 		cmd.Command("log", "View a job log", jobLogCommand)
+		cmd.Command("stages", "View the status of the stages of a job pipeline", jobStagesCommand)
+		cmd.Command("pin", "Keep a job build folder and images from being garbage collected", pinJobCommand)
+		cmd.Command("unpin", "Let a job be garbage collected again", unpinJobCommand)
 	})
 
 	app.Command("variant", "Actions on job variants", func(cmd *cli.Cmd) {
 		cmd.Command("list", "List variants associated with a job", listVariantsCommand)
+		cmd.Command("show", "Display a variant with the duration of its phases and commands", showVariantCommand)
 		cmd.Command("log", "View a variant log", variantLogCommand)
 	})
 
@@ -50,6 +59,17 @@ func main() {
 		cmd.Command("register", "Register a docker image", setImageCommand)
 	})
 
+	app.Command("registry", "Actions on the credentials of private docker registries", func(cmd *cli.Cmd) {
+		cmd.Command("list", "List the registry credentials, global or of a project", listRegistriesCommand)
+		cmd.Command("set", "Set the credential pulling the images of a registry", setRegistryCommand)
+		cmd.Command("remove", "Remove the credential of a registry", removeRegistryCommand)
+	})
+
+	app.Command("agent", "Actions on build agents", func(cmd *cli.Cmd) {
+		cmd.Command("list", "List the build agents, with the labels they are selected by", listAgentsCommand)
+		cmd.Command("remove", "Unregister a build agent, no longer dispatching variants to it", removeAgentCommand)
+	})
+
 	app.Command("user", "Actions on users", func(cmd *cli.Cmd) {
 		cmd.Command("list", "List bazooka users", listUsersCommand)
 		cmd.Command("create", "Create a new bazooka user", createUserCommand)
@@ -57,12 +77,20 @@ func main() {
 
 	app.Command("encrypt", "Encrypt some data", encryptData)
 
+	app.Command("run", "Build the working directory locally, without a bazooka server", runCommand)
+
+	app.Command("lint", "Check a bazooka configuration file", lintCommand)
+
 	app.Command("service", "Manage bazooka service (start, stop, status, upgrade...)", func(cmd *cli.Cmd) {
 		cmd.Command("start", "Start bazooka", startService)
 		cmd.Command("restart", "Restart bazooka", restartService)
 		cmd.Command("upgrade", "Upgrade bazooka to the latest version", upgradeService)
 		cmd.Command("stop", "Stop bazooka", stopService)
 		cmd.Command("status", "Get bazooka status", statusService)
+		cmd.Command("archive-logs", "Archive the logs of all the finished jobs", archiveLogsCommand)
+		cmd.Command("backup", "Save the projects, keys, users and images of bazooka to an archive", backupCommand)
+		cmd.Command("restore", "Merge a backup archive into bazooka", restoreCommand)
+		cmd.Command("gc", "Remove the build folders and images of the jobs not kept by the retention policies", gcCommand)
 	})
 
 	app.Command("login", "Log in to the bazooka server", login)
@@ -30,6 +30,13 @@ type Config struct {
 	Tag        string `yaml:"tag"`
 
 	MongoURL   string `yaml:"mongo_url"`
+	Store      string `yaml:"store,omitempty"`
+	AgentCerts string `yaml:"agent_tls_certs,omitempty"`
+}
+
+// needsMongoContainer tells if the bazooka service has to start its own MongoDB container
+func (c *Config) needsMongoContainer() bool {
+	return (len(c.Store) == 0 || c.Store == "mongo") && len(c.MongoURL) == 0
 }
 
 func saveConfig(authConfig *Config) error {
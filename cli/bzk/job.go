@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
 	"text/tabwriter"
 	"time"
 
@@ -27,6 +29,17 @@ func jobStatus(j lib.JobStatus) string {
 	}
 }
 
+// failureCategory returns the category of the failure of a job or a variant, followed by the step it happened at if it differs
+func failureCategory(f *lib.Failure) string {
+	if f == nil {
+		return "-"
+	}
+	if len(f.Step) > 0 {
+		return fmt.Sprintf("%s (%s)", f.Category, f.Step)
+	}
+	return string(f.Category)
+}
+
 func fmtTime(t time.Time) string {
 	if t.IsZero() {
 		return "-"
@@ -97,37 +110,89 @@ func startJobCommand(cmd *cli.Cmd) {
 }
 
 func listJobsCommand(cmd *cli.Cmd) {
-	cmd.Spec = "[PROJECT_ID]"
+	cmd.Spec = "[OPTIONS] [PROJECT_ID]"
 
 	pid := cmd.String(cli.StringArg{
 		Name: "PROJECT_ID",
 		Desc: "the project id",
 	})
+	status := cmd.String(cli.StringOpt{
+		Name: "status",
+		Desc: "only list the jobs with this status (RUNNING, SUCCESS, FAILED or ERRORED)",
+	})
+	branch := cmd.String(cli.StringOpt{
+		Name: "branch b",
+		Desc: "only list the jobs started on this scm reference",
+	})
+	author := cmd.String(cli.StringOpt{
+		Name: "author",
+		Desc: "only list the jobs whose commit author name or email contains this text",
+	})
+	from := cmd.String(cli.StringOpt{
+		Name: "from",
+		Desc: "only list the jobs started at or after this date (2006-01-02 or RFC3339)",
+	})
+	to := cmd.String(cli.StringOpt{
+		Name: "to",
+		Desc: "only list the jobs started before this date (2006-01-02 or RFC3339)",
+	})
+	limit := cmd.Int(cli.IntOpt{
+		Name: "limit n",
+		Desc: "list at most this many jobs",
+	})
+	offset := cmd.Int(cli.IntOpt{
+		Name: "offset",
+		Desc: "skip this many jobs",
+	})
+	asc := cmd.Bool(cli.BoolOpt{
+		Name: "asc",
+		Desc: "list the oldest jobs first",
+	})
 
 	cmd.Action = func() {
+		// the options are validated the same way the server validates the request parameters
+		values := url.Values{
+			"status":    {*status},
+			"reference": {*branch},
+			"author":    {*author},
+			"from":      {*from},
+			"to":        {*to},
+			"limit":     {strconv.Itoa(*limit)},
+			"offset":    {strconv.Itoa(*offset)},
+		}
+		if *asc {
+			values.Set("sort", "asc")
+		}
+		query, err := lib.ParseJobQuery(values)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		client, err := NewClient()
 		if err != nil {
 			log.Fatal(err)
 		}
 		var res []lib.Job
+		var total int
 		if len(*pid) > 0 {
-			res, err = client.Project.Jobs(*pid)
+			res, total, err = client.Project.Jobs(*pid, query)
 		} else {
-			res, err = client.Job.List()
+			res, total, err = client.Job.List(query)
 		}
 
 		if err != nil {
 			log.Fatal(err)
 		}
 		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
-		fmt.Fprint(w, "#\tJOB ID\tSTARTED\tCOMPLETED\tSTATUS\tPROJECT ID\tORCHESTRATION ID\tREFERENCE\tCOMMIT ID\tAUTHOR\tDATE\tMESSAGE\n")
+		fmt.Fprint(w, "#\tJOB ID\tSTARTED\tCOMPLETED\tSTATUS\tFAILURE\tPROJECT ID\tORCHESTRATION ID\tREFERENCE\tCOMMIT ID\tAUTHOR\tDATE\tMESSAGE\n")
 		for _, item := range res {
-			fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%v\t%v\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%v\t%s\t%v\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
 				item.Number,
 				idExcerpt(item.ID),
 				fmtTime(item.Started),
 				fmtTime(item.Completed),
 				jobStatus(item.Status),
+				failureCategory(item.Failure),
 				idExcerpt(item.ProjectID),
 				idExcerpt(item.OrchestrationID),
 				item.SCMMetadata.Reference,
@@ -137,6 +202,121 @@ func listJobsCommand(cmd *cli.Cmd) {
 				item.SCMMetadata.Message)
 		}
 		w.Flush()
+		if len(res) < total {
+			fmt.Printf("\nShowing %d of %d jobs\n", len(res), total)
+		}
+	}
+}
+
+func pinJobCommand(cmd *cli.Cmd) {
+	cmd.Spec = "JOB_ID"
+
+	jid := cmd.String(cli.StringArg{
+		Name: "JOB_ID",
+		Desc: "the job id",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		job, err := client.Job.Pin(*jid)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Job %s pinned, its build folder and images will be kept\n", idExcerpt(job.ID))
+	}
+}
+
+func unpinJobCommand(cmd *cli.Cmd) {
+	cmd.Spec = "JOB_ID"
+
+	jid := cmd.String(cli.StringArg{
+		Name: "JOB_ID",
+		Desc: "the job id",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		job, err := client.Job.Unpin(*jid)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Job %s unpinned\n", idExcerpt(job.ID))
+	}
+}
+
+func showJobCommand(cmd *cli.Cmd) {
+	cmd.Spec = "JOB_ID"
+
+	jid := cmd.String(cli.StringArg{
+		Name: "JOB_ID",
+		Desc: "the job id",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		job, err := client.Job.Get(*jid)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+		fmt.Fprintf(w, "NUMBER\t%d\n", job.Number)
+		fmt.Fprintf(w, "ID\t%s\n", job.ID)
+		fmt.Fprintf(w, "PROJECT ID\t%s\n", job.ProjectID)
+		fmt.Fprintf(w, "REFERENCE\t%s\n", job.SCMMetadata.Reference)
+		fmt.Fprintf(w, "COMMIT ID\t%s\n", job.SCMMetadata.CommitID)
+		fmt.Fprintf(w, "STATUS\t%s\n", jobStatus(job.Status))
+		if job.Failure != nil {
+			fmt.Fprintf(w, "FAILURE\t%s\n", failureCategory(job.Failure))
+			fmt.Fprintf(w, "REASON\t%s\n", job.Failure.Reason)
+		}
+		fmt.Fprintf(w, "STARTED\t%s\n", fmtTime(job.Started))
+		fmt.Fprintf(w, "COMPLETED\t%s\n", fmtTime(job.Completed))
+		w.Flush()
+	}
+}
+
+func jobStagesCommand(cmd *cli.Cmd) {
+	cmd.Spec = "JOB_ID"
+
+	jid := cmd.String(cli.StringArg{
+		Name: "JOB_ID",
+		Desc: "the job id",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		job, err := client.Job.Get(*jid)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(job.Stages) == 0 {
+			fmt.Printf("Job %s has no stages\n", idExcerpt(job.ID))
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+		fmt.Fprint(w, "STAGE\tSTARTED\tCOMPLETED\tSTATUS\n")
+		for _, stage := range job.Stages {
+			status := "SKIPPED"
+			if len(stage.Status) > 0 {
+				status = jobStatus(stage.Status)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", stage.Name, fmtTime(stage.Started), fmtTime(stage.Completed), status)
+		}
+		w.Flush()
 	}
 }
 
@@ -182,6 +362,16 @@ func printLog(l lib.LogEntry) {
 		fmt.Printf("[Executing Command] %s\n", l.Command)
 	case len(l.Phase) > 0:
 		fmt.Printf("[Starting Phase] %s\n", l.Phase)
+	case l.CommandEnd:
+		fmt.Printf("[Command Finished] exit code %d\n", l.ExitCode)
+	case l.PhaseEnd:
+		fmt.Printf("[Phase Finished] exit code %d\n", l.ExitCode)
+	case len(l.MetaName) > 0:
+		fmt.Printf("[Metadata] %s=%s\n", l.MetaName, l.MetaValue)
+	case len(l.Artifact) > 0:
+		fmt.Printf("[Artifact] %s\n", l.Artifact)
+	case len(l.Summary) > 0:
+		fmt.Printf("[Summary] %s\n", l.Summary)
 	case len(l.Level) > 0:
 		fmt.Printf("[%s] %s\n", l.Level, l.Message)
 	default:
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jawher/mow.cli"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+)
+
+func lintCommand(cmd *cli.Cmd) {
+	cmd.Spec = "[FILE]"
+
+	file := cmd.String(cli.StringArg{
+		Name: "FILE",
+		Desc: "the configuration file to check, the .bazooka.yml or .travis.yml of the working directory by default",
+	})
+
+	cmd.Action = func() {
+		if len(*file) == 0 {
+			source, err := os.Getwd()
+			if err != nil {
+				log.Fatal(err)
+			}
+			*file, err = lib.ResolveConfigFile(source)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		configErrors, err := lib.LintFile(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(configErrors) == 0 {
+			fmt.Printf("%s is valid\n", *file)
+			return
+		}
+		for _, configError := range configErrors {
+			fmt.Printf("%s: %v\n", *file, configError)
+		}
+		os.Exit(1)
+	}
+}
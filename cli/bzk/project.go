@@ -99,6 +99,58 @@ func showProjectCommand(cmd *cli.Cmd) {
 	}
 }
 
+func deleteProjectCommand(cmd *cli.Cmd) {
+	cmd.Spec = "[--force] PROJECT_ID"
+
+	projectID := cmd.String(cli.StringArg{
+		Name: "PROJECT_ID",
+		Desc: "the project id or name",
+	})
+	force := cmd.Bool(cli.BoolOpt{
+		Name: "f force",
+		Desc: "Delete the project even if some of its jobs are running, stopping them",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := client.Project.Delete(*projectID, *force); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Project %s deleted\n", *projectID)
+	}
+}
+
+func clearProjectCacheCommand(cmd *cli.Cmd) {
+	cmd.Spec = "[--branch] PROJECT_ID"
+
+	projectID := cmd.String(cli.StringArg{
+		Name: "PROJECT_ID",
+		Desc: "the project id or name",
+	})
+	branch := cmd.String(cli.StringOpt{
+		Name: "b branch",
+		Desc: "Only clear the cache of this branch",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := client.Project.ClearCache(*projectID, *branch); err != nil {
+			log.Fatal(err)
+		}
+		if len(*branch) > 0 {
+			fmt.Printf("Cache of branch %s of project %s cleared\n", *branch, *projectID)
+		} else {
+			fmt.Printf("Cache of project %s cleared\n", *projectID)
+		}
+	}
+}
+
 func listProjectConfigCommand(cmd *cli.Cmd) {
 	cmd.Spec = "PROJECT_ID"
 
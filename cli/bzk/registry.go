@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/howeyc/gopass"
+	"github.com/jawher/mow.cli"
+)
+
+func projectOpt(cmd *cli.Cmd) *string {
+	return cmd.String(cli.StringOpt{
+		Name: "project",
+		Desc: "the project id, the credentials being global when empty",
+	})
+}
+
+func listRegistriesCommand(cmd *cli.Cmd) {
+	pid := projectOpt(cmd)
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		res, err := client.Registry.List(*pid)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+		fmt.Fprint(w, "REGISTRY\tUSERNAME\tEMAIL\n")
+		for _, item := range res {
+			fmt.Fprintf(w, "%s\t%s\t%s\t\n", item.Registry, item.Username, item.Email)
+		}
+		w.Flush()
+	}
+}
+
+func setRegistryCommand(cmd *cli.Cmd) {
+	cmd.Spec = "[--project] REGISTRY USERNAME [--email] [--password]"
+
+	pid := projectOpt(cmd)
+	registry := cmd.String(cli.StringArg{
+		Name: "REGISTRY",
+		Desc: "the registry host, docker.io for the Docker Hub",
+	})
+	username := cmd.String(cli.StringArg{
+		Name: "USERNAME",
+		Desc: "the registry username",
+	})
+	email := cmd.String(cli.StringOpt{
+		Name: "e email",
+		Desc: "the registry user email",
+	})
+	password := cmd.String(cli.StringOpt{
+		Name:   "p password",
+		Desc:   "the registry password",
+		EnvVar: "BZK_REGISTRY_PASSWORD",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(*password) == 0 {
+			fmt.Printf("Enter registry password: ")
+			*password = string(gopass.GetPasswd())
+		}
+
+		res, err := client.Registry.Set(*pid, &lib.RegistryCredential{
+			Registry: *registry,
+			Username: *username,
+			Password: *password,
+			Email:    *email,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+		fmt.Fprint(w, "REGISTRY\tUSERNAME\tEMAIL\n")
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", res.Registry, res.Username, res.Email)
+		w.Flush()
+	}
+}
+
+func removeRegistryCommand(cmd *cli.Cmd) {
+	cmd.Spec = "[--project] REGISTRY"
+
+	pid := projectOpt(cmd)
+	registry := cmd.String(cli.StringArg{
+		Name: "REGISTRY",
+		Desc: "the registry host",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := client.Registry.Remove(*pid, *registry); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jawher/mow.cli"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+func runCommand(cmd *cli.Cmd) {
+	cmd.Spec = "[--variant] [--env...] [--keep] [--crypto-key] [--docker-sock]"
+
+	variant := cmd.Int(cli.IntOpt{
+		Name:  "variant",
+		Desc:  "the number of the only variant to run, all of them by default",
+		Value: -1,
+	})
+	envParameters := cmd.Strings(cli.StringsOpt{
+		Name: "e env",
+		Desc: "define an environment variable for the build",
+	})
+	keep := cmd.Bool(cli.BoolOpt{
+		Name: "keep",
+		Desc: "keep the build folder, with the generated Dockerfiles and the artifacts",
+	})
+	cryptoKey := cmd.String(cli.StringOpt{
+		Name: "crypto-key",
+		Desc: "file holding the crypto key of the project, needed to decrypt the secured values of the configuration",
+	})
+	dockerSock := cmd.String(cli.StringOpt{
+		Name:   "docker-sock",
+		Desc:   "Location of the Docker unix socket",
+		Value:  "/var/run/docker.sock",
+		EnvVar: "BZK_DOCKERSOCK",
+	})
+
+	cmd.Action = func() {
+		source, err := os.Getwd()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := lib.ResolveConfigFile(source); err != nil {
+			log.Fatal(err)
+		}
+
+		// the build folder has the same layout as the server ones, and must be visible to the docker daemon
+		home, err := ioutil.TempDir("", "bazooka-run-")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *keep {
+			fmt.Printf("Build folder: %s\n", home)
+		} else {
+			defer os.RemoveAll(home)
+		}
+
+		var parameters []lib.BzkString
+		for _, v := range *envParameters {
+			name, value := lib.SplitNameValue(v)
+			parameters = append(parameters, lib.BzkString{Name: name, Value: value})
+		}
+		jobParameters, err := json.Marshal(parameters)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		jobID := strconv.FormatInt(time.Now().Unix(), 10)
+		env := map[string]string{
+			"BZK_LOCAL":          "1",
+			"BZK_HOME":           home,
+			"BZK_SRC":            source,
+			"BZK_DOCKERSOCK":     *dockerSock,
+			"BZK_PROJECT_ID":     "local",
+			"BZK_JOB_ID":         jobID,
+			"BZK_JOB_PARAMETERS": string(jobParameters),
+		}
+		// without the key of the project, the configurations with secured values fail to parse
+		if len(*cryptoKey) > 0 {
+			keyFile, err := filepath.Abs(*cryptoKey)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, err := os.Stat(keyFile); err != nil {
+				log.Fatal(err)
+			}
+			env["BZK_CRYPTO_KEYFILE"] = keyFile
+		}
+		if *variant >= 0 {
+			env["BZK_RUN_VARIANT"] = strconv.Itoa(*variant)
+		}
+
+		exitCode, err := runOrchestration(*dockerSock, jobID, env, []string{
+			fmt.Sprintf("%s:/bazooka", home),
+			fmt.Sprintf("%s:/bazooka/source", source),
+			fmt.Sprintf("%s:/var/run/docker.sock", *dockerSock),
+		})
+		if err == errInterrupted {
+			if !*keep {
+				os.RemoveAll(home)
+			}
+			os.Exit(130)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if exitCode != 0 {
+			if !*keep {
+				os.RemoveAll(home)
+			}
+			os.Exit(exitCode)
+		}
+	}
+}
+
+var errInterrupted = errors.New("The build was interrupted")
+
+// runOrchestration runs the orchestration of a local build, streaming its output, and returns its exit code.
+// On SIGINT or SIGTERM, it removes the containers and networks of the build and returns errInterrupted
+func runOrchestration(dockerSock, jobID string, env map[string]string, binds []string) (int, error) {
+	client, err := dockerclient.NewClient("unix://" + dockerSock)
+	if err != nil {
+		return 0, err
+	}
+
+	envList := make([]string, 0, len(env))
+	for k, v := range env {
+		envList = append(envList, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	container, err := client.CreateContainer(dockerclient.CreateContainerOptions{
+		Config: &dockerclient.Config{
+			Image: lib.DefaultImages["orchestration"],
+			Env:   envList,
+		},
+		HostConfig: &dockerclient.HostConfig{
+			Binds: binds,
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create the orchestration container: %v", err)
+	}
+	defer client.RemoveContainer(dockerclient.RemoveContainerOptions{
+		ID:            container.ID,
+		Force:         true,
+		RemoveVolumes: true,
+	})
+
+	// the orchestration container is removed first, so that it starts no more containers,
+	// which also ends the logs and the wait below
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	finished := make(chan struct{})
+	defer close(finished)
+	var interrupted int32
+	removed := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			atomic.StoreInt32(&interrupted, 1)
+			fmt.Fprintf(os.Stderr, "Received %v, removing the containers of the build\n", sig)
+			removeLocalBuild(client, container.ID, jobID)
+			close(removed)
+		case <-finished:
+		}
+	}()
+	stopped := func() bool {
+		if atomic.LoadInt32(&interrupted) == 0 {
+			return false
+		}
+		<-removed
+		return true
+	}
+
+	if err := client.StartContainer(container.ID, nil); err != nil {
+		if stopped() {
+			return 0, errInterrupted
+		}
+		return 0, fmt.Errorf("Failed to start the orchestration container: %v", err)
+	}
+
+	if err := client.Logs(dockerclient.LogsOptions{
+		Container:    container.ID,
+		Follow:       true,
+		Stdout:       true,
+		Stderr:       true,
+		OutputStream: os.Stdout,
+		ErrorStream:  os.Stderr,
+	}); err != nil {
+		if stopped() {
+			return 0, errInterrupted
+		}
+		return 0, err
+	}
+
+	exitCode, err := client.WaitContainer(container.ID)
+	if stopped() {
+		return 0, errInterrupted
+	}
+	return exitCode, err
+}
+
+// removeLocalBuild removes the orchestration container of a local build,
+// then the variant and service containers of the job and the networks of its variants
+func removeLocalBuild(client *dockerclient.Client, orchestration, jobID string) {
+	remove := func(id string) error {
+		return client.RemoveContainer(dockerclient.RemoveContainerOptions{
+			ID:            id,
+			Force:         true,
+			RemoveVolumes: true,
+		})
+	}
+	if err := remove(orchestration); err != nil {
+		log.Printf("Error while removing the orchestration container: %v", err)
+	}
+
+	containers, err := client.ListContainers(dockerclient.ListContainersOptions{All: true})
+	if err != nil {
+		log.Printf("Error while listing the containers of the build: %v", err)
+	}
+	prefixes := []string{
+		fmt.Sprintf("/bazooka-variant-local-%s-", jobID),
+		fmt.Sprintf("/bazooka-service-local-%s-", jobID),
+	}
+	for _, container := range containers {
+		for _, name := range container.Names {
+			if !hasAnyPrefix(name, prefixes) {
+				continue
+			}
+			if err := remove(container.ID); err != nil {
+				log.Printf("Error while removing the container %s: %v", name, err)
+			}
+			break
+		}
+	}
+
+	networks, err := client.ListNetworks()
+	if err != nil {
+		log.Printf("Error while listing the networks of the build: %v", err)
+	}
+	for _, network := range networks {
+		if !strings.HasPrefix(network.Name, fmt.Sprintf("bazooka-local-%s-", jobID)) {
+			continue
+		}
+		if err := client.RemoveNetwork(network.ID); err != nil {
+			log.Printf("Error while removing the network %s: %v", network.Name, err)
+		}
+	}
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
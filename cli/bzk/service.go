@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"os/user"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/jawher/mow.cli"
 
@@ -42,6 +46,11 @@ func startService(cmd *cli.Cmd) {
 		Desc:   "URL of a MongoDB server",
 		EnvVar: "BZK_MONGO_URL",
 	})
+	store := cmd.String(cli.StringOpt{
+		Name:   "store",
+		Desc:   "Where bazooka stores its data: mongo, or bolt to use a single file in the bazooka home without a MongoDB container",
+		EnvVar: "BZK_STORE",
+	})
 	registry := cmd.String(cli.StringOpt{
 		Name:   "registry",
 		EnvVar: "BZK_REGISTRY",
@@ -51,18 +60,23 @@ func startService(cmd *cli.Cmd) {
 		Desc:   "Location of the Docker unix socket, usually /var/run/docker.sock",
 		EnvVar: "BZK_DOCKERSOCK",
 	})
+	agentCerts := cmd.String(cli.StringOpt{
+		Name:   "agent-tls-certs",
+		Desc:   "Folder of the client certificate (cert.pem, key.pem) and of the CA (ca.pem) the Docker API of the build agents is reached with over TLS",
+		EnvVar: "BZK_AGENT_TLS_CERTS",
+	})
 	tag := cmd.String(cli.StringOpt{
 		Name: "tag",
 		Desc: "The bazooka version to run",
 	})
 
-	cmd.Action = doStartService(tag, bzkHome, dockerSock, registry, scmKey, syslogURL, mongoURL)
+	cmd.Action = doStartService(tag, bzkHome, dockerSock, registry, scmKey, syslogURL, mongoURL, store, agentCerts)
 }
 
-func doStartService(version, bzkHome, dockerSock, registry, scmKey, syslogURL, mongoURL *string) func() {
+func doStartService(version, bzkHome, dockerSock, registry, scmKey, syslogURL, mongoURL, store, agentCerts *string) func() {
 	return func() {
 
-		config, err := getConfigWithParams(*version, *bzkHome, *dockerSock, *registry, *scmKey, *syslogURL, *mongoURL)
+		config, err := getConfigWithParams(*version, *bzkHome, *dockerSock, *registry, *scmKey, *syslogURL, *mongoURL, *store, *agentCerts)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -79,7 +93,7 @@ func doStartService(version, bzkHome, dockerSock, registry, scmKey, syslogURL, m
 			log.Fatal(err)
 		}
 
-		if config.MongoURL == "" {
+		if config.needsMongoContainer() {
 			err = startContainer(client, getMongoRunOptions(), allContainers)
 			if err != nil {
 				log.Fatal(err)
@@ -121,7 +135,7 @@ func doStopService() func() {
 			log.Fatal(err)
 		}
 
-		if config.MongoURL == "" {
+		if config.needsMongoContainer() {
 			err := stopContainer(client, bzkContainerMongo, allContainers)
 			if err != nil {
 				log.Fatal(err)
@@ -219,7 +233,7 @@ func doRestartService(recreate, recreateServer, recreateWeb, recreateDatabase *b
 				}
 			}
 		}
-		doStartService(&config.Tag, &config.Home, &config.DockerSock, &config.Registry, &config.SCMKey, &config.SyslogURL, &config.MongoURL)()
+		doStartService(&config.Tag, &config.Home, &config.DockerSock, &config.Registry, &config.SCMKey, &config.SyslogURL, &config.MongoURL, &config.Store, &config.AgentCerts)()
 	}
 }
 
@@ -243,7 +257,7 @@ func statusService(cmd *cli.Cmd) {
 		}
 
 		mongoUp := true
-		if config.MongoURL == "" {
+		if config.needsMongoContainer() {
 			mongoUp = getContainerStatus(bzkContainerMongo, allContainers)
 		}
 		serverUp := getContainerStatus(bzkContainerServer, allContainers)
@@ -324,7 +338,7 @@ func getContainerStatus(name string, allContainers []dockerclient.APIContainers)
 
 }
 
-func getConfigWithParams(tag, bzkHome, dockerSock, registry, scmKey, syslogURL, mongoURL string) (*Config, error) {
+func getConfigWithParams(tag, bzkHome, dockerSock, registry, scmKey, syslogURL, mongoURL, store, agentCerts string) (*Config, error) {
 	config, err := loadConfig()
 	if err != nil {
 		return nil, fmt.Errorf("Unable to load Bazooka config, reason is: %v\n", err)
@@ -368,6 +382,14 @@ func getConfigWithParams(tag, bzkHome, dockerSock, registry, scmKey, syslogURL,
 		config.MongoURL = mongoURL
 	}
 
+	if len(store) != 0 {
+		config.Store = store
+	}
+
+	if len(agentCerts) != 0 {
+		config.AgentCerts = agentCerts
+	}
+
 	if len(registry) != 0 {
 		config.Registry = registry
 	}
@@ -389,7 +411,7 @@ func getConfigWithParams(tag, bzkHome, dockerSock, registry, scmKey, syslogURL,
 }
 
 func getConfig() (*Config, error) {
-	return getConfigWithParams("", "", "", "", "", "", "")
+	return getConfigWithParams("", "", "", "", "", "", "", "", "")
 }
 
 func destroyContainer(client *docker.Docker, name string, allContainers []dockerclient.APIContainers) error {
@@ -464,7 +486,7 @@ func startContainer(client *docker.Docker, options *docker.RunOptions, allContai
 
 }
 
-func getServerEnv(home, dockerSock, scmKey, apiURL, syslogURL, mongoURL string) map[string]string {
+func getServerEnv(home, dockerSock, scmKey, apiURL, syslogURL, mongoURL, store, agentCerts string) map[string]string {
 	envMap := map[string]string{
 		"BZK_HOME":       home,
 		"BZK_DOCKERSOCK": dockerSock,
@@ -477,6 +499,12 @@ func getServerEnv(home, dockerSock, scmKey, apiURL, syslogURL, mongoURL string)
 	if len(mongoURL) > 0 {
 		envMap["BZK_MONGO_URL"] = mongoURL
 	}
+	if len(store) > 0 {
+		envMap["BZK_STORE"] = store
+	}
+	if len(agentCerts) > 0 {
+		envMap["BZK_AGENT_TLS_CERTS"] = agentCerts
+	}
 	return envMap
 }
 
@@ -521,20 +549,26 @@ func getMongoRunOptions() *docker.RunOptions {
 func getServerRunOptions(config *Config) *docker.RunOptions {
 	links := []string{}
 
-	if config.MongoURL == "" {
+	if config.needsMongoContainer() {
 		links = append(links, fmt.Sprintf("%s:mongo", bzkContainerMongo))
 	}
 
+	volumes := []string{
+		fmt.Sprintf("%s:/bazooka", config.Home),
+		fmt.Sprintf("%s:/var/run/docker.sock", config.DockerSock),
+	}
+	// the server reaches the build agents to remove the containers of the deleted projects
+	if len(config.AgentCerts) > 0 {
+		volumes = append(volumes, fmt.Sprintf("%s:/bazooka-agent-certs:ro", config.AgentCerts))
+	}
+
 	return &docker.RunOptions{
-		Name:   bzkContainerServer,
-		Image:  getImageLocation(config.Registry, "bazooka/server", config.Tag),
-		Detach: true,
-		VolumeBinds: []string{
-			fmt.Sprintf("%s:/bazooka", config.Home),
-			fmt.Sprintf("%s:/var/run/docker.sock", config.DockerSock),
-		},
-		Links: links,
-		Env:   getServerEnv(config.Home, config.DockerSock, config.SCMKey, config.ApiURL, config.SyslogURL, config.MongoURL),
+		Name:        bzkContainerServer,
+		Image:       getImageLocation(config.Registry, "bazooka/server", config.Tag),
+		Detach:      true,
+		VolumeBinds: volumes,
+		Links:       links,
+		Env:         getServerEnv(config.Home, config.DockerSock, config.SCMKey, config.ApiURL, config.SyslogURL, config.MongoURL, config.Store, config.AgentCerts),
 		PortBindings: map[dockerclient.Port][]dockerclient.PortBinding{
 			"3000/tcp": {{HostPort: "3000"}},
 			"3001/tcp": {{HostPort: "3001"}},
@@ -553,3 +587,160 @@ func getWebRunOptions(config *Config) *docker.RunOptions {
 		},
 	}
 }
+
+func archiveLogsCommand(cmd *cli.Cmd) {
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		report, err := client.Admin.ArchiveLogs()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Archived the logs of %d job(s)\n", len(report.Archived))
+		if len(report.Failed) > 0 {
+			w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+			fmt.Fprint(w, "JOB ID\tERROR\n")
+			for jobID, reason := range report.Failed {
+				fmt.Fprintf(w, "%s\t%s\n", idExcerpt(jobID), reason)
+			}
+			w.Flush()
+		}
+	}
+}
+
+func backupCommand(cmd *cli.Cmd) {
+	cmd.Spec = "[--jobs] [FILE]"
+
+	withJobs := cmd.Bool(cli.BoolOpt{
+		Name: "jobs",
+		Desc: "Include the job history (jobs and variants, not their logs)",
+	})
+	file := cmd.String(cli.StringArg{
+		Name: "FILE",
+		Desc: "the archive file, defaults to bazooka-<date>.json.gz",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(*file) == 0 {
+			*file = fmt.Sprintf("bazooka-%s.json.gz", time.Now().Format("20060102-150405"))
+		}
+
+		archive, err := client.Admin.Export(*withJobs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer archive.Close()
+
+		// only replace an existing file once the whole archive was received
+		tmp := *file + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, err = io.Copy(f, archive)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(tmp)
+			log.Fatal(err)
+		}
+		if err := os.Rename(tmp, *file); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Bazooka state saved to %s\n", *file)
+	}
+}
+
+func restoreCommand(cmd *cli.Cmd) {
+	cmd.Spec = "FILE"
+
+	file := cmd.String(cli.StringArg{
+		Name: "FILE",
+		Desc: "the archive file produced by bzk service backup",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		report, err := client.Admin.Import(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+		fmt.Fprint(w, "ENTRY\tSTATUS\n")
+		for _, entry := range report.Imported {
+			fmt.Fprintf(w, "%s\t%s\n", entry, "imported")
+		}
+		for entry, reason := range report.Skipped {
+			fmt.Fprintf(w, "%s\tskipped: %s\n", entry, reason)
+		}
+		w.Flush()
+	}
+}
+
+func gcCommand(cmd *cli.Cmd) {
+	cmd.Spec = "[--dry-run]"
+
+	dryRun := cmd.Bool(cli.BoolOpt{
+		Name: "n dry-run",
+		Desc: "Only report what would be removed",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		report, err := client.Admin.GC(*dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+		fmt.Fprint(w, "PROJECT ID\t#\tJOB ID\tFOLDER SIZE\tIMAGES\n")
+		for _, job := range report.Jobs {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\n", idExcerpt(job.ProjectID), job.Number, idExcerpt(job.JobID), fmtSize(job.Size), len(job.Images))
+		}
+		w.Flush()
+
+		if report.DryRun {
+			fmt.Printf("\n%d job(s) would be collected, freeing %s\n", len(report.Jobs), fmtSize(report.Freed))
+		} else {
+			fmt.Printf("\n%d job(s) collected, %s freed\n", len(report.Jobs), fmtSize(report.Freed))
+		}
+		for id, reason := range report.Failed {
+			fmt.Printf("Error while collecting %s: %s\n", idExcerpt(id), reason)
+		}
+	}
+}
+
+func fmtSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
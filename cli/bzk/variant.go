@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/jawher/mow.cli"
 )
@@ -27,14 +30,112 @@ func listVariantsCommand(cmd *cli.Cmd) {
 		}
 		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
 
-		fmt.Fprint(w, "NUMBER\tVARIANT ID\tIMAGE\tSTARTED\tCOMPLETED\tSTATUS\tJOB ID\n")
+		fmt.Fprint(w, "NUMBER\tVARIANT ID\tSTAGE\tIMAGE\tSTARTED\tCOMPLETED\tSTATUS\tFAILURE\tJOB ID\n")
 		for _, item := range res {
-			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%v\t%v\t%s\n", item.Number, idExcerpt(item.ID), item.BuildImage, fmtTime(item.Started), fmtTime(item.Completed), jobStatus(item.Status), idExcerpt(item.JobID))
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%v\t%v\t%s\t%s\n", item.Number, idExcerpt(item.ID), item.Stage, item.BuildImage, fmtTime(item.Started), fmtTime(item.Completed), jobStatus(item.Status), failureCategory(item.Failure), idExcerpt(item.JobID))
 		}
 		w.Flush()
 	}
 }
 
+func showVariantCommand(cmd *cli.Cmd) {
+	cmd.Spec = "VARIANT_ID"
+
+	vid := cmd.String(cli.StringArg{
+		Name: "VARIANT_ID",
+		Desc: "the variant id",
+	})
+
+	cmd.Action = func() {
+		client, err := NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		res, err := client.Variant.Get(*vid)
+		if err != nil {
+			log.Fatal(err)
+		}
+		steps, err := client.Variant.Steps(*vid)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Variant information:\n")
+		w := tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+		fmt.Fprintf(w, "NUMBER\t%d\n", res.Number)
+		fmt.Fprintf(w, "ID\t%s\n", res.ID)
+		fmt.Fprintf(w, "JOB ID\t%s\n", res.JobID)
+		if len(res.Stage) > 0 {
+			fmt.Fprintf(w, "STAGE\t%s\n", res.Stage)
+		}
+		fmt.Fprintf(w, "IMAGE\t%s\n", res.BuildImage)
+		fmt.Fprintf(w, "STATUS\t%s\n", jobStatus(res.Status))
+		if res.Failure != nil {
+			fmt.Fprintf(w, "FAILURE\t%s\n", failureCategory(res.Failure))
+			fmt.Fprintf(w, "REASON\t%s\n", res.Failure.Reason)
+		}
+		fmt.Fprintf(w, "STARTED\t%s\n", fmtTime(res.Started))
+		fmt.Fprintf(w, "COMPLETED\t%s\n", fmtTime(res.Completed))
+		w.Flush()
+
+		if len(res.Metadata) > 0 {
+			names := make([]string, 0, len(res.Metadata))
+			for name := range res.Metadata {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			fmt.Printf("\nMetadata:\n")
+			w = tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+			for _, name := range names {
+				fmt.Fprintf(w, "%s\t%s\n", name, res.Metadata[name])
+			}
+			w.Flush()
+		}
+
+		if len(res.Artifacts) > 0 {
+			fmt.Printf("\nArtifacts:\n")
+			for _, artifact := range res.Artifacts {
+				fmt.Printf("%s\n", artifact)
+			}
+		}
+
+		if len(res.Summary) > 0 {
+			fmt.Printf("\nSummary:\n%s\n", strings.Join(res.Summary, "\n"))
+		}
+
+		var total time.Duration
+		for _, phase := range steps {
+			total += phase.Duration
+		}
+
+		fmt.Printf("\nSteps:\n")
+		w = tabwriter.NewWriter(os.Stdout, 15, 1, 3, ' ', 0)
+		fmt.Fprint(w, "PHASE\tCOMMAND\tSTARTED\tDURATION\tSHARE\tEXIT CODE\n")
+		for _, phase := range steps {
+			fmt.Fprintf(w, "%s\t\t%s\t%v\t%s\t%s\n", phase.Phase, fmtTime(phase.Started), phase.Duration, fmtShare(phase.Duration, total), fmtExitCode(phase.ExitCode))
+			for _, command := range phase.Commands {
+				fmt.Fprintf(w, "\t%s\t%s\t%v\t%s\t%s\n", command.Command, fmtTime(command.Started), command.Duration, fmtShare(command.Duration, total), fmtExitCode(command.ExitCode))
+			}
+		}
+		w.Flush()
+	}
+}
+
+func fmtShare(d, total time.Duration) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d%%", int64(100*d/total))
+}
+
+func fmtExitCode(exitCode *int) string {
+	if exitCode == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d", *exitCode)
+}
+
 func variantLogCommand(cmd *cli.Cmd) {
 	cmd.Spec = "[--follow] VARIANT_ID"
 
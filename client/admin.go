@@ -0,0 +1,117 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/racker/perigee"
+)
+
+type Admin struct {
+	config *Config
+}
+
+func (c *Admin) ArchiveLogs() (*lib.LogArchiveReport, error) {
+	var report lib.LogArchiveReport
+
+	requestURL, err := c.config.getRequestURL("admin/logs/archive")
+	if err != nil {
+		return nil, err
+	}
+
+	err = perigee.Post(requestURL, perigee.Options{
+		Results:    &report,
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+
+	return &report, err
+}
+
+// GC removes the build folders and variant images of the jobs not kept by the retention policies.
+// With dryRun, nothing is removed and the report tells what would be
+func (c *Admin) GC(dryRun bool) (*lib.GCReport, error) {
+	var report lib.GCReport
+
+	var query []string
+	if dryRun {
+		query = append(query, "dry-run=true")
+	}
+	requestURL, err := c.config.getRequestURL("admin/gc", query...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = perigee.Post(requestURL, perigee.Options{
+		Results:    &report,
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+
+	return &report, err
+}
+
+// Export returns the export archive of the server, to be closed by the caller
+func (c *Admin) Export(withJobs bool) (io.ReadCloser, error) {
+	var query []string
+	if withJobs {
+		query = append(query, "jobs=true")
+	}
+	requestURL, err := c.config.getRequestURL("admin/export", query...)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := perigee.Request("GET", requestURL, perigee.Options{
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.HttpResponse.Body, nil
+}
+
+// Import merges an export archive into the server
+func (c *Admin) Import(archive io.Reader) (*lib.ImportReport, error) {
+	requestURL, err := c.config.getRequestURL("admin/import")
+	if err != nil {
+		return nil, err
+	}
+
+	// the archive is sent as is, not as a json payload
+	req, err := http.NewRequest("POST", requestURL, archive)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	if err := c.config.authenticateRequest(req); err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return nil, &perigee.UnexpectedResponseCodeError{
+			Url:      requestURL,
+			Expected: []int{200},
+			Actual:   res.StatusCode,
+			Body:     body,
+		}
+	}
+
+	var report lib.ImportReport
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
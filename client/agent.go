@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/racker/perigee"
+)
+
+type Agent struct {
+	config *Config
+}
+
+func (c *Agent) List() ([]*lib.Agent, error) {
+	var agents []*lib.Agent
+
+	requestURL, err := c.config.getRequestURL("agent")
+	if err != nil {
+		return nil, err
+	}
+
+	err = perigee.Get(requestURL, perigee.Options{
+		Results:    &agents,
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+
+	return agents, err
+}
+
+// Register registers a build agent under its name, or lets the server know it is still up if it registered already
+func (c *Agent) Register(agent *lib.Agent) (*lib.Agent, error) {
+	var registered lib.Agent
+
+	requestURL, err := c.config.getRequestURL(fmt.Sprintf("agent/%s", url.QueryEscape(agent.Name)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = perigee.Put(requestURL, perigee.Options{
+		ReqBody:    agent,
+		Results:    &registered,
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+
+	return &registered, err
+}
+
+func (c *Agent) Remove(name string) error {
+	requestURL, err := c.config.getRequestURL(fmt.Sprintf("agent/%s", url.QueryEscape(name)))
+	if err != nil {
+		return err
+	}
+
+	return perigee.Delete(requestURL, perigee.Options{
+		OkCodes:    []int{204},
+		SetHeaders: c.config.authenticateRequest,
+	})
+}
@@ -20,6 +20,10 @@ type Client struct {
 	Image    *Image
 	User     *User
 	Internal *Internal
+	Admin    *Admin
+	Lint     *Lint
+	Agent    *Agent
+	Registry *Registry
 }
 
 func New(config *Config) (*Client, error) {
@@ -34,6 +38,10 @@ func New(config *Config) (*Client, error) {
 		Image:    &Image{config},
 		User:     &User{config},
 		Internal: &Internal{config},
+		Admin:    &Admin{config},
+		Lint:     &Lint{config},
+		Agent:    &Agent{config},
+		Registry: &Registry{config},
 	}, nil
 }
 
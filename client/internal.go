@@ -27,7 +27,7 @@ func (in *Internal) GetProjectCryptoKey(projectID string) (*lib.CryptoKey, error
 	return &cryptoKey, err
 }
 
-func (in *Internal) MarkJobAsFinished(jobID string, status lib.JobStatus) error {
+func (in *Internal) MarkJobAsFinished(jobID string, status lib.JobStatus, failure *lib.Failure) error {
 	requestURL, err := in.config.getRequestURL(fmt.Sprintf("_/job/%s/finish", url.QueryEscape(jobID)))
 	if err != nil {
 		return err
@@ -35,14 +35,15 @@ func (in *Internal) MarkJobAsFinished(jobID string, status lib.JobStatus) error
 
 	return perigee.Post(requestURL, perigee.Options{
 		ReqBody: lib.FinishData{
-			Status: status,
+			Status:  status,
+			Failure: failure,
 		},
 		OkCodes:    []int{204},
 		SetHeaders: in.config.authenticateRequest,
 	})
 }
 
-func (in *Internal) MarkVariantAsFinished(variantID string, status lib.JobStatus, when time.Time, artifacts []string) error {
+func (in *Internal) MarkVariantAsFinished(variantID string, status lib.JobStatus, when time.Time, artifacts []string, failure *lib.Failure) error {
 	requestURL, err := in.config.getRequestURL(fmt.Sprintf("_/variant/%s/finish", url.QueryEscape(variantID)))
 	if err != nil {
 		return err
@@ -53,6 +54,7 @@ func (in *Internal) MarkVariantAsFinished(variantID string, status lib.JobStatus
 			Status:    status,
 			Time:      when,
 			Artifacts: artifacts,
+			Failure:   failure,
 		},
 		OkCodes:    []int{204},
 		SetHeaders: in.config.authenticateRequest,
@@ -72,6 +74,34 @@ func (in *Internal) AddJobSCMMetadata(jobID string, m *lib.SCMMetadata) error {
 	})
 }
 
+func (in *Internal) SetJobSecuredValues(jobID string, secured []string) error {
+	requestURL, err := in.config.getRequestURL(fmt.Sprintf("_/job/%s/secured", url.QueryEscape(jobID)))
+	if err != nil {
+		return err
+	}
+
+	return perigee.Put(requestURL, perigee.Options{
+		ReqBody: &lib.SecuredValues{
+			Values: secured,
+		},
+		OkCodes:    []int{204},
+		SetHeaders: in.config.authenticateRequest,
+	})
+}
+
+func (in *Internal) SetJobStages(jobID string, stages []*lib.JobStage) error {
+	requestURL, err := in.config.getRequestURL(fmt.Sprintf("_/job/%s/stages", url.QueryEscape(jobID)))
+	if err != nil {
+		return err
+	}
+
+	return perigee.Put(requestURL, perigee.Options{
+		ReqBody:    stages,
+		OkCodes:    []int{204},
+		SetHeaders: in.config.authenticateRequest,
+	})
+}
+
 func (in *Internal) AddVariant(variant *lib.Variant) (*lib.Variant, error) {
 	requestURL, err := in.config.getRequestURL("_/variant")
 	if err != nil {
@@ -86,3 +116,48 @@ func (in *Internal) AddVariant(variant *lib.Variant) (*lib.Variant, error) {
 	})
 	return &createdVariant, err
 }
+
+// GetAgents lists the registered build agents, alive or not
+func (in *Internal) GetAgents() ([]*lib.Agent, error) {
+	requestURL, err := in.config.getRequestURL("_/agent")
+	if err != nil {
+		return nil, err
+	}
+	var agents []*lib.Agent
+	err = perigee.Get(requestURL, perigee.Options{
+		Results:    &agents,
+		OkCodes:    []int{200},
+		SetHeaders: in.config.authenticateRequest,
+	})
+	return agents, err
+}
+
+// AcquireAgentLease takes a slot of the capacity of a build agent for a job, returning false while the agent is running at its capacity
+func (in *Internal) AcquireAgentLease(name string, lease *lib.AgentLease) (bool, error) {
+	requestURL, err := in.config.getRequestURL(agentLeasePath(name, lease))
+	if err != nil {
+		return false, err
+	}
+	var status int
+	err = perigee.Put(requestURL, perigee.Options{
+		OkCodes:    []int{204, 409},
+		StatusCode: &status,
+		SetHeaders: in.config.authenticateRequest,
+	})
+	return err == nil && status == 204, err
+}
+
+func (in *Internal) ReleaseAgentLease(name string, lease *lib.AgentLease) error {
+	requestURL, err := in.config.getRequestURL(agentLeasePath(name, lease))
+	if err != nil {
+		return err
+	}
+	return perigee.Delete(requestURL, perigee.Options{
+		OkCodes:    []int{204},
+		SetHeaders: in.config.authenticateRequest,
+	})
+}
+
+func agentLeasePath(name string, lease *lib.AgentLease) string {
+	return fmt.Sprintf("_/agent/%s/lease/%s/%s", url.QueryEscape(name), url.QueryEscape(lease.JobID), url.QueryEscape(lease.ID))
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 
 	lib "github.com/bazooka-ci/bazooka/commons"
 	"github.com/racker/perigee"
@@ -12,21 +13,36 @@ type Job struct {
 	config *Config
 }
 
-func (c *Job) List() ([]lib.Job, error) {
+// List returns the jobs of all the projects selected by the query, along with the total count of matching jobs
+func (c *Job) List(query *lib.JobQuery) ([]lib.Job, int, error) {
+	return listJobs(c.config, "job", query)
+}
+
+func listJobs(config *Config, path string, query *lib.JobQuery) ([]lib.Job, int, error) {
 	var j []lib.Job
 
-	requestURL, err := c.config.getRequestURL("job")
+	if query == nil {
+		query = &lib.JobQuery{}
+	}
+	requestURL, err := config.getRequestURL(path, query.QueryParams()...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	err = perigee.Get(requestURL, perigee.Options{
+	response, err := perigee.Request("GET", requestURL, perigee.Options{
 		Results:    &j,
 		OkCodes:    []int{200},
-		SetHeaders: c.config.authenticateRequest,
+		SetHeaders: config.authenticateRequest,
 	})
+	if err != nil {
+		return nil, 0, err
+	}
 
-	return j, err
+	total, err := strconv.Atoi(response.HttpResponse.Header.Get(lib.TotalCountHeader))
+	if err != nil {
+		total = len(j)
+	}
+	return j, total, nil
 }
 
 func (c *Job) Get(jobID string) (*lib.Job, error) {
@@ -46,6 +62,32 @@ func (c *Job) Get(jobID string) (*lib.Job, error) {
 	return &j, err
 }
 
+// Pin keeps a job from being garbage collected
+func (c *Job) Pin(jobID string) (*lib.Job, error) {
+	return c.setPinned(jobID, "PUT")
+}
+
+func (c *Job) Unpin(jobID string) (*lib.Job, error) {
+	return c.setPinned(jobID, "DELETE")
+}
+
+func (c *Job) setPinned(jobID, method string) (*lib.Job, error) {
+	var j lib.Job
+
+	requestURL, err := c.config.getRequestURL(fmt.Sprintf("job/%s/pin", url.QueryEscape(jobID)))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = perigee.Request(method, requestURL, perigee.Options{
+		Results:    &j,
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+
+	return &j, err
+}
+
 func (c *Job) Variants(jobID string) ([]lib.Variant, error) {
 	var v []lib.Variant
 
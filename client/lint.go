@@ -0,0 +1,32 @@
+package client
+
+import (
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/racker/perigee"
+)
+
+type Lint struct {
+	config *Config
+}
+
+// Check asks the server to check a configuration file, named either .bazooka.yml or .travis.yml
+func (c *Lint) Check(file string, content []byte) (*lib.LintReport, error) {
+	var report lib.LintReport
+
+	requestURL, err := c.config.getRequestURL("lint")
+	if err != nil {
+		return nil, err
+	}
+
+	err = perigee.Post(requestURL, perigee.Options{
+		ReqBody: &lib.LintRequest{
+			File:    file,
+			Content: string(content),
+		},
+		Results:    &report,
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+
+	return &report, err
+}
@@ -31,21 +31,9 @@ func (c *Project) List() ([]lib.Project, error) {
 	return p, err
 }
 
-func (c *Project) Jobs(projectID string) ([]lib.Job, error) {
-	var j []lib.Job
-
-	requestURL, err := c.config.getRequestURL(fmt.Sprintf("project/%s/job", url.QueryEscape(projectID)))
-	if err != nil {
-		return nil, err
-	}
-
-	err = perigee.Get(requestURL, perigee.Options{
-		Results:    &j,
-		OkCodes:    []int{200},
-		SetHeaders: c.config.authenticateRequest,
-	})
-
-	return j, err
+// Jobs returns the jobs of a project selected by the query, along with the total count of matching jobs
+func (c *Project) Jobs(projectID string, query *lib.JobQuery) ([]lib.Job, int, error) {
+	return listJobs(c.config, fmt.Sprintf("project/%s/job", url.QueryEscape(projectID)), query)
 }
 
 func (c *Project) Get(projectID string) (*lib.Project, error) {
@@ -87,6 +75,39 @@ func (c *Project) Create(name, scm, scmUri string) (*lib.Project, error) {
 	return createdProject, err
 }
 
+func (c *Project) Delete(projectID string, force bool) error {
+	query := []string{}
+	if force {
+		query = append(query, "force=true")
+	}
+	requestURL, err := c.config.getRequestURL(fmt.Sprintf("project/%s", url.QueryEscape(projectID)), query...)
+	if err != nil {
+		return err
+	}
+
+	return perigee.Delete(requestURL, perigee.Options{
+		OkCodes:    []int{204},
+		SetHeaders: c.config.authenticateRequest,
+	})
+}
+
+// ClearCache removes the cached directories of a project branch, or of all its branches if branch is empty
+func (c *Project) ClearCache(projectID, branch string) error {
+	query := []string{}
+	if len(branch) > 0 {
+		query = append(query, "branch="+branch)
+	}
+	requestURL, err := c.config.getRequestURL(fmt.Sprintf("project/%s/cache", url.QueryEscape(projectID)), query...)
+	if err != nil {
+		return err
+	}
+
+	return perigee.Delete(requestURL, perigee.Options{
+		OkCodes:    []int{204},
+		SetHeaders: c.config.authenticateRequest,
+	})
+}
+
 func (c *Project) StartJob(projectID, scmReference string, envParameters []string) (*lib.Job, error) {
 	startJob := lib.StartJob{
 		ScmReference: scmReference,
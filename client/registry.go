@@ -0,0 +1,68 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/racker/perigee"
+)
+
+// Registry manages the credentials of the private Docker registries, global when the project id is empty
+type Registry struct {
+	config *Config
+}
+
+func registryPath(projectID string) string {
+	if len(projectID) == 0 {
+		return "registry"
+	}
+	return fmt.Sprintf("project/%s/registry", url.QueryEscape(projectID))
+}
+
+func (c *Registry) List(projectID string) ([]*lib.RegistryCredential, error) {
+	var credentials []*lib.RegistryCredential
+
+	requestURL, err := c.config.getRequestURL(registryPath(projectID))
+	if err != nil {
+		return nil, err
+	}
+
+	err = perigee.Get(requestURL, perigee.Options{
+		Results:    &credentials,
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+
+	return credentials, err
+}
+
+func (c *Registry) Set(projectID string, credential *lib.RegistryCredential) (*lib.RegistryCredential, error) {
+	var saved lib.RegistryCredential
+
+	requestURL, err := c.config.getRequestURL(fmt.Sprintf("%s/%s", registryPath(projectID), url.QueryEscape(credential.Registry)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = perigee.Put(requestURL, perigee.Options{
+		ReqBody:    credential,
+		Results:    &saved,
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+
+	return &saved, err
+}
+
+func (c *Registry) Remove(projectID, registry string) error {
+	requestURL, err := c.config.getRequestURL(fmt.Sprintf("%s/%s", registryPath(projectID), url.QueryEscape(registry)))
+	if err != nil {
+		return err
+	}
+
+	return perigee.Delete(requestURL, perigee.Options{
+		OkCodes:    []int{204},
+		SetHeaders: c.config.authenticateRequest,
+	})
+}
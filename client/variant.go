@@ -28,6 +28,22 @@ func (c *Variant) Get(variantID string) (*lib.Variant, error) {
 	return &variant, err
 }
 
+func (c *Variant) Steps(variantID string) ([]*lib.VariantStep, error) {
+	var steps []*lib.VariantStep
+
+	requestURL, err := c.config.getRequestURL(fmt.Sprintf("variant/%s/steps", url.QueryEscape(variantID)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = perigee.Get(requestURL, perigee.Options{
+		Results:    &steps,
+		OkCodes:    []int{200},
+		SetHeaders: c.config.authenticateRequest,
+	})
+	return steps, err
+}
+
 func (c *Variant) Log(variantID string) ([]lib.LogEntry, error) {
 	var log []lib.LogEntry
 
@@ -0,0 +1,52 @@
+package bazooka
+
+import "time"
+
+// AgentHeartbeat is the interval at which the agents let the server know they are still up.
+// An agent which missed a few heartbeats is no longer given variants
+const (
+	AgentHeartbeat = 30 * time.Second
+	agentTimeout   = 3 * AgentHeartbeat
+)
+
+// Agent is a Docker host, other than the one of the server, to which the orchestration dispatches the variants
+// of the projects selecting it by its labels. DockerURL is the address of its Docker API, as reached from the server,
+// and Capacity the number of variants of all the jobs it builds or runs at once, each of them holding one of the Leases
+type Agent struct {
+	Name       string       `bson:"name" json:"name"`
+	DockerURL  string       `bson:"docker_url" json:"docker_url"`
+	Labels     []string     `bson:"labels" json:"labels"`
+	Capacity   int          `bson:"capacity" json:"capacity"`
+	Leases     []AgentLease `bson:"leases" json:"leases"`
+	Registered time.Time    `bson:"registered" json:"registered"`
+	LastSeen   time.Time    `bson:"last_seen" json:"last_seen"`
+}
+
+// AgentLease is a slot of the capacity of an agent, held by a job while it builds or runs a variant on the agent.
+// The server releases the leases of a job once it finishes
+type AgentLease struct {
+	JobID string `bson:"job_id" json:"job_id"`
+	ID    string `bson:"id" json:"id"`
+}
+
+// Alive tells whether the agent sent a heartbeat recently
+func (a *Agent) Alive(now time.Time) bool {
+	return now.Sub(a.LastSeen) < agentTimeout
+}
+
+// HasLabels tells whether the agent has all the labels
+func (a *Agent) HasLabels(labels []string) bool {
+	for _, label := range labels {
+		found := false
+		for _, own := range a.Labels {
+			if own == label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,26 @@
+package bazooka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentHasLabels(t *testing.T) {
+	agent := &Agent{Labels: []string{"gpu-free", "large-disk", "linux"}}
+
+	assert.True(t, agent.HasLabels(nil))
+	assert.True(t, agent.HasLabels([]string{"large-disk"}))
+	assert.True(t, agent.HasLabels([]string{"large-disk", "gpu-free"}))
+	assert.False(t, agent.HasLabels([]string{"large-disk", "windows"}))
+	assert.False(t, (&Agent{}).HasLabels([]string{"linux"}))
+}
+
+func TestAgentAlive(t *testing.T) {
+	now := time.Now()
+
+	assert.True(t, (&Agent{LastSeen: now.Add(-AgentHeartbeat)}).Alive(now))
+	assert.False(t, (&Agent{LastSeen: now.Add(-4 * AgentHeartbeat)}).Alive(now))
+	assert.False(t, (&Agent{}).Alive(now))
+}
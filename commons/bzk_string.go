@@ -98,19 +98,37 @@ func decryptBzkString(str string) ([]byte, error) {
 	if PrivateKey == nil {
 		return nil, fmt.Errorf("PrivateKey is not set")
 	}
+	return decryptHexString(PrivateKey, str)
+}
 
+func decryptHexString(key []byte, str string) ([]byte, error) {
 	toDecryptDataAsHex, err := hex.DecodeString(string(str))
 	if err != nil {
 		return nil, fmt.Errorf("Unable to decode string as hexa data, reason is: %v\n", err)
 	}
 
-	decrypted, err := Decrypt(PrivateKey, toDecryptDataAsHex)
+	decrypted, err := Decrypt(key, toDecryptDataAsHex)
 	if err != nil {
 		return nil, fmt.Errorf("Error while trying to decrypt data, reason is: %v\n", err)
 	}
 	return decrypted, nil
 }
 
+// DecryptSecuredValues decrypts the hex encoded 'secure: <string>' entries of a configuration
+// and returns the values of the NAME=VALUE pairs they contain
+func DecryptSecuredValues(key []byte, secured []string) ([]string, error) {
+	res := make([]string, 0, len(secured))
+	for _, s := range secured {
+		decrypted, err := decryptHexString(key, s)
+		if err != nil {
+			return nil, err
+		}
+		_, v := SplitNameValue(string(decrypted))
+		res = append(res, v)
+	}
+	return res, nil
+}
+
 func encryptBzkString(str string) (string, error) {
 	if PrivateKey == nil {
 		return "", fmt.Errorf("PrivateKey is not set")
@@ -3,6 +3,8 @@ package bazooka
 import (
 	"errors"
 	"fmt"
+	"path"
+	"reflect"
 )
 
 const (
@@ -11,29 +13,93 @@ const (
 )
 
 type Config struct {
-	Language       string       `yaml:"language,omitempty"`
-	Image          Images       `yaml:"image,omitempty"`
-	Setup          Commands     `yaml:"setup,omitempty"`
-	BeforeInstall  Commands     `yaml:"before_install,omitempty"`
-	Install        Commands     `yaml:"install,omitempty"`
-	BeforeScript   Commands     `yaml:"before_script,omitempty"`
-	Script         Commands     `yaml:"script,omitempty"`
-	AfterScript    Commands     `yaml:"after_script,omitempty"`
-	AfterSuccess   Commands     `yaml:"after_success,omitempty"`
-	AfterFailure   Commands     `yaml:"after_failure,omitempty"`
-	Services       []Service    `yaml:"services,omitempty"`
-	Env            []BzkString  `yaml:"env,omitempty"`
-	FromImage      string       `yaml:"from"`
-	Matrix         ConfigMatrix `yaml:"matrix,omitempty"`
-	Archive        Globs        `yaml:"archive,omitempty"`
-	ArchiveSuccess Globs        `yaml:"archive_success,omitempty"`
-	ArchiveFailure Globs        `yaml:"archive_failure,omitempty"`
+	Language       string         `yaml:"language,omitempty"`
+	Image          Images         `yaml:"image,omitempty"`
+	Setup          Commands       `yaml:"setup,omitempty"`
+	BeforeInstall  Commands       `yaml:"before_install,omitempty"`
+	Install        Commands       `yaml:"install,omitempty"`
+	BeforeScript   Commands       `yaml:"before_script,omitempty"`
+	Script         Commands       `yaml:"script,omitempty"`
+	AfterScript    Commands       `yaml:"after_script,omitempty"`
+	AfterSuccess   Commands       `yaml:"after_success,omitempty"`
+	AfterFailure   Commands       `yaml:"after_failure,omitempty"`
+	Services       []Service      `yaml:"services,omitempty"`
+	Env            []BzkString    `yaml:"env,omitempty"`
+	FromImage      string         `yaml:"from"`
+	Matrix         ConfigMatrix   `yaml:"matrix,omitempty"`
+	Archive        Globs          `yaml:"archive,omitempty"`
+	ArchiveSuccess Globs          `yaml:"archive_success,omitempty"`
+	ArchiveFailure Globs          `yaml:"archive_failure,omitempty"`
+	Cache          Dirs           `yaml:"cache,omitempty"`
+	Resources      *Resources     `yaml:"resources,omitempty"`
+	Stages         []Stage        `yaml:"stages,omitempty"`
+	Deploy         *Deploy        `yaml:"deploy,omitempty"`
+	Agent          *AgentSelector `yaml:"agent,omitempty"`
+}
+
+// Stage is a step of a pipeline, whose variants only start once those of the previous stages succeeded.
+// The keys it sets override those of the root of the configuration, except for the language versions and images
+type Stage struct {
+	Name   string `yaml:"name"`
+	Config `yaml:",inline"`
+}
+
+// Deploy is run once per job, after all its variants succeeded, in a container of the image of the first variant
+// matching the Variant selector, or of the first variant if it is not set.
+// The artifacts of the variants of the job are available in /artifacts/<variant number>
+type Deploy struct {
+	Script  Commands               `yaml:"script"`
+	On      DeployConditions       `yaml:"on,omitempty"`
+	Variant map[string]interface{} `yaml:"variant,omitempty"`
+}
+
+// DeployConditions select the jobs which deploy: with Tags, only those of tags,
+// otherwise only those of the branches matching one of the Branch globs, any branch if there are none
+type DeployConditions struct {
+	Branch Globs `yaml:"branch,omitempty"`
+	Tags   bool  `yaml:"tags,omitempty"`
+}
+
+// Matches tells whether a job of the SCM reference, either a tag or a branch, deploys
+func (d *DeployConditions) Matches(reference string, tag bool) bool {
+	if d.Tags || tag {
+		return d.Tags && tag
+	}
+	if len(d.Branch) == 0 {
+		return true
+	}
+	for _, glob := range d.Branch {
+		if matched, _ := path.Match(glob, reference); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// AgentSelector dispatches the variants to the build agents having all the Labels, instead of the Docker host of the server
+type AgentSelector struct {
+	Labels []string `yaml:"labels"`
 }
 
 // Service is the representation of a a linked Docker container for the build
 type Service struct {
-	Image string `yaml:"image"`
-	Alias string `yaml:"alias,omitempty"`
+	Image       string       `yaml:"image"`
+	Alias       string       `yaml:"alias,omitempty"`
+	Env         []string     `yaml:"env,omitempty"`
+	Command     []string     `yaml:"command,omitempty"`
+	Ports       []string     `yaml:"ports,omitempty"`
+	Healthcheck *Healthcheck `yaml:"healthcheck,omitempty"`
+}
+
+// Healthcheck tells when a service is ready for the build to start:
+// once Command, run in the service container, exits with 0, or else once the HTTP path answers
+// with a 2xx or 3xx status on Port, or else once the TCP Port accepts connections.
+// Timeout is the number of seconds to wait for the service to be ready, 60 by default
+type Healthcheck struct {
+	Port    int    `yaml:"port,omitempty"`
+	HTTP    string `yaml:"http,omitempty"`
+	Command string `yaml:"command,omitempty"`
+	Timeout int    `yaml:"timeout,omitempty"`
 }
 
 type Images []string
@@ -42,8 +108,35 @@ type Commands []string
 
 type Globs []string
 
+// Dirs are directories of the build container, either absolute, relative to the home directory (~/) or relative to the build directory
+type Dirs []string
+
+// ConfigMatrix tunes the variants generated from the build matrix.
+// Include adds one-off variants on top of the cartesian product, kept even if an Exclude entry matches them.
+// The variants selected by AllowFailures don't fail the job.
+// With FastFinish, the job status is decided as soon as the other variants finish,
+// the variants allowed to fail still running being stopped if CancelAllowedFailures is set
 type ConfigMatrix struct {
-	Exclude []map[string]interface{} `yaml:"exclude,omitempty"`
+	Exclude               []map[string]interface{} `yaml:"exclude,omitempty"`
+	Include               []map[string]interface{} `yaml:"include,omitempty"`
+	AllowFailures         []map[string]interface{} `yaml:"allow_failures,omitempty"`
+	FastFinish            bool                     `yaml:"fast_finish,omitempty"`
+	CancelAllowedFailures bool                     `yaml:"cancel_allowed_failures,omitempty"`
+}
+
+// WithStage returns a copy of the configuration, overridden by the keys set by a stage
+func (c *Config) WithStage(stage *Stage) *Config {
+	res := *c
+	dst := reflect.ValueOf(&res).Elem()
+	src := reflect.ValueOf(stage.Config)
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Field(i)
+		if !reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			dst.Field(i).Set(field)
+		}
+	}
+	res.Stages = nil
+	return &res
 }
 
 func ResolveConfigFile(source string) (string, error) {
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestResolveConfigFile(t *testing.T) {
@@ -69,3 +70,50 @@ type parse struct {
 	Type1 string   `yaml:"abc"`
 	Type2 []string `yaml:"def"`
 }
+
+func TestWithStage(t *testing.T) {
+	conf := &Config{}
+	require.NoError(t, Parse("fixtures/config/stages/.bazooka.yml", conf))
+	require.Len(t, conf.Stages, 2)
+	assert.Equal(t, "build", conf.Stages[0].Name)
+	assert.Equal(t, "test", conf.Stages[1].Name)
+
+	build := conf.WithStage(&conf.Stages[0])
+	assert.Equal(t, "go", build.Language)
+	assert.Equal(t, Commands{"make"}, build.Script)
+	assert.Equal(t, []BzkString{{Name: "DB", Value: "postgres"}}, build.Env)
+	assert.Empty(t, build.Stages)
+
+	test := conf.WithStage(&conf.Stages[1])
+	assert.Equal(t, "go", test.Language)
+	assert.Equal(t, Commands{"make test"}, test.Script)
+	assert.Equal(t, []BzkString{{Name: "SUITE", Value: "unit"}, {Name: "SUITE", Value: "integration"}}, test.Env)
+	assert.Len(t, test.Matrix.AllowFailures, 1)
+	assert.Empty(t, test.Stages)
+
+	// the configuration itself is left untouched
+	assert.Equal(t, Commands{"make"}, conf.Script)
+	assert.Len(t, conf.Stages, 2)
+}
+
+func TestDeployConditions(t *testing.T) {
+	conf := &Config{}
+	require.NoError(t, Parse("fixtures/config/deploy/.bazooka.yml", conf))
+	require.NotNil(t, conf.Deploy)
+	assert.Equal(t, Commands{"./release.sh /artifacts"}, conf.Deploy.Script)
+	assert.Equal(t, map[string]interface{}{"go": 1.4}, conf.Deploy.Variant)
+
+	on := conf.Deploy.On
+	assert.True(t, on.Matches("master", false))
+	assert.True(t, on.Matches("release/1.0", false))
+	assert.False(t, on.Matches("feature/deploy", false))
+	assert.False(t, on.Matches("master", true))
+
+	any := &DeployConditions{}
+	assert.True(t, any.Matches("feature/deploy", false))
+	assert.False(t, any.Matches("v1.0", true))
+
+	tags := &DeployConditions{Branch: Globs{"master"}, Tags: true}
+	assert.True(t, tags.Matches("v1.0", true))
+	assert.False(t, tags.Matches("master", false))
+}
@@ -0,0 +1,70 @@
+package bazooka
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExportVersion is the version of the export archive format written by WriteExport
+const ExportVersion = 1
+
+// Export is the state of a bazooka server, as moved from one server to another
+type Export struct {
+	Version  int                `json:"version"`
+	Exported time.Time          `json:"exported"`
+	Projects []*ExportedProject `json:"projects"`
+	// Users carry their password hashes
+	Users  []*User  `json:"users"`
+	Images []*Image `json:"images"`
+	// Registries are the global registry credentials, with their passwords decrypted:
+	// each server encrypts them with its own key
+	Registries RegistryCredentials `json:"registries,omitempty"`
+}
+
+// ExportedProject is a project along with its keys and, when the job history is exported, its jobs and variants
+type ExportedProject struct {
+	*Project
+	Key        *SSHKey      `json:"key,omitempty"`
+	CryptoKeys []*CryptoKey `json:"crypto_keys,omitempty"`
+	// Registries are the registry credentials of the project, with their passwords decrypted
+	Registries RegistryCredentials `json:"registries,omitempty"`
+	Jobs       []*Job              `json:"jobs,omitempty"`
+	Variants   []*Variant          `json:"variants,omitempty"`
+}
+
+type ImportReport struct {
+	Imported []string `json:"imported"`
+	// Skipped gives, for every entry which was not imported, the reason why
+	Skipped map[string]string `json:"skipped,omitempty"`
+}
+
+// WriteExport writes the export to w as gzip compressed JSON
+func WriteExport(w io.Writer, export *Export) error {
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(export); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// ReadExport reads back an export written by WriteExport
+func ReadExport(r io.Reader) (*Export, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Not a bazooka export archive: %v", err)
+	}
+	defer gz.Close()
+
+	export := &Export{}
+	if err := json.NewDecoder(gz).Decode(export); err != nil {
+		return nil, fmt.Errorf("Not a bazooka export archive: %v", err)
+	}
+	if export.Version != ExportVersion {
+		return nil, fmt.Errorf("Unsupported export archive version %d, expected %d", export.Version, ExportVersion)
+	}
+	return export, nil
+}
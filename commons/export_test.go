@@ -0,0 +1,52 @@
+package bazooka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportArchive(t *testing.T) {
+	export := &Export{
+		Version:  ExportVersion,
+		Exported: time.Date(2015, 6, 7, 16, 0, 0, 0, time.UTC),
+		Projects: []*ExportedProject{{
+			Project:    &Project{ID: "p", Name: "bazooka", HookKey: "h", JobCounter: 1, Config: map[string]string{"bzk.scm.reuse": "true"}},
+			Key:        &SSHKey{ID: "k", ProjectID: "p", Content: "ssh-rsa"},
+			CryptoKeys: []*CryptoKey{{ID: "c", ProjectID: "p", Content: []byte{0, 1, 2}}},
+			Registries: RegistryCredentials{{ProjectID: "p", Registry: "registry.example.com", Username: "ci", Password: "secret"}},
+			Jobs:       []*Job{{ID: "j", ProjectID: "p", Number: 1, Status: JOB_SUCCESS}},
+		}},
+		Users:      []*User{{ID: "u", Email: "admin@bazooka.io", Password: "$2a$hash"}},
+		Images:     []*Image{{Name: "parser/java", Image: "bazooka/parser-java"}},
+		Registries: RegistryCredentials{{Registry: "docker.io", Username: "bzk", Password: "hub-secret"}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteExport(&buf, export))
+
+	read, err := ReadExport(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, export.Exported, read.Exported.UTC())
+	read.Exported = export.Exported
+	assert.Equal(t, export, read)
+
+	_, err = ReadExport(bytes.NewBufferString("{}"))
+	assert.Error(t, err, "an export archive is gzip compressed")
+
+	buf.Reset()
+	require.NoError(t, WriteExport(&buf, &Export{Version: ExportVersion + 1}))
+	_, err = ReadExport(&buf)
+	assert.Error(t, err, "a newer archive version should be refused")
+
+	buf.Reset()
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("not json"))
+	gz.Close()
+	_, err = ReadExport(&buf)
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package bazooka
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TotalCountHeader carries the total count of jobs matching a query, regardless of its pagination
+const TotalCountHeader = "X-Total-Count"
+
+// JobQuery filters, sorts and paginates job listings
+type JobQuery struct {
+	ProjectID string
+	Status    JobStatus
+	// Reference is the scm reference the job was started on, usually a branch
+	Reference string
+	// Author matches, ignoring case, a part of the name or of the email of the commit author
+	Author string
+	// From and To bound the start time of the jobs, From being included and To excluded
+	From time.Time
+	To   time.Time
+	// Offset jobs are skipped, then at most Limit jobs are returned, all of them if Limit is 0
+	Offset int
+	Limit  int
+	// Jobs are sorted by start time, the most recent first unless Ascending is set
+	Ascending bool
+}
+
+const queryDateFormat = "2006-01-02"
+
+func parseQueryTime(name, value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(queryDateFormat, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s should be a date (%s) or a time (%s)", name, queryDateFormat, time.RFC3339)
+	}
+	return t, nil
+}
+
+func parseQueryInt(name, value string) (int, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%s should be a positive integer", name)
+	}
+	return i, nil
+}
+
+// ParseJobQuery reads a job query from the parameters of a job listing request:
+// status, reference (or branch), author, from, to, offset, limit and sort (asc or desc)
+func ParseJobQuery(values url.Values) (*JobQuery, error) {
+	q := &JobQuery{
+		Status:    JobStatus(strings.ToUpper(values.Get("status"))),
+		Reference: values.Get("reference"),
+		Author:    values.Get("author"),
+	}
+	if len(q.Reference) == 0 {
+		q.Reference = values.Get("branch")
+	}
+
+	var err error
+	if q.From, err = parseQueryTime("from", values.Get("from")); err != nil {
+		return nil, err
+	}
+	if q.To, err = parseQueryTime("to", values.Get("to")); err != nil {
+		return nil, err
+	}
+	if q.Offset, err = parseQueryInt("offset", values.Get("offset")); err != nil {
+		return nil, err
+	}
+	if q.Limit, err = parseQueryInt("limit", values.Get("limit")); err != nil {
+		return nil, err
+	}
+
+	switch values.Get("sort") {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return nil, fmt.Errorf("sort should be either asc or desc")
+	}
+	return q, nil
+}
+
+// QueryParams returns the request parameters, as name=value strings, read back by ParseJobQuery
+func (q *JobQuery) QueryParams() []string {
+	params := []string{}
+	add := func(name, value string) {
+		if len(value) > 0 {
+			params = append(params, name+"="+value)
+		}
+	}
+	add("status", string(q.Status))
+	add("reference", q.Reference)
+	add("author", q.Author)
+	if !q.From.IsZero() {
+		add("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		add("to", q.To.Format(time.RFC3339))
+	}
+	if q.Offset > 0 {
+		add("offset", strconv.Itoa(q.Offset))
+	}
+	if q.Limit > 0 {
+		add("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Ascending {
+		add("sort", "asc")
+	}
+	return params
+}
+
+// Match tells if a job satisfies the query filters, the project id being a complete id
+func (q *JobQuery) Match(job *Job) bool {
+	switch {
+	case len(q.ProjectID) > 0 && job.ProjectID != q.ProjectID:
+		return false
+	case len(q.Status) > 0 && job.Status != q.Status:
+		return false
+	case len(q.Reference) > 0 && job.SCMMetadata.Reference != q.Reference:
+		return false
+	case !q.From.IsZero() && job.Started.Before(q.From):
+		return false
+	case !q.To.IsZero() && !job.Started.Before(q.To):
+		return false
+	}
+	if len(q.Author) > 0 {
+		author := strings.ToLower(q.Author)
+		return strings.Contains(strings.ToLower(job.SCMMetadata.Author.Name), author) ||
+			strings.Contains(strings.ToLower(job.SCMMetadata.Author.Email), author)
+	}
+	return true
+}
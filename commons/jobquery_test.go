@@ -0,0 +1,68 @@
+package bazooka
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJobQuery(t *testing.T) {
+	values, err := url.ParseQuery("status=failed&branch=master&author=jdoe&from=2015-06-01&limit=20&offset=40&sort=asc")
+	require.NoError(t, err)
+
+	q, err := ParseJobQuery(values)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatus(JOB_FAILED), q.Status)
+	assert.Equal(t, "master", q.Reference)
+	assert.Equal(t, "jdoe", q.Author)
+	assert.Equal(t, time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC), q.From)
+	assert.True(t, q.To.IsZero())
+	assert.Equal(t, 20, q.Limit)
+	assert.Equal(t, 40, q.Offset)
+	assert.True(t, q.Ascending)
+
+	// the query parameters are read back to the same query
+	params := url.Values{}
+	for _, p := range q.QueryParams() {
+		name, value := SplitNameValue(p)
+		params.Set(name, value)
+	}
+	back, err := ParseJobQuery(params)
+	require.NoError(t, err)
+	assert.Equal(t, q, back)
+
+	for _, invalid := range []string{"limit=-1", "offset=a", "from=yesterday", "sort=random"} {
+		values, err := url.ParseQuery(invalid)
+		require.NoError(t, err)
+		_, err = ParseJobQuery(values)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestJobQueryMatch(t *testing.T) {
+	t0 := time.Date(2015, 6, 7, 16, 0, 0, 0, time.UTC)
+	job := &Job{
+		ProjectID: "p",
+		Status:    JOB_FAILED,
+		Started:   t0,
+		SCMMetadata: SCMMetadata{
+			Reference: "master",
+			Author:    Person{Name: "John Doe", Email: "jdoe@bazooka.io"},
+		},
+	}
+
+	assert.True(t, (&JobQuery{}).Match(job))
+	assert.True(t, (&JobQuery{ProjectID: "p", Status: JOB_FAILED, Reference: "master", Author: "JOHN"}).Match(job))
+	assert.True(t, (&JobQuery{Author: "jdoe@"}).Match(job))
+	assert.True(t, (&JobQuery{From: t0, To: t0.Add(time.Second)}).Match(job))
+
+	assert.False(t, (&JobQuery{ProjectID: "q"}).Match(job))
+	assert.False(t, (&JobQuery{Status: JOB_SUCCESS}).Match(job))
+	assert.False(t, (&JobQuery{Reference: "develop"}).Match(job))
+	assert.False(t, (&JobQuery{Author: "jane"}).Match(job))
+	assert.False(t, (&JobQuery{To: t0}).Match(job))
+	assert.False(t, (&JobQuery{From: t0.Add(time.Second)}).Match(job))
+}
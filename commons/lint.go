@@ -0,0 +1,449 @@
+package bazooka
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LanguageKeys are the keys of the root of a configuration read by the language parsers, like the versions to build with
+var LanguageKeys = []string{"go", "jdk", "python", "rvm", "gemfile", "node_js", "php"}
+
+// ConfigError is a problem found in a configuration file, at the path of one of its keys, like services[0].image.
+// The YAML syntax errors have a line instead
+type ConfigError struct {
+	Path    string `json:"path,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ConfigError) Error() string {
+	switch {
+	case len(e.Path) > 0:
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	default:
+		return e.Message
+	}
+}
+
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// LintRequest is a configuration file to check, named either .bazooka.yml or .travis.yml
+type LintRequest struct {
+	File    string `json:"file"`
+	Content string `json:"content"`
+}
+
+type LintReport struct {
+	Valid  bool         `json:"valid"`
+	Errors ConfigErrors `json:"errors,omitempty"`
+}
+
+// Lint checks the configuration file of the request, see Lint
+func (r *LintRequest) Lint() ConfigErrors {
+	return Lint([]byte(r.Content), filepath.Base(r.File) == travisConfigFile)
+}
+
+// LintFile checks a configuration file, see Lint
+func LintFile(file string) (ConfigErrors, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return Lint(b, filepath.Base(file) == travisConfigFile), nil
+}
+
+// Lint checks strictly a configuration: unknown keys, wrong types and invalid matrix selectors.
+// It decodes the configuration the way the parser does, with yaml.v2, keeping the order of the keys.
+// The unknown keys of the root of a Travis configuration are tolerated, Travis having many Bazooka ignores
+func Lint(content []byte, travis bool) ConfigErrors {
+	var doc interface{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return ConfigErrors{syntaxError(err)}
+	}
+	switch doc.(type) {
+	case nil:
+		return ConfigErrors{{Message: "the configuration is empty"}}
+	case map[interface{}]interface{}:
+	default:
+		return ConfigErrors{{Message: fmt.Sprintf("the configuration should be a mapping, got %s", describe(doc))}}
+	}
+	var root yaml.MapSlice
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return ConfigErrors{syntaxError(err)}
+	}
+
+	l := &linter{rootKeys: map[string]bool{}, travis: travis}
+	for _, key := range LanguageKeys {
+		l.rootKeys[key] = true
+	}
+	hasBase := false
+	for _, item := range root {
+		switch fmt.Sprint(item.Key) {
+		case "language":
+			l.rootKeys[fmt.Sprint(item.Value)] = true
+			hasBase = true
+		case "image":
+			hasBase = true
+		}
+	}
+	if !hasBase {
+		l.errorf("", "one of 'language' or 'image' needs to be set")
+	}
+	l.check("", root, reflect.TypeOf(Config{}), true)
+	l.checkInclusions(root)
+	return l.errors
+}
+
+var (
+	oneOrManyTypes = map[reflect.Type]bool{
+		reflect.TypeOf(Images{}):   true,
+		reflect.TypeOf(Commands{}): true,
+		reflect.TypeOf(Globs{}):    true,
+	}
+	bzkStringType = reflect.TypeOf(BzkString{})
+	sizeType      = reflect.TypeOf(Size(0))
+	selectorType  = reflect.TypeOf(map[string]interface{}{})
+	healthType    = reflect.TypeOf(Healthcheck{})
+)
+
+type linter struct {
+	errors ConfigErrors
+	// the keys of the root of the configuration which are not fields of Config
+	rootKeys map[string]bool
+	travis   bool
+}
+
+func (l *linter) errorf(path string, format string, args ...interface{}) {
+	l.errors = append(l.errors, &ConfigError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// check makes sure the value at path can be unmarshalled into the type t
+func (l *linter) check(path string, v interface{}, t reflect.Type, root bool) {
+	if v == nil {
+		return
+	}
+
+	switch {
+	case oneOrManyTypes[t]:
+		if isScalar(v) {
+			return
+		}
+		l.checkScalars(path, v, "a string or a list of strings")
+		return
+	case t == bzkStringType:
+		l.checkBzkString(path, v)
+		return
+	case t == sizeType:
+		if !isScalar(v) {
+			l.errorf(path, "expected a size, like 512m, got %s", describe(v))
+		} else if _, err := ParseSize(fmt.Sprint(v)); err != nil {
+			l.errorf(path, "%v", err)
+		}
+		return
+	case t == selectorType:
+		l.checkSelector(path, v)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		l.check(path, v, t.Elem(), root)
+	case reflect.Interface:
+		// anything goes
+	case reflect.Struct:
+		mapping, ok := v.(yaml.MapSlice)
+		if !ok {
+			l.errorf(path, "expected a mapping, got %s", describe(v))
+			return
+		}
+		fields := yamlFields(t)
+		for _, item := range mapping {
+			key := fmt.Sprint(item.Key)
+			field, found := fields[item.Key]
+			switch {
+			case found:
+				l.check(keyPath(path, key), item.Value, field, false)
+			case root && (l.travis || l.rootKeys[key]):
+				// read by the language parser, or a Travis key ignored by Bazooka
+			default:
+				l.errorf(keyPath(path, key), "unknown key '%s'", key)
+			}
+		}
+		if t == healthType {
+			l.checkHealthcheck(path, mapping)
+		}
+	case reflect.Slice:
+		list, ok := v.([]interface{})
+		if !ok {
+			l.errorf(path, "expected a list, got %s", describe(v))
+			return
+		}
+		for i, item := range list {
+			l.check(indexPath(path, i), item, t.Elem(), false)
+		}
+	case reflect.Map:
+		mapping, ok := v.(yaml.MapSlice)
+		if !ok {
+			l.errorf(path, "expected a mapping, got %s", describe(v))
+			return
+		}
+		for _, item := range mapping {
+			l.check(keyPath(path, fmt.Sprint(item.Key)), item.Value, t.Elem(), false)
+		}
+	case reflect.String:
+		if !isScalar(v) {
+			l.errorf(path, "expected a string, got %s", describe(v))
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			l.errorf(path, "expected true or false, got %s", describe(v))
+		}
+	case reflect.Int, reflect.Int64:
+		if !isInteger(v) {
+			l.errorf(path, "expected an integer, got %s", describe(v))
+		}
+	case reflect.Float64:
+		if _, ok := v.(float64); !ok && !isInteger(v) {
+			l.errorf(path, "expected a number, got %s", describe(v))
+		}
+	}
+}
+
+// checkScalars makes sure the value is a list of scalars
+func (l *linter) checkScalars(path string, v interface{}, expected string) {
+	list, ok := v.([]interface{})
+	if !ok {
+		l.errorf(path, "expected %s, got %s", expected, describe(v))
+		return
+	}
+	for i, item := range list {
+		if !isScalar(item) {
+			l.errorf(indexPath(path, i), "expected %s, got a list containing %s", expected, describe(item))
+		}
+	}
+}
+
+// checkBzkString makes sure the value is either a NAME=VALUE string or a 'secure: <string>' mapping
+func (l *linter) checkBzkString(path string, v interface{}) {
+	if isScalar(v) {
+		return
+	}
+	if mapping, ok := v.(yaml.MapSlice); ok && len(mapping) == 1 && mapping[0].Key == "secure" && isScalar(mapping[0].Value) {
+		return
+	}
+	l.errorf(path, "expected a NAME=VALUE string or 'secure: <encrypted string>', got %s", describe(v))
+}
+
+// checkSelector makes sure the value selects permutations of the build matrix: a mapping of the variables to a value or a list of values,
+// the env variables being NAME=VALUE strings
+func (l *linter) checkSelector(path string, v interface{}) {
+	mapping, ok := v.(yaml.MapSlice)
+	if !ok {
+		l.errorf(path, "expected a matrix selector mapping variables to values, got %s", describe(v))
+		return
+	}
+	for _, item := range mapping {
+		key, valuePath := fmt.Sprint(item.Key), keyPath(path, fmt.Sprint(item.Key))
+		values, paths := []interface{}{item.Value}, []string{valuePath}
+		switch value := item.Value.(type) {
+		case yaml.MapSlice:
+			l.errorf(valuePath, "the matrix variable '%s' should be a value or a list of values, got %s", key, describe(value))
+			continue
+		case []interface{}:
+			values, paths = value, make([]string, len(value))
+			for i := range value {
+				paths[i] = indexPath(valuePath, i)
+			}
+		}
+		for i, v := range values {
+			switch {
+			case !isScalar(v):
+				l.errorf(paths[i], "the matrix variable '%s' should be a value or a list of values, got a list containing %s", key, describe(v))
+			case key == "env" && !strings.Contains(fmt.Sprint(v), "="):
+				l.errorf(paths[i], "the env matrix variable should contain NAME=VALUE strings, got '%v'", v)
+			}
+		}
+	}
+}
+
+// checkHealthcheck makes sure the healthcheck has something to probe: a port or a command
+func (l *linter) checkHealthcheck(path string, healthcheck yaml.MapSlice) {
+	command, port := mappingValue(healthcheck, "command"), mappingValue(healthcheck, "port")
+	if (command == nil || fmt.Sprint(command) == "") && (port == nil || fmt.Sprint(port) == "0") {
+		l.errorf(path, "a healthcheck needs a 'port' to probe or a 'command' to run")
+	}
+}
+
+// checkInclusions makes sure the matrix include entries only select the language versions listed at the root of the configuration:
+// the language parser generating the variants of these versions only, an entry can add env variables to them but no new version
+func (l *linter) checkInclusions(root yaml.MapSlice) {
+	type inclusion struct {
+		path    string
+		entries interface{}
+	}
+	inclusions := []inclusion{{"matrix.include", mappingValue(mappingValue(root, "matrix"), "include")}}
+	if stages, ok := mappingValue(root, "stages").([]interface{}); ok {
+		for i, stage := range stages {
+			inclusions = append(inclusions, inclusion{indexPath("stages", i) + ".matrix.include", mappingValue(mappingValue(stage, "matrix"), "include")})
+		}
+	}
+
+	for _, inclusion := range inclusions {
+		entries, ok := inclusion.entries.([]interface{})
+		if !ok {
+			continue
+		}
+		for i, entry := range entries {
+			mapping, ok := entry.(yaml.MapSlice)
+			if !ok {
+				continue
+			}
+			for _, item := range mapping {
+				key := fmt.Sprint(item.Key)
+				versions := scalarValues(mappingValue(root, key))
+				if key == "env" || !l.rootKeys[key] || versions == nil {
+					continue
+				}
+				valuePath := keyPath(indexPath(inclusion.path, i), key)
+				if list, ok := item.Value.([]interface{}); ok {
+					for j, v := range list {
+						if isScalar(v) && !versions[fmt.Sprint(v)] {
+							l.errorf(indexPath(valuePath, j), "the matrix include entries can only select the '%s' versions of the build matrix, '%v' is not one of them", key, v)
+						}
+					}
+				} else if isScalar(item.Value) && !versions[fmt.Sprint(item.Value)] {
+					l.errorf(valuePath, "the matrix include entries can only select the '%s' versions of the build matrix, '%v' is not one of them", key, item.Value)
+				}
+			}
+		}
+	}
+}
+
+// mappingValue returns the value of a key of a mapping, nil if v is not a mapping or if the key is not set
+func mappingValue(v interface{}, key string) interface{} {
+	mapping, ok := v.(yaml.MapSlice)
+	if !ok {
+		return nil
+	}
+	for _, item := range mapping {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+// scalarValues returns the set of the values of a scalar or of the scalars of a list, nil if there are none
+func scalarValues(v interface{}) map[string]bool {
+	values := []interface{}{v}
+	if list, ok := v.([]interface{}); ok {
+		values = list
+	}
+	res := map[string]bool{}
+	for _, value := range values {
+		if isScalar(value) {
+			res[fmt.Sprint(value)] = true
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// yamlFields maps the yaml keys of a struct to the types of its fields, including those of its inlined structs.
+// The keys are resolved like those of a MapSlice, the 'on' key of a deployment being the boolean true
+func yamlFields(t reflect.Type) map[interface{}]reflect.Type {
+	res := map[interface{}]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		if len(tag) > 1 && tag[1] == "inline" {
+			for k, v := range yamlFields(field.Type) {
+				res[k] = v
+			}
+			continue
+		}
+		name := tag[0]
+		if len(name) == 0 {
+			name = strings.ToLower(field.Name)
+		}
+		res[resolveKey(name)] = field.Type
+	}
+	return res
+}
+
+// resolveKey returns a key as yaml.v2 decodes it in a MapSlice
+func resolveKey(name string) interface{} {
+	var key interface{}
+	if err := yaml.Unmarshal([]byte(name), &key); err != nil || key == nil {
+		return name
+	}
+	return key
+}
+
+func keyPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case yaml.MapSlice, []interface{}:
+		return false
+	}
+	return true
+}
+
+func isInteger(v interface{}) bool {
+	switch v.(type) {
+	case int, int64, uint64:
+		return true
+	}
+	return false
+}
+
+func describe(v interface{}) string {
+	switch v.(type) {
+	case yaml.MapSlice:
+		return "a mapping"
+	case []interface{}:
+		return "a list"
+	default:
+		return fmt.Sprintf("'%v'", v)
+	}
+}
+
+// syntaxError extracts the line of a YAML syntax error
+func syntaxError(err error) *ConfigError {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	var line int
+	if _, scanErr := fmt.Sscanf(msg, "line %d:", &line); scanErr != nil {
+		return &ConfigError{Message: msg}
+	}
+	return &ConfigError{Line: line, Message: strings.TrimSpace(msg[strings.Index(msg, ":")+1:])}
+}
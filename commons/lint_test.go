@@ -0,0 +1,105 @@
+package bazooka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintValidConfigs(t *testing.T) {
+	for _, file := range []string{
+		"fixtures/config/stages/.bazooka.yml",
+		"fixtures/config/deploy/.bazooka.yml",
+		"fixtures/config/resources/.bazooka.yml",
+	} {
+		errs, err := LintFile(file)
+		require.NoError(t, err)
+		assert.Empty(t, errs, file)
+	}
+}
+
+func TestLint(t *testing.T) {
+	errs, err := LintFile("fixtures/config/lint/.bazooka.yml")
+	require.NoError(t, err)
+
+	expected := []ConfigError{
+		{Path: "before_instal", Message: "unknown key 'before_instal'"},
+		{Path: "script", Message: "expected a string or a list of strings, got a mapping"},
+		{Path: "env[2]", Message: "expected a NAME=VALUE string or 'secure: <encrypted string>', got a list"},
+		{Path: "matrix.fast_finish", Message: "expected true or false, got 'yes please'"},
+		{Path: "matrix.exclude[0].go[1]", Message: "the matrix variable 'go' should be a value or a list of values, got a list containing a list"},
+		{Path: "matrix.exclude[0].env", Message: "the env matrix variable should contain NAME=VALUE strings, got 'DB'"},
+		{Path: "services[0].healthcheck.port", Message: "expected an integer, got '5432'"},
+		{Path: "services[0].healthcheck.timeout", Message: "expected an integer, got '1m'"},
+	}
+	require.Len(t, errs, len(expected)+1, errs.Error())
+	for i, exp := range expected {
+		assert.Equal(t, exp, *errs[i])
+	}
+	assert.Equal(t, "resources.memory", errs[len(expected)].Path)
+}
+
+func TestLintTravisRootKeys(t *testing.T) {
+	content := []byte("language: ruby\nsudo: false\nrvm: 2.2\nscript:\n  - rake\n")
+	assert.Empty(t, Lint(content, true))
+
+	errs := Lint(content, false)
+	require.Len(t, errs, 1)
+	assert.Equal(t, ConfigError{Path: "sudo", Message: "unknown key 'sudo'"}, *errs[0])
+}
+
+func TestLintSyntaxError(t *testing.T) {
+	errs := Lint([]byte("language: go\n  script: make\n"), false)
+	require.Len(t, errs, 1)
+	assert.Equal(t, ConfigError{Line: 2, Message: "mapping values are not allowed in this context"}, *errs[0])
+
+	errs = Lint([]byte("- language: go\n"), false)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "the configuration should be a mapping, got a list", errs[0].Message)
+
+	errs = Lint([]byte("script: make\n"), false)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "one of 'language' or 'image' needs to be set", errs[0].Message)
+}
+
+func TestLintMatrixInclude(t *testing.T) {
+	content := []byte(`language: go
+go: [1.3, 1.4]
+matrix:
+  include:
+    - go: 1.4
+      env: RACE=1
+    - go: [1.4, 1.5]
+    - env: DEBUG=1
+`)
+	errs := Lint(content, false)
+	require.Len(t, errs, 1, errs.Error())
+	assert.Equal(t, ConfigError{Path: "matrix.include[1].go[1]", Message: "the matrix include entries can only select the 'go' versions of the build matrix, '1.5' is not one of them"}, *errs[0])
+}
+
+func TestLintHealthcheck(t *testing.T) {
+	content := []byte(`image: golang
+services:
+  - image: postgres
+    healthcheck:
+      command: pg_isready
+  - image: redis
+    healthcheck:
+      timeout: 10
+`)
+	errs := Lint(content, false)
+	require.Len(t, errs, 1, errs.Error())
+	assert.Equal(t, ConfigError{Path: "services[1].healthcheck", Message: "a healthcheck needs a 'port' to probe or a 'command' to run"}, *errs[0])
+}
+
+func TestLintBooleans(t *testing.T) {
+	for _, value := range []string{"true", "yes", "On", "n", "OFF"} {
+		errs := Lint([]byte("image: golang\nmatrix:\n  fast_finish: "+value+"\n"), false)
+		assert.Empty(t, errs, value)
+	}
+
+	errs := Lint([]byte("image: golang\nmatrix:\n  fast_finish: 'yes'\n"), false)
+	require.Len(t, errs, 1)
+	assert.Equal(t, ConfigError{Path: "matrix.fast_finish", Message: "expected true or false, got 'yes'"}, *errs[0])
+}
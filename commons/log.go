@@ -1,7 +1,9 @@
 package bazooka
 
 import (
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -31,6 +33,36 @@ func ConstructLog(message string, template LogEntry) LogEntry {
 		case "PHASE":
 			template.Phase = instructionValue
 			template.Message = ""
+		case "META":
+			name, value := SplitNameValue(instructionValue)
+			if len(name) == 0 {
+				template.Message = message
+				break
+			}
+			template.MetaName = name
+			template.MetaValue = value
+			template.Message = ""
+		case "ARTIFACT":
+			artifact, valid := artifactPath(instructionValue)
+			if !valid {
+				template.Message = message
+				break
+			}
+			template.Artifact = artifact
+			template.Message = ""
+		case "SUMMARY":
+			template.Summary = instructionValue
+			template.Message = ""
+		case "CMD_END", "PHASE_END":
+			exitCode, err := strconv.Atoi(instructionValue)
+			if err != nil {
+				template.Message = message
+				break
+			}
+			template.ExitCode = exitCode
+			template.CommandEnd = instructionType == "CMD_END"
+			template.PhaseEnd = instructionType == "PHASE_END"
+			template.Message = ""
 		default:
 			template.Message = message
 		}
@@ -43,3 +75,19 @@ func ConstructLog(message string, template LogEntry) LogEntry {
 	}
 	return template
 }
+
+// artifactPath returns the path of an artifact relative to the /artifacts folder of the variant,
+// the only one which is kept once the variant finished. The paths outside of it are invalid
+func artifactPath(value string) (string, bool) {
+	p := path.Clean(strings.TrimSpace(value))
+	if path.IsAbs(p) {
+		if !strings.HasPrefix(p, "/artifacts/") {
+			return "", false
+		}
+		p = strings.TrimPrefix(p, "/artifacts/")
+	}
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
@@ -0,0 +1,35 @@
+package bazooka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstructLogMarkers(t *testing.T) {
+	meta := ConstructLog("<META:coverage=87.5%>", LogEntry{})
+	assert.Equal(t, "coverage", meta.MetaName)
+	assert.Equal(t, "87.5%", meta.MetaValue)
+	assert.Empty(t, meta.Message)
+
+	artifact := ConstructLog("<ARTIFACT: target/app.jar >", LogEntry{})
+	assert.Equal(t, "target/app.jar", artifact.Artifact)
+	assert.Empty(t, artifact.Message)
+
+	artifact = ConstructLog("<ARTIFACT:/artifacts/reports/junit.xml>", LogEntry{})
+	assert.Equal(t, "reports/junit.xml", artifact.Artifact)
+
+	for _, outside := range []string{"<ARTIFACT:/bazooka/target/app.jar>", "<ARTIFACT:../app.jar>", "<ARTIFACT:/artifacts>"} {
+		artifact = ConstructLog(outside, LogEntry{})
+		assert.Empty(t, artifact.Artifact)
+		assert.Equal(t, outside, artifact.Message, "An artifact outside of /artifacts should be kept as a message")
+	}
+
+	summary := ConstructLog("<SUMMARY:**42** tests passed>", LogEntry{})
+	assert.Equal(t, "**42** tests passed", summary.Summary)
+	assert.Empty(t, summary.Message)
+
+	invalid := ConstructLog("<META:=value>", LogEntry{})
+	assert.Empty(t, invalid.MetaName)
+	assert.Equal(t, "<META:=value>", invalid.Message, "A metadata marker without a name should be kept as a message")
+}
@@ -0,0 +1,45 @@
+package bazooka
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+)
+
+// WriteLogArchive writes the log entries to w as gzip compressed NDJSON, one entry per line
+func WriteLogArchive(w io.Writer, logs []LogEntry) error {
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	for _, l := range logs {
+		if err := enc.Encode(&l); err != nil {
+			gz.Close()
+			return err
+		}
+	}
+	return gz.Close()
+}
+
+// ReadLogArchive reads back the log entries written by WriteLogArchive.
+// Only the entries for which keep returns true are returned, keep can be nil to get all the entries
+func ReadLogArchive(r io.Reader, keep func(*LogEntry) bool) ([]LogEntry, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	logs := []LogEntry{}
+	dec := json.NewDecoder(gz)
+	for {
+		var l LogEntry
+		if err := dec.Decode(&l); err != nil {
+			if err == io.EOF {
+				return logs, nil
+			}
+			return nil, err
+		}
+		if keep == nil || keep(&l) {
+			logs = append(logs, l)
+		}
+	}
+}
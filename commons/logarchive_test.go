@@ -0,0 +1,39 @@
+package bazooka
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogArchive(t *testing.T) {
+	t0 := time.Date(2015, 6, 7, 16, 0, 0, 0, time.UTC)
+	logs := []LogEntry{
+		{ID: "1", JobID: "j", Message: "fetching", Time: t0},
+		{ID: "2", JobID: "j", VariantID: "v1", Command: "make", Time: t0.Add(time.Second)},
+		{ID: "3", JobID: "j", VariantID: "v2", CommandEnd: true, ExitCode: 2, Time: t0.Add(2 * time.Second)},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteLogArchive(&buf, logs))
+
+	all, err := ReadLogArchive(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	for i := range logs {
+		assert.Equal(t, logs[i].ID, all[i].ID)
+		assert.True(t, logs[i].Time.Equal(all[i].Time))
+	}
+	assert.Equal(t, "make", all[1].Command)
+	assert.Equal(t, 2, all[2].ExitCode)
+
+	v2, err := ReadLogArchive(bytes.NewReader(buf.Bytes()), func(l *LogEntry) bool {
+		return l.VariantID == "v2"
+	})
+	require.NoError(t, err)
+	require.Len(t, v2, 1)
+	assert.Equal(t, "3", v2[0].ID)
+}
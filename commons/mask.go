@@ -0,0 +1,70 @@
+package bazooka
+
+import (
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	maskedValue = "****"
+	// secrets shorter than this are not masked: replacing every occurrence of
+	// a one or two characters value would garble the whole log
+	minMaskedLength = 4
+)
+
+// Masker hides a set of secret values, along with their base64 and URL-encoded forms
+type Masker struct {
+	replacer *strings.Replacer
+}
+
+func NewMasker(secrets []string) *Masker {
+	forms := map[string]struct{}{}
+	for _, secret := range secrets {
+		if len(secret) < minMaskedLength {
+			continue
+		}
+		for _, form := range []string{
+			secret,
+			base64.StdEncoding.EncodeToString([]byte(secret)),
+			base64.RawStdEncoding.EncodeToString([]byte(secret)),
+			base64.URLEncoding.EncodeToString([]byte(secret)),
+			base64.RawURLEncoding.EncodeToString([]byte(secret)),
+			url.QueryEscape(secret),
+			url.PathEscape(secret),
+		} {
+			forms[form] = struct{}{}
+		}
+	}
+
+	if len(forms) == 0 {
+		return &Masker{}
+	}
+
+	// the replacer tries the old strings in order: try the longest ones first
+	// so that a padded base64 form is not only partially masked
+	sorted := make([]string, 0, len(forms))
+	for form := range forms {
+		sorted = append(sorted, form)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) == len(sorted[j]) {
+			return sorted[i] < sorted[j]
+		}
+		return len(sorted[i]) > len(sorted[j])
+	})
+
+	oldnew := make([]string, 0, 2*len(sorted))
+	for _, form := range sorted {
+		oldnew = append(oldnew, form, maskedValue)
+	}
+	return &Masker{strings.NewReplacer(oldnew...)}
+}
+
+func (m *Masker) Mask(s string) string {
+	if m == nil || m.replacer == nil {
+		return s
+	}
+	return m.replacer.Replace(s)
+}
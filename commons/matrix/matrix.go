@@ -38,6 +38,52 @@ func (mx *Matrix) IterAll(it Iterator, exclusions []*Matrix) {
 	mx.iter(it, map[string]string{}, exclusions, []string{}, keys...)
 }
 
+// IterIncluded calls it with the permutations of each of the included matrices, completed with the variables of mx having a single value,
+// unless IterAll with the same exclusions already produces them. Nil includes are skipped.
+// The counters are prefixed with "i" and the include index, so that they don't collide with those of IterAll
+func (mx *Matrix) IterIncluded(it Iterator, includes []*Matrix, exclusions []*Matrix) {
+	cf := fmt.Sprintf("i%%0%dd", len(includes)/10+1)
+	for i, include := range includes {
+		if include == nil {
+			continue
+		}
+		inc := Matrix{}
+		for k, vs := range *mx {
+			if len(vs) == 1 {
+				inc[k] = vs
+			}
+		}
+		for k, vs := range *include {
+			inc[k] = vs
+		}
+		prefix := fmt.Sprintf(cf, i)
+		inc.IterAll(func(permutation map[string]string, counter string) {
+			if mx.produces(permutation, exclusions) {
+				return
+			}
+			it(permutation, prefix+counter)
+		}, nil)
+	}
+}
+
+// produces returns true if the permutation is one of those of IterAll with the given exclusions
+func (mx *Matrix) produces(permutation map[string]string, exclusions []*Matrix) bool {
+	if len(permutation) != len(*mx) || !isIn(mx, permutation) {
+		return false
+	}
+	for _, ex := range exclusions {
+		if isIn(ex, permutation) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches returns true if the permutation has one of the values of each of this matrix variables
+func (mx *Matrix) Matches(permutation map[string]string) bool {
+	return isIn(mx, permutation)
+}
+
 func isIn(needle *Matrix, haystack map[string]string) bool {
 	ammo := len(*needle)
 	for k, vs := range *needle {
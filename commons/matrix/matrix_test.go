@@ -163,3 +163,41 @@ func TestIter(t *testing.T) {
 	}
 
 }
+
+func TestIterIncluded(t *testing.T) {
+	mx := &Matrix{"lang": {"1.4"}, "a": {"42", "666"}, "b": {"bzk"}}
+
+	cap := newCapturer([]map[string]string{
+		{"lang": "1.4", "a": "1024", "b": "bzk"},
+		{"lang": "1.4", "a": "666", "b": "see"},
+		{"lang": "1.4", "a": "666", "b": "bzk"},
+		{"lang": "1.4", "b": "bzk", "c": "x"},
+		{"lang": "1.4", "b": "bzk", "c": "y"},
+	})
+	mx.IterIncluded(cap.iter(t), []*Matrix{
+		{"a": {"1024"}},
+		nil,
+		// already produced by the cartesian product
+		{"a": {"42"}},
+		{"a": {"666"}, "b": {"see"}},
+		// excluded from the cartesian product, hence included again
+		{"a": {"666"}},
+		{"c": {"x", "y"}},
+	}, []*Matrix{{"a": {"666"}}})
+	cap.check(t)
+
+	require.Contains(t, cap.captured, "i0000")
+	require.Contains(t, cap.captured, "i3000")
+	require.Contains(t, cap.captured, "i5000")
+	require.Contains(t, cap.captured, "i5010")
+}
+
+func TestMatches(t *testing.T) {
+	mx := &Matrix{"a": {"42", "666"}, "b": {"bzk"}}
+
+	require.True(t, mx.Matches(map[string]string{"a": "42", "b": "bzk"}))
+	require.True(t, mx.Matches(map[string]string{"a": "666", "b": "bzk", "c": "see"}))
+	require.False(t, mx.Matches(map[string]string{"a": "1024", "b": "bzk"}))
+	require.False(t, mx.Matches(map[string]string{"a": "42"}))
+	require.True(t, (&Matrix{}).Matches(map[string]string{"a": "42"}))
+}
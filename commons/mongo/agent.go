@@ -0,0 +1,90 @@
+package mongo
+
+import (
+	"fmt"
+	"time"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (c *MongoConnector) RegisterAgent(agent *lib.Agent) error {
+	now := time.Now()
+	selector := bson.M{
+		"name": agent.Name,
+	}
+	request := bson.M{
+		"$set": bson.M{
+			"docker_url": agent.DockerURL,
+			"labels":     agent.Labels,
+			"capacity":   agent.Capacity,
+			"last_seen":  now,
+		},
+		"$setOnInsert": bson.M{"registered": now, "leases": []lib.AgentLease{}},
+	}
+	if _, err := c.database.C("agents").Upsert(selector, request); err != nil {
+		return err
+	}
+	return c.database.C("agents").Find(selector).One(agent)
+}
+
+func (c *MongoConnector) GetAgents() ([]*lib.Agent, error) {
+	res := []*lib.Agent{}
+	err := c.database.C("agents").Find(bson.M{}).All(&res)
+	return res, err
+}
+
+func (c *MongoConnector) RemoveAgent(name string) error {
+	err := c.database.C("agents").Remove(bson.M{"name": name})
+	if err == mgo.ErrNotFound {
+		return &store.NotFoundError{Collection: "agents", Field: "name", Value: name}
+	}
+	return err
+}
+
+// AcquireAgentLease pushes the lease only if the agent has less leases than its capacity, which the update
+// selects along with the capacity read beforehand: a concurrent change of the capacity fails the acquisition
+func (c *MongoConnector) AcquireAgentLease(name string, lease *lib.AgentLease) (bool, error) {
+	agent := &lib.Agent{}
+	if err := c.database.C("agents").Find(bson.M{"name": name}).One(agent); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, &store.NotFoundError{Collection: "agents", Field: "name", Value: name}
+		}
+		return false, err
+	}
+	for _, held := range agent.Leases {
+		if held == *lease {
+			return true, nil
+		}
+	}
+	if len(agent.Leases) >= agent.Capacity {
+		return false, nil
+	}
+
+	selector := bson.M{
+		"name":     name,
+		"capacity": agent.Capacity,
+		fmt.Sprintf("leases.%d", agent.Capacity-1): bson.M{"$exists": false},
+	}
+	err := c.database.C("agents").Update(selector, bson.M{"$push": bson.M{"leases": lease}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *MongoConnector) ReleaseAgentLease(name string, lease *lib.AgentLease) error {
+	err := c.database.C("agents").Update(bson.M{"name": name}, bson.M{"$pull": bson.M{"leases": lease}})
+	if err == mgo.ErrNotFound {
+		return &store.NotFoundError{Collection: "agents", Field: "name", Value: name}
+	}
+	return err
+}
+
+func (c *MongoConnector) ReleaseJobAgentLeases(jobID string) error {
+	_, err := c.database.C("agents").UpdateAll(bson.M{"leases.job_id": jobID}, bson.M{"$pull": bson.M{"leases": bson.M{"job_id": jobID}}})
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/bazooka-ci/bazooka/commons/store"
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -21,26 +22,7 @@ type MongoConnector struct {
 	session  *mgo.Session
 }
 
-type NotFoundError struct {
-	Collection string
-	Field      string
-	Value      string
-}
-
-func (n *NotFoundError) Error() string {
-	return fmt.Sprintf("%s[%s:%s] not found", n.Collection, n.Field, n.Value)
-}
-
-type ManyFoundError struct {
-	Collection string
-	Field      string
-	Value      string
-	Count      int
-}
-
-func (m *ManyFoundError) Error() string {
-	return fmt.Sprintf("%s[%s:%s] returned %d results", m.Collection, m.Field, m.Value, m.Count)
-}
+var _ store.Store = (*MongoConnector)(nil)
 
 func NewConnector() *MongoConnector {
 	session, err := mgo.Dial(getMongoUrl())
@@ -88,12 +70,12 @@ func (m *MongoConnector) selectOneByField(collection, fieldName string, fieldVal
 	}
 	switch count {
 	case 0:
-		return &NotFoundError{collection, fieldName, fieldValue}
+		return &store.NotFoundError{Collection: collection, Field: fieldName, Value: fieldValue}
 	case 1:
 		return q.One(result)
 
 	default:
-		return &ManyFoundError{collection, fieldName, fieldValue, count}
+		return &store.ManyFoundError{Collection: collection, Field: fieldName, Value: fieldValue, Count: count}
 	}
 }
 
@@ -105,19 +87,19 @@ func (m *MongoConnector) selectOneByFieldLike(collection, fieldName string, fiel
 	}
 	switch count {
 	case 0:
-		return &NotFoundError{collection, fieldName, fieldValue}
+		return &store.NotFoundError{Collection: collection, Field: fieldName, Value: fieldValue}
 	case 1:
 		return q.One(result)
 
 	default:
-		return &ManyFoundError{collection, fieldName, fieldValue, count}
+		return &store.ManyFoundError{Collection: collection, Field: fieldName, Value: fieldValue, Count: count}
 	}
 }
 
 func (m *MongoConnector) selectOneByIdOrName(collection, id string, result interface{}) error {
 	err := m.selectOneByFieldLike(collection, "id", id, result)
 	switch err.(type) {
-	case *NotFoundError:
+	case *store.NotFoundError:
 		return m.selectOneByField(collection, "name", id, result)
 	default:
 		return err
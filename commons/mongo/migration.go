@@ -0,0 +1,130 @@
+package mongo
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// migration upgrades the database schema to its version
+type migration struct {
+	version     int
+	description string
+	apply       func(db *mgo.Database) error
+}
+
+// migrations must be sorted by version. Never modify an applied migration, append a new one instead
+var migrations = []migration{
+	{1, "create the indexes", createIndexes},
+	{2, "create the indexes of the agents and registries", createAgentsRegistriesIndexes},
+}
+
+const (
+	schemaCollection = "schema"
+	schemaVersionID  = "version"
+)
+
+type schemaVersion struct {
+	ID      string    `bson:"_id"`
+	Version int       `bson:"version"`
+	Applied time.Time `bson:"applied"`
+}
+
+// SchemaVersion returns the version of the last migration applied to the database, 0 if none was applied
+func (c *MongoConnector) SchemaVersion() (int, error) {
+	v := schemaVersion{}
+	err := c.database.C(schemaCollection).FindId(schemaVersionID).One(&v)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+	return v.Version, err
+}
+
+// Migrate applies, in order, the migrations more recent than the database schema version
+func (c *MongoConnector) Migrate() error {
+	current, err := c.SchemaVersion()
+	if err != nil {
+		return fmt.Errorf("Error while reading the schema version: %v", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		log.Infof("Migrating the database schema to version %d: %s", m.version, m.description)
+		if err := m.apply(c.database); err != nil {
+			return fmt.Errorf("Error while migrating the database schema to version %d (%s): %v", m.version, m.description, err)
+		}
+		_, err := c.database.C(schemaCollection).UpsertId(schemaVersionID, schemaVersion{
+			ID:      schemaVersionID,
+			Version: m.version,
+			Applied: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("Error while saving the schema version %d: %v", m.version, err)
+		}
+	}
+	return nil
+}
+
+func createIndexes(db *mgo.Database) error {
+	indexes := map[string][]mgo.Index{
+		"projects": {
+			{Key: []string{"id"}, Unique: true},
+			{Key: []string{"name"}, Unique: true},
+		},
+		"jobs": {
+			{Key: []string{"id"}, Unique: true},
+			{Key: []string{"project_id", "started"}},
+		},
+		"variants": {
+			{Key: []string{"id"}, Unique: true},
+			{Key: []string{"job_id"}},
+		},
+		"logs": {
+			{Key: []string{"id"}, Unique: true},
+			{Key: []string{"job_id", "time", "seq"}},
+			{Key: []string{"variant_id", "time", "seq"}},
+		},
+		"images": {
+			{Key: []string{"name"}, Unique: true},
+		},
+		"user": {
+			{Key: []string{"id"}, Unique: true},
+			{Key: []string{"email"}, Unique: true},
+		},
+		"keys": {
+			{Key: []string{"project_id"}, Unique: true},
+		},
+		"crypto": {
+			{Key: []string{"project_id"}, Unique: true},
+		},
+	}
+	return ensureIndexes(db, indexes)
+}
+
+// createAgentsRegistriesIndexes makes the registrations of the agents and the registry credentials unique,
+// as they are upserted by name and by project and registry
+func createAgentsRegistriesIndexes(db *mgo.Database) error {
+	return ensureIndexes(db, map[string][]mgo.Index{
+		"agents": {
+			{Key: []string{"name"}, Unique: true},
+		},
+		"registries": {
+			{Key: []string{"project_id", "registry"}, Unique: true},
+		},
+	})
+}
+
+func ensureIndexes(db *mgo.Database, indexes map[string][]mgo.Index) error {
+	for collection, collectionIndexes := range indexes {
+		for _, index := range collectionIndexes {
+			if err := db.C(collection).EnsureIndex(index); err != nil {
+				return fmt.Errorf("cannot create the index %v on %s: %v", index.Key, collection, err)
+			}
+		}
+	}
+	return nil
+}
@@ -2,12 +2,14 @@ package mongo
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
 	"gopkg.in/mgo.v2"
 
 	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -102,6 +104,12 @@ func (c *MongoConnector) AddProject(project *lib.Project) error {
 	return c.database.C("projects").Insert(project)
 }
 
+func (c *MongoConnector) RestoreProject(project *lib.Project) error {
+	restored := *project
+	restored.Config = escapeDotsInMap(project.Config)
+	return c.database.C("projects").Insert(&restored)
+}
+
 func (c *MongoConnector) SetProjectConfig(id string, config map[string]string) error {
 	proj, err := c.GetProjectById(id)
 	if err != nil {
@@ -154,6 +162,23 @@ func (c *MongoConnector) UnsetProjectConfigKey(id, key string) error {
 	return c.database.C("projects").Update(selector, request)
 }
 
+func (c *MongoConnector) DeleteProject(id string) error {
+	proj, err := c.GetProjectById(id)
+	if err != nil {
+		return err
+	}
+
+	selector := bson.M{
+		"project_id": proj.ID,
+	}
+	for _, collection := range []string{"logs", "variants", "jobs", "keys", "crypto", "registries"} {
+		if _, err := c.database.C(collection).RemoveAll(selector); err != nil {
+			return fmt.Errorf("Error while removing the project %s from %s: %v", proj.ID, collection, err)
+		}
+	}
+	return c.database.C("projects").Remove(bson.M{"id": proj.ID})
+}
+
 const (
 	escapedDot = "//"
 )
@@ -207,6 +232,16 @@ func (c *MongoConnector) AddJob(job *lib.Job) error {
 	return c.database.C("jobs").Insert(job)
 }
 
+func (c *MongoConnector) RestoreJob(job *lib.Job) error {
+	return c.database.C("jobs").Insert(job)
+}
+
+func (c *MongoConnector) RestoreVariant(variant *lib.Variant) error {
+	restored := *variant
+	restored.Metadata = escapeDotsInMap(variant.Metadata)
+	return c.database.C("variants").Insert(&restored)
+}
+
 func (c *MongoConnector) AddVariant(variant *lib.Variant) error {
 	var err error
 	if variant.ID, err = c.randomId(); err != nil {
@@ -219,22 +254,25 @@ func (c *MongoConnector) AddVariant(variant *lib.Variant) error {
 }
 
 func (c *MongoConnector) AddLog(log *lib.LogEntry) error {
-	var err error
-	if log.ID, err = c.randomId(); err != nil {
-		return err
-	}
+	log.ID = bson.NewObjectId().Hex()
 	return c.database.C("logs").Insert(log)
 }
 
-type LogExample struct {
-	ProjectID string
-	JobID     string
-	VariantID string
-	Images    []string
-	After     time.Time
+// AddLogs inserts a batch of log entries in a single round trip
+func (c *MongoConnector) AddLogs(logs []lib.LogEntry) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(logs))
+	for i := range logs {
+		// unlike randomId, generating an object id does not need to read from the system entropy source
+		logs[i].ID = bson.NewObjectId().Hex()
+		docs[i] = &logs[i]
+	}
+	return c.database.C("logs").Insert(docs...)
 }
 
-func (c *MongoConnector) GetLog(like *LogExample) ([]lib.LogEntry, error) {
+func (c *MongoConnector) GetLog(like *store.LogExample) ([]lib.LogEntry, error) {
 	result := []lib.LogEntry{}
 	request := bson.M{}
 	if len(like.ProjectID) > 0 {
@@ -272,7 +310,7 @@ func (c *MongoConnector) GetLog(like *LogExample) ([]lib.LogEntry, error) {
 		}
 	}
 
-	err := c.database.C("logs").Find(request).All(&result)
+	err := c.database.C("logs").Find(request).Sort("time", "seq").All(&result)
 	return result, err
 }
 
@@ -288,11 +326,12 @@ func (c *MongoConnector) SetJobOrchestrationId(id string, orchestrationId string
 	return err
 }
 
-func (c *MongoConnector) FinishJob(id string, status lib.JobStatus, completed time.Time) error {
+func (c *MongoConnector) FinishJob(id string, status lib.JobStatus, completed time.Time, failure *lib.Failure) error {
 	request := bson.M{
 		"$set": bson.M{
 			"status":    status,
 			"completed": completed,
+			"failure":   failure,
 		},
 	}
 	return c.database.C("jobs").Update(c.fieldStartsWith("id", id), request)
@@ -320,17 +359,56 @@ func (c *MongoConnector) AddJobSCMMetadata(id string, metadata *lib.SCMMetadata)
 	return c.database.C("jobs").Update(selector, request)
 }
 
-func (c *MongoConnector) FinishVariant(id string, status lib.JobStatus, completed time.Time, artifacts []string) error {
+func (c *MongoConnector) SetJobSecuredValues(id string, secured []string) error {
+	selector := bson.M{
+		"id": id,
+	}
+	request := bson.M{
+		"$set": bson.M{"secured_values": secured},
+	}
+	return c.database.C("jobs").Update(selector, request)
+}
+
+func (c *MongoConnector) FinishVariant(id string, status lib.JobStatus, completed time.Time, artifacts []string, failure *lib.Failure) error {
 	request := bson.M{
 		"$set": bson.M{
 			"status":    status,
 			"completed": completed,
-			"artifacts": artifacts,
+			"failure":   failure,
+		},
+	}
+	// keep the artifacts already registered by the build with an <ARTIFACT:...> marker
+	if len(artifacts) > 0 {
+		request["$addToSet"] = bson.M{
+			"artifacts": bson.M{"$each": artifacts},
+		}
+	}
+	return c.database.C("variants").Update(c.fieldStartsWith("id", id), request)
+}
+
+func (c *MongoConnector) SetVariantMetadata(id, name, value string) error {
+	request := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("metadata.%s", escapeDots(name)): value,
 		},
 	}
 	return c.database.C("variants").Update(c.fieldStartsWith("id", id), request)
 }
 
+func (c *MongoConnector) AddVariantArtifact(id, artifact string) error {
+	request := bson.M{
+		"$addToSet": bson.M{"artifacts": artifact},
+	}
+	return c.database.C("variants").Update(c.fieldStartsWith("id", id), request)
+}
+
+func (c *MongoConnector) AppendVariantSummary(id, summary string) error {
+	request := bson.M{
+		"$push": bson.M{"summary": summary},
+	}
+	return c.database.C("variants").Update(c.fieldStartsWith("id", id), request)
+}
+
 func (c *MongoConnector) GetJobByID(id string) (*lib.Job, error) {
 	result := &lib.Job{}
 	if err := c.selectOneByFieldLike("jobs", "id", id, result); err != nil {
@@ -344,6 +422,7 @@ func (c *MongoConnector) GetVariantByID(id string) (*lib.Variant, error) {
 	if err := c.selectOneByFieldLike("variants", "id", id, result); err != nil {
 		return nil, err
 	}
+	result.Metadata = unescapeDotsInMap(result.Metadata)
 	return result, nil
 }
 
@@ -366,6 +445,122 @@ func (c *MongoConnector) GetAllJobs() ([]*lib.Job, error) {
 	return result, err
 }
 
+func (c *MongoConnector) FindJobs(query *lib.JobQuery) ([]*lib.Job, int, error) {
+	selector := bson.M{}
+	if len(query.ProjectID) > 0 {
+		proj, err := c.GetProjectById(query.ProjectID)
+		if err != nil {
+			return nil, 0, err
+		}
+		selector["project_id"] = proj.ID
+	}
+	if len(query.Status) > 0 {
+		selector["status"] = query.Status
+	}
+	if len(query.Reference) > 0 {
+		selector["scm_metadata.reference"] = query.Reference
+	}
+	if len(query.Author) > 0 {
+		author := bson.M{"$regex": regexp.QuoteMeta(query.Author), "$options": "i"}
+		selector["$or"] = []bson.M{
+			{"scm_metadata.author.name": author},
+			{"scm_metadata.author.email": author},
+		}
+	}
+	started := bson.M{}
+	if !query.From.IsZero() {
+		started["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		started["$lt"] = query.To
+	}
+	if len(started) > 0 {
+		selector["started"] = started
+	}
+
+	q := c.database.C("jobs").Find(selector)
+	total, err := q.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	order := "-started"
+	if query.Ascending {
+		order = "started"
+	}
+	q = q.Sort(order).Skip(query.Offset)
+	if query.Limit > 0 {
+		q = q.Limit(query.Limit)
+	}
+	result := []*lib.Job{}
+	err = q.All(&result)
+	return result, total, err
+}
+
+// GetJobsWithHotLogs returns the finished jobs whose logs were not archived yet
+func (c *MongoConnector) GetJobsWithHotLogs() ([]*lib.Job, error) {
+	result := []*lib.Job{}
+	err := c.database.C("jobs").Find(bson.M{
+		"status":      bson.M{"$ne": lib.JOB_RUNNING},
+		"log_archive": bson.M{"$exists": false},
+	}).All(&result)
+	return result, err
+}
+
+func (c *MongoConnector) SetJobLogArchive(id string, archive string) error {
+	selector := bson.M{
+		"id": id,
+	}
+	request := bson.M{
+		"$set": bson.M{"log_archive": archive},
+	}
+	return c.database.C("jobs").Update(selector, request)
+}
+
+func (c *MongoConnector) SetJobPinned(id string, pinned bool) error {
+	selector := bson.M{
+		"id": id,
+	}
+	request := bson.M{
+		"$set": bson.M{"pinned": pinned},
+	}
+	return c.database.C("jobs").Update(selector, request)
+}
+
+func (c *MongoConnector) SetJobStages(id string, stages []*lib.JobStage) error {
+	selector := bson.M{
+		"id": id,
+	}
+	request := bson.M{
+		"$set": bson.M{"stages": stages},
+	}
+	err := c.database.C("jobs").Update(selector, request)
+	if err == mgo.ErrNotFound {
+		return &store.NotFoundError{Collection: "jobs", Field: "id", Value: id}
+	}
+	return err
+}
+
+const removeLogsBatchSize = 1000
+
+// RemoveLogs deletes the given log entries of a job from the logs collection
+func (c *MongoConnector) RemoveLogs(jobID string, ids []string) error {
+	for start := 0; start < len(ids); start += removeLogsBatchSize {
+		end := start + removeLogsBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		_, err := c.database.C("logs").RemoveAll(bson.M{
+			"job_id": jobID,
+			"id":     bson.M{"$in": ids[start:end]},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *MongoConnector) GetVariants(jobID string) ([]*lib.Variant, error) {
 	job, err := c.GetJobByID(jobID)
 	if err != nil {
@@ -377,5 +572,8 @@ func (c *MongoConnector) GetVariants(jobID string) ([]*lib.Variant, error) {
 	err = c.database.C("variants").Find(bson.M{
 		"job_id": job.ID,
 	}).All(&result)
+	for _, variant := range result {
+		variant.Metadata = unescapeDotsInMap(variant.Metadata)
+	}
 	return result, err
 }
@@ -0,0 +1,35 @@
+package mongo
+
+import (
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (c *MongoConnector) SetRegistryCredential(credential *lib.RegistryCredential) error {
+	selector := bson.M{
+		"project_id": credential.ProjectID,
+		"registry":   credential.Registry,
+	}
+	_, err := c.database.C("registries").Upsert(selector, credential)
+	return err
+}
+
+func (c *MongoConnector) GetRegistryCredentials(projectID string) (lib.RegistryCredentials, error) {
+	res := lib.RegistryCredentials{}
+	err := c.database.C("registries").Find(bson.M{"project_id": projectID}).All(&res)
+	return res, err
+}
+
+func (c *MongoConnector) RemoveRegistryCredential(projectID, registry string) error {
+	err := c.database.C("registries").Remove(bson.M{
+		"project_id": projectID,
+		"registry":   registry,
+	})
+	if err == mgo.ErrNotFound {
+		return &store.NotFoundError{Collection: "registries", Field: "registry", Value: registry}
+	}
+	return err
+}
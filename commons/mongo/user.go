@@ -37,6 +37,12 @@ func (c *MongoConnector) GetUsers() ([]*lib.User, error) {
 	return result, err
 }
 
+func (c *MongoConnector) GetUsersWithPasswords() ([]*lib.User, error) {
+	result := []*lib.User{}
+	err := c.database.C("user").Find(bson.M{}).All(&result)
+	return result, err
+}
+
 func (c *MongoConnector) AddUser(user *lib.User) error {
 	var err error
 	if user.ID, err = c.randomId(); err != nil {
@@ -69,3 +75,7 @@ func (c *MongoConnector) ComparePassword(email string, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(password))
 	return err == nil
 }
+
+func (c *MongoConnector) RestoreUser(user *lib.User) error {
+	return c.database.C("user").Insert(user)
+}
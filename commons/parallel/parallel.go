@@ -1,12 +1,18 @@
 package parallel
 
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
 type Task func() error
 type TaskCallback func(interface{}, error)
 
 type Parallel struct {
-	taskChan  chan taskCompletion
-	tasks     []taskWrapper
-	remaining int
+	ctx   context.Context
+	limit int
+	tasks []taskWrapper
 }
 
 type taskWrapper struct {
@@ -19,11 +25,39 @@ type taskCompletion struct {
 	err error
 }
 
+// TaskError is the error returned by the task submitted with Tag
+type TaskError struct {
+	Tag interface{}
+	Err error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Tag, e.Err)
+}
+
+// Errors aggregates the errors of the failed tasks, in completion order
+type Errors []*TaskError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d task(s) failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// New returns a Parallel running all the submitted tasks at once
 func New() *Parallel {
+	return NewWithContext(context.Background(), 0)
+}
+
+// NewWithContext returns a Parallel running at most limit tasks at once, or all of them if limit is 0.
+// Once ctx is done, the tasks which were not started yet are skipped, their callback getting ctx.Err()
+func NewWithContext(ctx context.Context, limit int) *Parallel {
 	return &Parallel{
-		make(chan taskCompletion),
-		[]taskWrapper{},
-		0,
+		ctx:   ctx,
+		limit: limit,
+		tasks: []taskWrapper{},
 	}
 }
 
@@ -31,30 +65,52 @@ func (p *Parallel) Submit(task Task, tag interface{}) {
 	p.tasks = append(p.tasks, taskWrapper{task, tag})
 }
 
-func (p *Parallel) Exec(callback TaskCallback) {
-	p.remaining = len(p.tasks)
-	if p.remaining == 0 {
-		return
+// Exec runs the submitted tasks, in submission order, and calls callback as each of them completes.
+// It returns once all the tasks completed, with an Errors if any of them failed or was skipped
+func (p *Parallel) Exec(callback TaskCallback) error {
+	if len(p.tasks) == 0 {
+		return nil
 	}
-	for _, w := range p.tasks {
-		wrapper := w
-		go func() {
-			if err := wrapper.task(); err != nil {
-				p.taskChan <- taskCompletion{wrapper.tag, err}
-				return
-			}
-			p.taskChan <- taskCompletion{wrapper.tag, nil}
 
-		}()
+	completions := make(chan taskCompletion)
+	var slots chan struct{}
+	if p.limit > 0 {
+		slots = make(chan struct{}, p.limit)
 	}
 
-	for {
-		c := <-p.taskChan
+	go func() {
+		for _, w := range p.tasks {
+			wrapper := w
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+				case <-p.ctx.Done():
+				}
+			}
+			if err := p.ctx.Err(); err != nil {
+				completions <- taskCompletion{wrapper.tag, err}
+				continue
+			}
+			go func() {
+				err := wrapper.task()
+				if slots != nil {
+					<-slots
+				}
+				completions <- taskCompletion{wrapper.tag, err}
+			}()
+		}
+	}()
+
+	var errs Errors
+	for remaining := len(p.tasks); remaining > 0; remaining-- {
+		c := <-completions
 		callback(c.tag, c.err)
-		p.remaining--
-		if p.remaining == 0 {
-			close(p.taskChan)
-			return
+		if c.err != nil {
+			errs = append(errs, &TaskError{c.tag, c.err})
 		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
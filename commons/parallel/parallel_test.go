@@ -1,7 +1,9 @@
 package parallel
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -51,3 +53,65 @@ func TestExec(t *testing.T) {
 	}
 
 }
+
+func TestExecLimit(t *testing.T) {
+	par := NewWithContext(context.Background(), 2)
+
+	var running, maxRunning int32
+	for i := 0; i < 6; i++ {
+		par.Submit(func() error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		}, i)
+	}
+
+	completed := 0
+	err := par.Exec(func(tag interface{}, err error) {
+		completed++
+	})
+	require.NoError(t, err)
+	require.Equal(t, 6, completed)
+	require.Equal(t, int32(2), maxRunning, "At most 2 tasks should run at once")
+}
+
+func TestExecCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	par := NewWithContext(ctx, 1)
+
+	par.Submit(func() error {
+		cancel()
+		return nil
+	}, "first")
+	par.Submit(func() error {
+		t.Fatal("A task submitted after the cancellation should not run")
+		return nil
+	}, "second")
+
+	errs := map[interface{}]error{}
+	err := par.Exec(func(tag interface{}, err error) {
+		errs[tag] = err
+	})
+	require.NoError(t, errs["first"])
+	require.Equal(t, context.Canceled, errs["second"])
+	require.Equal(t, Errors{{"second", context.Canceled}}, err)
+}
+
+func TestExecErrors(t *testing.T) {
+	par := New()
+	par.Submit(func() error { return nil }, "ok")
+	par.Submit(func() error { return fmt.Errorf("oh snap") }, "ko")
+
+	err := par.Exec(func(tag interface{}, err error) {})
+	require.Error(t, err)
+	require.Equal(t, "1 task(s) failed: ko: oh snap", err.Error())
+
+	require.NoError(t, New().Exec(func(tag interface{}, err error) {}))
+}
@@ -1,6 +1,9 @@
 package bazooka
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type Project struct {
 	ScmType    string            `bson:"scm_type" json:"scm_type" validate:"required"`
@@ -26,6 +29,42 @@ const (
 	JOB_RUNNING           = "RUNNING"
 )
 
+// FailureCategory is the step of a job or of a variant which made it fail or error
+type FailureCategory string
+
+const (
+	FAILURE_SCM_FETCH   FailureCategory = "scm_fetch"
+	FAILURE_PARSE       FailureCategory = "parse"
+	FAILURE_AGENT       FailureCategory = "agent"
+	FAILURE_IMAGE_BUILD FailureCategory = "image_build"
+	FAILURE_SERVICE     FailureCategory = "service"
+	FAILURE_SETUP_PHASE FailureCategory = "setup_phase"
+	FAILURE_SCRIPT      FailureCategory = "script"
+	FAILURE_TIMEOUT     FailureCategory = "timeout"
+	FAILURE_CANCELLED   FailureCategory = "cancelled"
+	// the errors of the orchestration itself, or of the Docker daemon
+	FAILURE_INTERNAL FailureCategory = "internal"
+)
+
+// FailureReasonFile is the file of their output folder in which the SCM fetch and parser containers write the error
+// making them exit, which becomes the failure reason of the job
+const FailureReasonFile = "error"
+
+// Failure explains why a job or a variant did not succeed. The Category is the one of the most specific error,
+// like a timeout, and Step the one of the step it happened at, like the start of a service, when they differ
+type Failure struct {
+	Category FailureCategory `bson:"category" json:"category"`
+	Step     FailureCategory `bson:"step,omitempty" json:"step,omitempty"`
+	Reason   string          `bson:"reason" json:"reason"`
+}
+
+func (f *Failure) String() string {
+	if len(f.Step) > 0 {
+		return fmt.Sprintf("%s (%s): %s", f.Category, f.Step, f.Reason)
+	}
+	return fmt.Sprintf("%s: %s", f.Category, f.Reason)
+}
+
 type Job struct {
 	ID              string      `bson:"id" json:"id"`
 	Number          int         `bson:"number" json:"number"`
@@ -36,19 +75,39 @@ type Job struct {
 	Status          JobStatus   `bson:"status" json:"status"`
 	SCMMetadata     SCMMetadata `bson:"scm_metadata" json:"scm_metadata"`
 	Parameters      []string    `bson:"parameters" json:"parameters"`
+	SecuredValues   []string    `bson:"secured_values,omitempty" json:"-"`
+	LogArchive      string      `bson:"log_archive,omitempty" json:"-"`
+	Pinned          bool        `bson:"pinned,omitempty" json:"pinned,omitempty"`
+	Stages          []*JobStage `bson:"stages,omitempty" json:"stages,omitempty"`
+	Failure         *Failure    `bson:"failure,omitempty" json:"failure,omitempty"`
+}
+
+// JobStage is the status of a stage of the pipeline of a job, a stage which was not run having no status
+type JobStage struct {
+	Name      string    `bson:"name" json:"name"`
+	Status    JobStatus `bson:"status,omitempty" json:"status,omitempty"`
+	Started   time.Time `bson:"started,omitempty" json:"started,omitempty"`
+	Completed time.Time `bson:"completed,omitempty" json:"completed,omitempty"`
 }
 
 type Variant struct {
-	Status     JobStatus     `bson:"status" json:"status"`
-	Started    time.Time     `bson:"started" json:"started"`
-	Completed  time.Time     `bson:"completed" json:"completed"`
-	BuildImage string        `bson:"image" json:"image"`
-	ProjectID  string        `bson:"project_id" json:"project_id"`
-	JobID      string        `bson:"job_id" json:"job_id"`
-	Number     int           `bson:"number" json:"number"`
-	ID         string        `bson:"id" json:"id"`
-	Metas      *VariantMetas `bson:"metas" json:"metas"`
-	Artifacts  []string      `bson:"artifacts" json:"artifacts"`
+	Status       JobStatus         `bson:"status" json:"status"`
+	Started      time.Time         `bson:"started" json:"started"`
+	Completed    time.Time         `bson:"completed" json:"completed"`
+	BuildImage   string            `bson:"image" json:"image"`
+	ProjectID    string            `bson:"project_id" json:"project_id"`
+	JobID        string            `bson:"job_id" json:"job_id"`
+	Number       int               `bson:"number" json:"number"`
+	ID           string            `bson:"id" json:"id"`
+	Metas        *VariantMetas     `bson:"metas" json:"metas"`
+	Artifacts    []string          `bson:"artifacts" json:"artifacts"`
+	Metadata     map[string]string `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	Summary      []string          `bson:"summary,omitempty" json:"summary,omitempty"`
+	AllowFailure bool              `bson:"allow_failure,omitempty" json:"allow_failure,omitempty"`
+	Stage        string            `bson:"stage,omitempty" json:"stage,omitempty"`
+	Deploy       bool              `bson:"deploy,omitempty" json:"deploy,omitempty"`
+	Failure      *Failure          `bson:"failure,omitempty" json:"failure,omitempty"`
+	Agent        string            `bson:"agent,omitempty" json:"agent,omitempty"`
 }
 
 type VariantMetas []*VariantMeta
@@ -69,19 +128,28 @@ const (
 type StartJob struct {
 	ScmReference string   `json:"reference"`
 	Parameters   []string `json:"parameters"`
+	Tag          bool     `json:"tag,omitempty"`
 }
 
 type LogEntry struct {
-	ID        string    `bson:"id" json:"id"`
-	Message   string    `bson:"msg" json:"msg"`
-	Time      time.Time `bson:"time" json:"time"`
-	Level     string    `bson:"level" json:"level"`
-	Phase     string    `bson:"phase" json:"phase"`
-	Command   string    `bson:"command" json:"command"`
-	ProjectID string    `bson:"project_id" json:"project_id"`
-	JobID     string    `bson:"job_id" json:"job_id"`
-	VariantID string    `bson:"variant_id" json:"variant_id"`
-	Image     string    `bson:"image" json:"image"`
+	ID         string    `bson:"id" json:"id"`
+	Seq        int64     `bson:"seq" json:"seq"`
+	Message    string    `bson:"msg" json:"msg"`
+	Time       time.Time `bson:"time" json:"time"`
+	Level      string    `bson:"level" json:"level"`
+	Phase      string    `bson:"phase" json:"phase"`
+	Command    string    `bson:"command" json:"command"`
+	ProjectID  string    `bson:"project_id" json:"project_id"`
+	JobID      string    `bson:"job_id" json:"job_id"`
+	VariantID  string    `bson:"variant_id" json:"variant_id"`
+	Image      string    `bson:"image" json:"image"`
+	CommandEnd bool      `bson:"command_end,omitempty" json:"command_end,omitempty"`
+	PhaseEnd   bool      `bson:"phase_end,omitempty" json:"phase_end,omitempty"`
+	ExitCode   int       `bson:"exit_code,omitempty" json:"exit_code,omitempty"`
+	MetaName   string    `bson:"meta_name,omitempty" json:"meta_name,omitempty"`
+	MetaValue  string    `bson:"meta_value,omitempty" json:"meta_value,omitempty"`
+	Artifact   string    `bson:"artifact,omitempty" json:"artifact,omitempty"`
+	Summary    string    `bson:"summary,omitempty" json:"summary,omitempty"`
 }
 
 type SCMMetadata struct {
@@ -94,10 +162,39 @@ type SCMMetadata struct {
 	Message   string   `bson:"message" json:"message" yaml:"message"`
 }
 
+// LogArchiveReport is the outcome of archiving the logs of the finished jobs
+type LogArchiveReport struct {
+	Archived []string          `json:"archived"`
+	Failed   map[string]string `json:"failed,omitempty"`
+}
+
+// GCReport lists the jobs whose build folder and variant images were, or would be in a dry run, removed
+type GCReport struct {
+	DryRun bool     `json:"dry_run"`
+	Jobs   []*GCJob `json:"jobs"`
+	// Freed is the size, in bytes, of the removed build folders
+	Freed  int64             `json:"freed"`
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+type GCJob struct {
+	ProjectID string   `json:"project_id"`
+	JobID     string   `json:"job_id"`
+	Number    int      `json:"number"`
+	Images    []string `json:"images,omitempty"`
+	Size      int64    `json:"size"`
+}
+
+// SecuredValues lists the hex encoded 'secure: <string>' entries of a job configuration
+type SecuredValues struct {
+	Values []string `json:"values"`
+}
+
 type FinishData struct {
 	Status    JobStatus `json:"status"`
 	Time      time.Time `json:"time,omitempty"`
 	Artifacts []string  `json:"artifacts,omitempty"`
+	Failure   *Failure  `json:"failure,omitempty"`
 }
 
 func (ms *VariantMetas) Append(m *VariantMeta) { *ms = append(*ms, m) }
@@ -0,0 +1,147 @@
+package bazooka
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// DockerHub is the registry of the images whose name doesn't start with a registry host
+	DockerHub = "docker.io"
+	// the address of the Docker Hub in the authentication configurations
+	dockerHubAuthAddress = "https://index.docker.io/v1/"
+)
+
+// RegistryCredential authenticates the pulls from a Docker registry, for the jobs of a project,
+// or of all the projects when ProjectID is empty. The password is stored encrypted, and never returned by the API
+type RegistryCredential struct {
+	ProjectID string `bson:"project_id" json:"project_id,omitempty"`
+	Registry  string `bson:"registry" json:"registry"`
+	Username  string `bson:"username" json:"username"`
+	Password  string `bson:"password" json:"password,omitempty"`
+	Email     string `bson:"email" json:"email,omitempty"`
+}
+
+type RegistryCredentials []*RegistryCredential
+
+// NormalizeRegistry returns the host of a registry, without scheme nor path, the Docker Hub aliases being docker.io
+func NormalizeRegistry(registry string) string {
+	registry = strings.ToLower(strings.TrimSpace(registry))
+	if i := strings.Index(registry, "://"); i >= 0 {
+		registry = registry[i+3:]
+	}
+	registry = strings.SplitN(registry, "/", 2)[0]
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return DockerHub
+	}
+	return registry
+}
+
+// ImageRegistry returns the registry of an image: the first component of its name if it is a host, the Docker Hub otherwise
+func ImageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return NormalizeRegistry(parts[0])
+	}
+	return DockerHub
+}
+
+// splitImageTag splits an image name into its repository and its tag or digest, latest by default
+func splitImageTag(image string) (string, string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// MergeRegistryCredentials returns the global credentials along with those of a project, which replace the global ones of the same registry
+func MergeRegistryCredentials(global, project RegistryCredentials) RegistryCredentials {
+	res := RegistryCredentials{}
+	overridden := map[string]bool{}
+	for _, c := range project {
+		overridden[c.Registry] = true
+		res = append(res, c)
+	}
+	for _, c := range global {
+		if !overridden[c.Registry] {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// For returns the credential of the registry of an image, nil if there is none
+func (c RegistryCredentials) For(image string) *RegistryCredential {
+	registry := ImageRegistry(image)
+	for _, credential := range c {
+		if credential.Registry == registry {
+			return credential
+		}
+	}
+	return nil
+}
+
+func (c *RegistryCredential) AuthConfiguration() dockerclient.AuthConfiguration {
+	address := c.Registry
+	if address == DockerHub {
+		address = dockerHubAuthAddress
+	}
+	return dockerclient.AuthConfiguration{
+		Username:      c.Username,
+		Password:      c.Password,
+		Email:         c.Email,
+		ServerAddress: address,
+	}
+}
+
+// AuthConfigurations returns the credentials of all the registries, to pull the base images of a docker build
+func (c RegistryCredentials) AuthConfigurations() dockerclient.AuthConfigurations {
+	res := dockerclient.AuthConfigurations{Configs: map[string]dockerclient.AuthConfiguration{}}
+	for _, credential := range c {
+		auth := credential.AuthConfiguration()
+		res.Configs[auth.ServerAddress] = auth
+	}
+	return res
+}
+
+// PullImage pulls an image with the credential of its registry.
+// The images of the registries without credential are left to the Docker daemon, which pulls them anonymously when missing
+func (c RegistryCredentials) PullImage(api *dockerclient.Client, image string) error {
+	credential := c.For(image)
+	if credential == nil {
+		return nil
+	}
+	repository, tag := splitImageTag(image)
+	return api.PullImage(dockerclient.PullImageOptions{
+		Repository: repository,
+		Tag:        tag,
+	}, credential.AuthConfiguration())
+}
+
+// ReadRegistryCredentials reads the credentials of the registries written by the server for a job
+func ReadRegistryCredentials(file string) (RegistryCredentials, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var res RegistryCredentials
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func WriteRegistryCredentials(file string, credentials RegistryCredentials) error {
+	b, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0600)
+}
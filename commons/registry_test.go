@@ -0,0 +1,67 @@
+package bazooka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageRegistry(t *testing.T) {
+	assert.Equal(t, DockerHub, ImageRegistry("golang:1.4"))
+	assert.Equal(t, DockerHub, ImageRegistry("bazooka/parser-java"))
+	assert.Equal(t, "registry.example.com", ImageRegistry("registry.example.com/base/java:8"))
+	assert.Equal(t, "registry.example.com:5000", ImageRegistry("registry.example.com:5000/java"))
+	assert.Equal(t, "localhost", ImageRegistry("localhost/java"))
+}
+
+func TestNormalizeRegistry(t *testing.T) {
+	assert.Equal(t, "registry.example.com:5000", NormalizeRegistry(" https://Registry.example.com:5000/v2/ "))
+	assert.Equal(t, DockerHub, NormalizeRegistry("https://index.docker.io/v1/"))
+}
+
+func TestSplitImageTag(t *testing.T) {
+	repository, tag := splitImageTag("registry.example.com:5000/java")
+	assert.Equal(t, "registry.example.com:5000/java", repository)
+	assert.Equal(t, "latest", tag)
+
+	repository, tag = splitImageTag("registry.example.com:5000/java:8")
+	assert.Equal(t, "registry.example.com:5000/java", repository)
+	assert.Equal(t, "8", tag)
+
+	repository, tag = splitImageTag("java@sha256:abcd")
+	assert.Equal(t, "java", repository)
+	assert.Equal(t, "sha256:abcd", tag)
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	global := RegistryCredentials{
+		{Registry: DockerHub, Username: "global"},
+		{Registry: "registry.example.com", Username: "global"},
+	}
+	project := RegistryCredentials{
+		{ProjectID: "p", Registry: "registry.example.com", Username: "project"},
+	}
+	credentials := MergeRegistryCredentials(global, project)
+	require.Len(t, credentials, 2)
+
+	assert.Equal(t, "project", credentials.For("registry.example.com/base/java").Username)
+	assert.Equal(t, "global", credentials.For("golang").Username)
+	assert.Nil(t, credentials.For("registry.internal:5000/golang"))
+
+	configs := credentials.AuthConfigurations().Configs
+	assert.Equal(t, "global", configs[dockerHubAuthAddress].Username)
+	assert.Equal(t, "project", configs["registry.example.com"].Username)
+
+	dir, err := ioutil.TempDir("", "bzk-registries")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "registries")
+	require.NoError(t, WriteRegistryCredentials(file, credentials))
+	read, err := ReadRegistryCredentials(file)
+	require.NoError(t, err)
+	assert.Equal(t, credentials, read)
+}
@@ -0,0 +1,105 @@
+package bazooka
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Resources limit the build and service containers of a variant, a zero value meaning no limit
+type Resources struct {
+	// Memory is the amount of memory, without any swap
+	Memory Size `yaml:"memory,omitempty"`
+	// CPUs is the number of CPUs, possibly fractional
+	CPUs float64 `yaml:"cpus,omitempty"`
+	// Pids is the maximum number of processes
+	Pids int64 `yaml:"pids,omitempty"`
+}
+
+// IsZero tells if no resource is limited
+func (r *Resources) IsZero() bool {
+	return r == nil || (r.Memory == 0 && r.CPUs == 0 && r.Pids == 0)
+}
+
+// Cap returns the resources of r capped by max, the resources not limited by r being limited to those of max
+func (r *Resources) Cap(max *Resources) *Resources {
+	res := &Resources{}
+	if r != nil {
+		*res = *r
+	}
+	if max == nil {
+		return res
+	}
+	if max.Memory > 0 && (res.Memory == 0 || res.Memory > max.Memory) {
+		res.Memory = max.Memory
+	}
+	if max.CPUs > 0 && (res.CPUs == 0 || res.CPUs > max.CPUs) {
+		res.CPUs = max.CPUs
+	}
+	if max.Pids > 0 && (res.Pids == 0 || res.Pids > max.Pids) {
+		res.Pids = max.Pids
+	}
+	return res
+}
+
+// ParseResources parses the memory size, the number of CPUs and the number of processes of some resources, empty ones being unlimited
+func ParseResources(memory, cpus, pids string) (*Resources, error) {
+	res := &Resources{}
+	var err error
+	if len(memory) > 0 {
+		if res.Memory, err = ParseSize(memory); err != nil {
+			return nil, err
+		}
+	}
+	if len(cpus) > 0 {
+		if res.CPUs, err = strconv.ParseFloat(cpus, 64); err != nil || res.CPUs < 0 {
+			return nil, fmt.Errorf("Invalid number of CPUs %q", cpus)
+		}
+	}
+	if len(pids) > 0 {
+		if res.Pids, err = strconv.ParseInt(pids, 10, 64); err != nil || res.Pids < 0 {
+			return nil, fmt.Errorf("Invalid number of processes %q", pids)
+		}
+	}
+	return res, nil
+}
+
+// Size is a number of bytes, written as a number optionally followed by a b, k, m or g unit (e.g. 512m)
+type Size int64
+
+var sizeUnits = map[string]int64{
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+}
+
+// ParseSize parses a size with an optional unit
+func ParseSize(s string) (Size, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	unit := int64(1)
+	if len(value) > 0 {
+		if u, ok := sizeUnits[value[len(value)-1:]]; ok {
+			unit = u
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid size %q: expected a positive number optionally followed by b, k, m or g", s)
+	}
+	return Size(n * unit), nil
+}
+
+func (s *Size) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	size, err := ParseSize(raw)
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
@@ -0,0 +1,75 @@
+package bazooka
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]Size{
+		"1024": 1024,
+		"10b":  10,
+		"2k":   2048,
+		"512m": 512 << 20,
+		"2G":   2 << 30,
+	}
+	for s, expected := range cases {
+		size, err := ParseSize(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, size, s)
+	}
+
+	for _, s := range []string{"", "m", "-1g", "1.5g", "12t"} {
+		_, err := ParseSize(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestResourcesYAML(t *testing.T) {
+	conf := &Config{}
+	require.NoError(t, Parse("fixtures/config/resources/.bazooka.yml", conf))
+	assert.Equal(t, &Resources{Memory: 512 << 20, CPUs: 1.5, Pids: 256}, conf.Resources)
+
+	// the sizes are flushed as numbers of bytes
+	f, err := ioutil.TempFile("", "bzk-resources")
+	require.NoError(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	require.NoError(t, Flush(conf.Resources, f.Name()))
+	flushed := &Resources{}
+	require.NoError(t, Parse(f.Name(), flushed))
+	assert.Equal(t, conf.Resources, flushed)
+}
+
+func TestParseResources(t *testing.T) {
+	res, err := ParseResources("1g", "0.5", "")
+	require.NoError(t, err)
+	assert.Equal(t, &Resources{Memory: 1 << 30, CPUs: 0.5}, res)
+
+	res, err = ParseResources("", "", "")
+	require.NoError(t, err)
+	assert.True(t, res.IsZero())
+
+	_, err = ParseResources("", "many", "")
+	assert.Error(t, err)
+	_, err = ParseResources("", "", "-1")
+	assert.Error(t, err)
+}
+
+func TestResourcesCap(t *testing.T) {
+	max := &Resources{Memory: 1 << 30, CPUs: 2}
+
+	assert.Equal(t, max, (*Resources)(nil).Cap(max))
+	assert.Equal(t, &Resources{Memory: 512 << 20, CPUs: 2, Pids: 100},
+		(&Resources{Memory: 512 << 20, CPUs: 4, Pids: 100}).Cap(max))
+	assert.Equal(t, &Resources{CPUs: 4}, (&Resources{CPUs: 4}).Cap(nil))
+
+	assert.True(t, (*Resources)(nil).IsZero())
+	assert.True(t, (&Resources{}).IsZero())
+	assert.False(t, max.IsZero())
+}
@@ -0,0 +1,50 @@
+package bazooka
+
+import (
+	"sort"
+	"time"
+)
+
+// RetentionPolicy tells which jobs of a project keep their build folder and variant images.
+// A job is kept if any of the set rules keeps it, running and pinned jobs are always kept
+type RetentionPolicy struct {
+	// KeepJobs is the number of most recent jobs kept
+	KeepJobs int
+	// KeepFor is how long the jobs are kept after their completion
+	KeepFor time.Duration
+}
+
+// Enabled tells if the policy collects any job
+func (p *RetentionPolicy) Enabled() bool {
+	return p.KeepJobs > 0 || p.KeepFor > 0
+}
+
+// Collectable returns, the oldest first, the jobs of a project which are not kept by the policy
+func (p *RetentionPolicy) Collectable(jobs []*Job, now time.Time) []*Job {
+	if !p.Enabled() {
+		return nil
+	}
+
+	sorted := make([]*Job, len(jobs))
+	copy(sorted, jobs)
+	sort.Sort(jobsByNumber(sorted))
+
+	res := []*Job{}
+	for i, job := range sorted {
+		recent := len(sorted) - i
+		switch {
+		case job.Status == JOB_RUNNING, job.Pinned:
+		case p.KeepJobs > 0 && recent <= p.KeepJobs:
+		case p.KeepFor > 0 && now.Sub(job.Completed) < p.KeepFor:
+		default:
+			res = append(res, job)
+		}
+	}
+	return res
+}
+
+type jobsByNumber []*Job
+
+func (j jobsByNumber) Len() int           { return len(j) }
+func (j jobsByNumber) Swap(a, b int)      { j[a], j[b] = j[b], j[a] }
+func (j jobsByNumber) Less(a, b int) bool { return j[a].Number < j[b].Number }
@@ -0,0 +1,38 @@
+package bazooka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2015, 6, 7, 16, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	jobs := []*Job{
+		{Number: 5, Status: JOB_RUNNING},
+		{Number: 1, Status: JOB_SUCCESS, Completed: now.Add(-10 * day)},
+		{Number: 2, Status: JOB_FAILED, Completed: now.Add(-9 * day), Pinned: true},
+		{Number: 3, Status: JOB_SUCCESS, Completed: now.Add(-8 * day)},
+		{Number: 4, Status: JOB_SUCCESS, Completed: now.Add(-1 * day)},
+	}
+	numbers := func(jobs []*Job) []int {
+		res := []int{}
+		for _, job := range jobs {
+			res = append(res, job.Number)
+		}
+		return res
+	}
+
+	assert.Empty(t, (&RetentionPolicy{}).Collectable(jobs, now))
+
+	assert.Equal(t, []int{1, 3}, numbers((&RetentionPolicy{KeepJobs: 2}).Collectable(jobs, now)))
+	assert.Equal(t, []int{1, 3}, numbers((&RetentionPolicy{KeepFor: 7 * day}).Collectable(jobs, now)))
+	assert.Equal(t, []int{1}, numbers((&RetentionPolicy{KeepJobs: 3, KeepFor: 7 * day}).Collectable(jobs, now)))
+	assert.Equal(t, []int{1, 3, 4}, numbers((&RetentionPolicy{KeepJobs: 1}).Collectable(jobs, now)))
+
+	// the jobs are not reordered
+	assert.Equal(t, 5, jobs[0].Number)
+}
@@ -0,0 +1,81 @@
+package bazooka
+
+import "time"
+
+// VariantStep is either a build phase (before_install, install, script...) or one of its commands
+type VariantStep struct {
+	Phase    string         `json:"phase"`
+	Command  string         `json:"command,omitempty"`
+	Started  time.Time      `json:"started"`
+	Duration time.Duration  `json:"duration"`
+	ExitCode *int           `json:"exit_code,omitempty"`
+	Commands []*VariantStep `json:"commands,omitempty"`
+}
+
+func (s *VariantStep) finish(at time.Time, exitCode *int) {
+	s.Duration = at.Sub(s.Started)
+	s.ExitCode = exitCode
+}
+
+// BuildSteps reconstructs the phases and commands of a variant from its log entries,
+// using the <PHASE:...>, <CMD:...>, <CMD_END:...> and <PHASE_END:...> markers emitted by the build scripts.
+// Steps which were not terminated (e.g. the variant is still running) have no exit code
+// and a duration computed up to the last log entry
+func BuildSteps(logs []LogEntry) []*VariantStep {
+	var (
+		steps   = []*VariantStep{}
+		phase   *VariantStep
+		command *VariantStep
+		last    time.Time
+	)
+
+	for _, l := range logs {
+		last = l.Time
+		switch {
+		case len(l.Phase) > 0:
+			if command != nil {
+				command.finish(l.Time, nil)
+				command = nil
+			}
+			if phase != nil {
+				phase.finish(l.Time, nil)
+			}
+			phase = &VariantStep{Phase: l.Phase, Started: l.Time}
+			steps = append(steps, phase)
+		case len(l.Command) > 0:
+			if phase == nil {
+				continue
+			}
+			if command != nil {
+				command.finish(l.Time, nil)
+			}
+			command = &VariantStep{Phase: phase.Phase, Command: l.Command, Started: l.Time}
+			phase.Commands = append(phase.Commands, command)
+		case l.CommandEnd:
+			if command != nil {
+				exitCode := l.ExitCode
+				command.finish(l.Time, &exitCode)
+				command = nil
+			}
+		case l.PhaseEnd:
+			exitCode := l.ExitCode
+			// a command without an end marker was interrupted by the phase exiting on error
+			if command != nil {
+				command.finish(l.Time, &exitCode)
+				command = nil
+			}
+			if phase != nil {
+				phase.finish(l.Time, &exitCode)
+				phase = nil
+			}
+		}
+	}
+
+	if command != nil {
+		command.Duration = last.Sub(command.Started)
+	}
+	if phase != nil {
+		phase.Duration = last.Sub(phase.Started)
+	}
+	return steps
+}
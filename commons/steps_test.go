@@ -0,0 +1,64 @@
+package bazooka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSteps(t *testing.T) {
+	t0 := time.Date(2015, 6, 7, 16, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time {
+		return t0.Add(time.Duration(s) * time.Second)
+	}
+	lines := []struct {
+		at  int
+		msg string
+	}{
+		{0, "<PHASE:install>"},
+		{0, "<CMD:npm install>"},
+		{1, "fetching things"},
+		{480, "<CMD_END:0>"},
+		{480, "<PHASE_END:0>"},
+		{480, "<PHASE:script>"},
+		{481, "<CMD:npm test>"},
+		{600, "<PHASE_END:3>"},
+		{600, "<PHASE:after_failure>"},
+		{601, "<CMD:echo ko>"},
+	}
+
+	logs := []LogEntry{}
+	for _, l := range lines {
+		logs = append(logs, ConstructLog(l.msg, LogEntry{Time: at(l.at)}))
+	}
+
+	steps := BuildSteps(logs)
+	require.Len(t, steps, 3)
+
+	install := steps[0]
+	assert.Equal(t, "install", install.Phase)
+	assert.Equal(t, at(0), install.Started)
+	assert.Equal(t, 480*time.Second, install.Duration)
+	require.NotNil(t, install.ExitCode)
+	assert.Equal(t, 0, *install.ExitCode)
+	require.Len(t, install.Commands, 1)
+	assert.Equal(t, "npm install", install.Commands[0].Command)
+	assert.Equal(t, 480*time.Second, install.Commands[0].Duration)
+
+	script := steps[1]
+	assert.Equal(t, "script", script.Phase)
+	require.NotNil(t, script.ExitCode)
+	assert.Equal(t, 3, *script.ExitCode)
+	require.Len(t, script.Commands, 1)
+	require.NotNil(t, script.Commands[0].ExitCode, "A command interrupted by its phase end should get the phase exit code")
+	assert.Equal(t, 3, *script.Commands[0].ExitCode)
+	assert.Equal(t, 119*time.Second, script.Commands[0].Duration)
+
+	running := steps[2]
+	assert.Nil(t, running.ExitCode, "A phase without an end marker should have no exit code")
+	assert.Equal(t, time.Second, running.Duration)
+	require.Len(t, running.Commands, 1)
+	assert.Nil(t, running.Commands[0].ExitCode)
+}
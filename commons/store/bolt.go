@@ -0,0 +1,89 @@
+package store
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// NewBoltStore opens, or creates, a store persisted in a single BoltDB file.
+// Only one process can open the file at a time
+func NewBoltStore(path string) (Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &docStore{
+		backend: &boltBackend{db},
+	}, nil
+}
+
+// boltBackend stores every collection in its own bucket
+type boltBackend struct {
+	db *bolt.DB
+}
+
+func (b *boltBackend) View(fn func(Tx) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+func (b *boltBackend) Update(fn func(Tx) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+func (b *boltBackend) Close() error {
+	return b.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t *boltTx) Get(collection, key string) ([]byte, error) {
+	bucket := t.tx.Bucket([]byte(collection))
+	if bucket == nil {
+		return nil, nil
+	}
+	value := bucket.Get([]byte(key))
+	if value == nil {
+		return nil, nil
+	}
+	// the value is only valid during the transaction
+	return append([]byte{}, value...), nil
+}
+
+func (t *boltTx) Put(collection, key string, value []byte) error {
+	bucket, err := t.tx.CreateBucketIfNotExists([]byte(collection))
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), value)
+}
+
+func (t *boltTx) Delete(collection, key string) error {
+	bucket := t.tx.Bucket([]byte(collection))
+	if bucket == nil {
+		return nil
+	}
+	return bucket.Delete([]byte(key))
+}
+
+func (t *boltTx) ForEach(collection, prefix string, fn func(key string, value []byte) error) error {
+	bucket := t.tx.Bucket([]byte(collection))
+	if bucket == nil {
+		return nil
+	}
+	p := []byte(prefix)
+	c := bucket.Cursor()
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if err := fn(string(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
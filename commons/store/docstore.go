@@ -0,0 +1,1118 @@
+package store
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2/bson"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+)
+
+// Backend holds collections of documents, each document being stored under a key.
+// The documents of a collection are iterated in key order
+type Backend interface {
+	// View runs fn in a read-only transaction
+	View(fn func(Tx) error) error
+	// Update runs fn in a read-write transaction, committed only if fn returns no error
+	Update(fn func(Tx) error) error
+	Close() error
+}
+
+type Tx interface {
+	// Get returns nil if the collection holds no document with this key
+	Get(collection, key string) ([]byte, error)
+	Put(collection, key string, value []byte) error
+	Delete(collection, key string) error
+	// ForEach calls fn, in key order, for every document of the collection whose key starts with prefix
+	ForEach(collection, prefix string, fn func(key string, value []byte) error) error
+}
+
+const (
+	projectsCollection = "projects"
+	jobsCollection     = "jobs"
+	variantsCollection = "variants"
+	logsCollection     = "logs"
+	imagesCollection   = "images"
+	usersCollection    = "user"
+	keysCollection     = "keys"
+	cryptoCollection   = "crypto"
+	agentsCollection   = "agents"
+	registryCollection = "registries"
+
+	// log keys sort the entries of a job by time, then by sequence number
+	logKeyPattern = "%s/%s/%020d/%s" // $jobId/$time/$seq/$logId
+	logTimeFormat = "20060102150405.000000000"
+)
+
+// docStore implements Store on top of a Backend, every document being bson encoded.
+// Projects, jobs and variants are stored by id, images and agents by name, users by email, keys by project id
+// and registry credentials by project id and registry
+type docStore struct {
+	backend Backend
+}
+
+var errStop = errors.New("stop iterating")
+
+func getDoc(tx Tx, collection, key string, doc interface{}) (bool, error) {
+	raw, err := tx.Get(collection, key)
+	if err != nil || raw == nil {
+		return false, err
+	}
+	return true, bson.Unmarshal(raw, doc)
+}
+
+func putDoc(tx Tx, collection, key string, doc interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return tx.Put(collection, key, raw)
+}
+
+// forEachDoc decodes in a new document, returned by newDoc, every document of the collection whose key starts with prefix.
+// Returning errStop from fn ends the iteration without error
+func forEachDoc(tx Tx, collection, prefix string, newDoc func() interface{}, fn func(doc interface{}) error) error {
+	err := tx.ForEach(collection, prefix, func(_ string, value []byte) error {
+		doc := newDoc()
+		if err := bson.Unmarshal(value, doc); err != nil {
+			return err
+		}
+		return fn(doc)
+	})
+	if err == errStop {
+		return nil
+	}
+	return err
+}
+
+// byIDPrefix finds the single document of a collection keyed by id whose id starts with prefix
+func byIDPrefix(tx Tx, collection, prefix string, doc interface{}) error {
+	var (
+		found []byte
+		count int
+	)
+	err := tx.ForEach(collection, strings.ToLower(prefix), func(_ string, value []byte) error {
+		found = value
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	switch count {
+	case 0:
+		return &NotFoundError{collection, "id", prefix}
+	case 1:
+		return bson.Unmarshal(found, doc)
+	default:
+		return &ManyFoundError{collection, "id", prefix, count}
+	}
+}
+
+func randomId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x%x%x%x%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func (s *docStore) Close() {
+	s.backend.Close()
+}
+
+// projects
+
+func getProject(tx Tx, id string) (*lib.Project, error) {
+	result := &lib.Project{}
+	err := byIDPrefix(tx, projectsCollection, id, result)
+	if _, notFound := err.(*NotFoundError); !notFound {
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	count := 0
+	err = forEachDoc(tx, projectsCollection, "", func() interface{} { return &lib.Project{} }, func(doc interface{}) error {
+		if p := doc.(*lib.Project); p.Name == id {
+			result = p
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch count {
+	case 0:
+		return nil, &NotFoundError{projectsCollection, "name", id}
+	case 1:
+		return result, nil
+	default:
+		return nil, &ManyFoundError{projectsCollection, "name", id, count}
+	}
+}
+
+func allProjects(tx Tx) ([]*lib.Project, error) {
+	result := []*lib.Project{}
+	err := forEachDoc(tx, projectsCollection, "", func() interface{} { return &lib.Project{} }, func(doc interface{}) error {
+		result = append(result, doc.(*lib.Project))
+		return nil
+	})
+	return result, err
+}
+
+func (s *docStore) HasProject(name string) (bool, error) {
+	found := false
+	err := s.backend.View(func(tx Tx) error {
+		return forEachDoc(tx, projectsCollection, "", func() interface{} { return &lib.Project{} }, func(doc interface{}) error {
+			if len(name) == 0 || doc.(*lib.Project).Name == name {
+				found = true
+				return errStop
+			}
+			return nil
+		})
+	})
+	return found, err
+}
+
+func (s *docStore) GetProjectById(id string) (*lib.Project, error) {
+	var result *lib.Project
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		result, err = getProject(tx, id)
+		return err
+	})
+	return result, err
+}
+
+func (s *docStore) GetProjects() ([]*lib.Project, error) {
+	var result []*lib.Project
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		result, err = allProjects(tx)
+		return err
+	})
+	return result, err
+}
+
+func (s *docStore) GetProjectsWithStatus() ([]*lib.ProjectWithStatus, error) {
+	result := []*lib.ProjectWithStatus{}
+	err := s.backend.View(func(tx Tx) error {
+		projects, err := allProjects(tx)
+		if err != nil {
+			return err
+		}
+		lastJobs, err := allJobs(tx, nil)
+		if err != nil {
+			return err
+		}
+
+		indexed := map[string]*lib.Job{}
+		for _, job := range lastJobs {
+			if last, found := indexed[job.ProjectID]; !found || job.Started.After(last.Started) {
+				indexed[job.ProjectID] = job
+			}
+		}
+
+		for _, project := range projects {
+			result = append(result, &lib.ProjectWithStatus{
+				Project: project,
+				LastJob: indexed[project.ID],
+			})
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (s *docStore) AddProject(project *lib.Project) error {
+	var err error
+	if project.ID, err = randomId(); err != nil {
+		return err
+	}
+
+	if project.HookKey, err = randomId(); err != nil {
+		return err
+	}
+
+	return s.backend.Update(func(tx Tx) error {
+		return putDoc(tx, projectsCollection, project.ID, project)
+	})
+}
+
+func (s *docStore) RestoreProject(project *lib.Project) error {
+	return s.backend.Update(func(tx Tx) error {
+		return putDoc(tx, projectsCollection, project.ID, project)
+	})
+}
+
+func (s *docStore) updateProject(id string, update func(*lib.Project)) error {
+	return s.backend.Update(func(tx Tx) error {
+		project, err := getProject(tx, id)
+		if err != nil {
+			return err
+		}
+		update(project)
+		return putDoc(tx, projectsCollection, project.ID, project)
+	})
+}
+
+func (s *docStore) SetProjectConfig(id string, config map[string]string) error {
+	return s.updateProject(id, func(project *lib.Project) {
+		project.Config = config
+	})
+}
+
+func (s *docStore) SetProjectConfigKey(id, key, value string) error {
+	return s.updateProject(id, func(project *lib.Project) {
+		if project.Config == nil {
+			project.Config = map[string]string{}
+		}
+		project.Config[key] = value
+	})
+}
+
+func (s *docStore) UnsetProjectConfigKey(id, key string) error {
+	return s.updateProject(id, func(project *lib.Project) {
+		delete(project.Config, key)
+	})
+}
+
+func (s *docStore) DeleteProject(id string) error {
+	return s.backend.Update(func(tx Tx) error {
+		project, err := getProject(tx, id)
+		if err != nil {
+			return err
+		}
+
+		jobs, err := allJobs(tx, func(job *lib.Job) bool {
+			return job.ProjectID == project.ID
+		})
+		if err != nil {
+			return err
+		}
+
+		keys := map[string][]string{
+			projectsCollection: {project.ID},
+			keysCollection:     {project.ID},
+			cryptoCollection:   {project.ID},
+		}
+		err = tx.ForEach(registryCollection, registryKey(project.ID, ""), func(key string, _ []byte) error {
+			keys[registryCollection] = append(keys[registryCollection], key)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			keys[jobsCollection] = append(keys[jobsCollection], job.ID)
+			err := tx.ForEach(logsCollection, job.ID+"/", func(key string, _ []byte) error {
+				keys[logsCollection] = append(keys[logsCollection], key)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err = forEachDoc(tx, variantsCollection, "", func() interface{} { return &lib.Variant{} }, func(doc interface{}) error {
+			if variant := doc.(*lib.Variant); variant.ProjectID == project.ID {
+				keys[variantsCollection] = append(keys[variantsCollection], variant.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for collection, collectionKeys := range keys {
+			for _, key := range collectionKeys {
+				if err := tx.Delete(collection, key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// jobs
+
+func allJobs(tx Tx, keep func(*lib.Job) bool) ([]*lib.Job, error) {
+	result := []*lib.Job{}
+	err := forEachDoc(tx, jobsCollection, "", func() interface{} { return &lib.Job{} }, func(doc interface{}) error {
+		if job := doc.(*lib.Job); keep == nil || keep(job) {
+			result = append(result, job)
+		}
+		return nil
+	})
+	sort.Sort(jobsByStart(result))
+	return result, err
+}
+
+type jobsByStart []*lib.Job
+
+func (j jobsByStart) Len() int           { return len(j) }
+func (j jobsByStart) Swap(a, b int)      { j[a], j[b] = j[b], j[a] }
+func (j jobsByStart) Less(a, b int) bool { return j[a].Started.Before(j[b].Started) }
+
+func (s *docStore) AddJob(job *lib.Job) error {
+	var err error
+	if job.ID, err = randomId(); err != nil {
+		return err
+	}
+
+	if len(job.Status) == 0 {
+		job.Status = lib.JOB_RUNNING
+	}
+
+	return s.backend.Update(func(tx Tx) error {
+		project := &lib.Project{}
+		found, err := getDoc(tx, projectsCollection, job.ProjectID, project)
+		if err != nil {
+			return fmt.Errorf("Error generating the job number: %v", err)
+		}
+		if !found {
+			return fmt.Errorf("Error generating the job number: %v", ErrNotFound)
+		}
+		project.JobCounter++
+		if err := putDoc(tx, projectsCollection, project.ID, project); err != nil {
+			return err
+		}
+		job.Number = project.JobCounter
+
+		return putDoc(tx, jobsCollection, job.ID, job)
+	})
+}
+
+func (s *docStore) GetJobByID(id string) (*lib.Job, error) {
+	result := &lib.Job{}
+	err := s.backend.View(func(tx Tx) error {
+		return byIDPrefix(tx, jobsCollection, id, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *docStore) GetJobs(projectID string) ([]*lib.Job, error) {
+	var result []*lib.Job
+	err := s.backend.View(func(tx Tx) error {
+		project, err := getProject(tx, projectID)
+		if err != nil {
+			return err
+		}
+		result, err = allJobs(tx, func(job *lib.Job) bool {
+			return job.ProjectID == project.ID
+		})
+		return err
+	})
+	return result, err
+}
+
+func (s *docStore) GetAllJobs() ([]*lib.Job, error) {
+	var result []*lib.Job
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		result, err = allJobs(tx, nil)
+		return err
+	})
+	return result, err
+}
+
+func (s *docStore) FindJobs(query *lib.JobQuery) ([]*lib.Job, int, error) {
+	var result []*lib.Job
+	err := s.backend.View(func(tx Tx) error {
+		q := *query
+		if len(q.ProjectID) > 0 {
+			project, err := getProject(tx, q.ProjectID)
+			if err != nil {
+				return err
+			}
+			q.ProjectID = project.ID
+		}
+		var err error
+		result, err = allJobs(tx, q.Match)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(result)
+	if !query.Ascending {
+		sort.Sort(sort.Reverse(jobsByStart(result)))
+	}
+	if query.Offset >= total {
+		return []*lib.Job{}, total, nil
+	}
+	result = result[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(result) {
+		result = result[:query.Limit]
+	}
+	return result, total, nil
+}
+
+func (s *docStore) GetJobsWithHotLogs() ([]*lib.Job, error) {
+	var result []*lib.Job
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		result, err = allJobs(tx, func(job *lib.Job) bool {
+			return job.Status != lib.JOB_RUNNING && len(job.LogArchive) == 0
+		})
+		return err
+	})
+	return result, err
+}
+
+func (s *docStore) RestoreJob(job *lib.Job) error {
+	return s.backend.Update(func(tx Tx) error {
+		return putDoc(tx, jobsCollection, job.ID, job)
+	})
+}
+
+func (s *docStore) updateJob(id string, update func(*lib.Job)) error {
+	return s.backend.Update(func(tx Tx) error {
+		job := &lib.Job{}
+		if err := byIDPrefix(tx, jobsCollection, id, job); err != nil {
+			return err
+		}
+		update(job)
+		return putDoc(tx, jobsCollection, job.ID, job)
+	})
+}
+
+func (s *docStore) SetJobOrchestrationId(id string, orchestrationId string) error {
+	return s.updateJob(id, func(job *lib.Job) {
+		job.OrchestrationID = orchestrationId
+	})
+}
+
+func (s *docStore) AddJobSCMMetadata(id string, metadata *lib.SCMMetadata) error {
+	return s.updateJob(id, func(job *lib.Job) {
+		// Do not override SCMMetadata reference if present in database
+		if len(job.SCMMetadata.Reference) > 0 {
+			metadata.Reference = job.SCMMetadata.Reference
+		}
+		job.SCMMetadata = *metadata
+	})
+}
+
+func (s *docStore) SetJobSecuredValues(id string, secured []string) error {
+	return s.updateJob(id, func(job *lib.Job) {
+		job.SecuredValues = secured
+	})
+}
+
+func (s *docStore) SetJobLogArchive(id string, archive string) error {
+	return s.updateJob(id, func(job *lib.Job) {
+		job.LogArchive = archive
+	})
+}
+
+func (s *docStore) SetJobPinned(id string, pinned bool) error {
+	return s.updateJob(id, func(job *lib.Job) {
+		job.Pinned = pinned
+	})
+}
+
+func (s *docStore) SetJobStages(id string, stages []*lib.JobStage) error {
+	return s.updateJob(id, func(job *lib.Job) {
+		job.Stages = stages
+	})
+}
+
+func (s *docStore) FinishJob(id string, status lib.JobStatus, completed time.Time, failure *lib.Failure) error {
+	return s.updateJob(id, func(job *lib.Job) {
+		job.Status = status
+		job.Completed = completed
+		job.Failure = failure
+	})
+}
+
+// variants
+
+func (s *docStore) AddVariant(variant *lib.Variant) error {
+	var err error
+	if variant.ID, err = randomId(); err != nil {
+		return err
+	}
+	if len(variant.Status) == 0 {
+		variant.Status = lib.JOB_RUNNING
+	}
+	return s.backend.Update(func(tx Tx) error {
+		return putDoc(tx, variantsCollection, variant.ID, variant)
+	})
+}
+
+func (s *docStore) GetVariantByID(id string) (*lib.Variant, error) {
+	result := &lib.Variant{}
+	err := s.backend.View(func(tx Tx) error {
+		return byIDPrefix(tx, variantsCollection, id, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *docStore) GetVariants(jobID string) ([]*lib.Variant, error) {
+	result := []*lib.Variant{}
+	err := s.backend.View(func(tx Tx) error {
+		job := &lib.Job{}
+		if err := byIDPrefix(tx, jobsCollection, jobID, job); err != nil {
+			return err
+		}
+		return forEachDoc(tx, variantsCollection, "", func() interface{} { return &lib.Variant{} }, func(doc interface{}) error {
+			if variant := doc.(*lib.Variant); variant.JobID == job.ID {
+				result = append(result, variant)
+			}
+			return nil
+		})
+	})
+	sort.Sort(variantsByNumber(result))
+	return result, err
+}
+
+type variantsByNumber []*lib.Variant
+
+func (v variantsByNumber) Len() int           { return len(v) }
+func (v variantsByNumber) Swap(a, b int)      { v[a], v[b] = v[b], v[a] }
+func (v variantsByNumber) Less(a, b int) bool { return v[a].Number < v[b].Number }
+
+func (s *docStore) RestoreVariant(variant *lib.Variant) error {
+	return s.backend.Update(func(tx Tx) error {
+		return putDoc(tx, variantsCollection, variant.ID, variant)
+	})
+}
+
+func (s *docStore) updateVariant(id string, update func(*lib.Variant)) error {
+	return s.backend.Update(func(tx Tx) error {
+		variant := &lib.Variant{}
+		if err := byIDPrefix(tx, variantsCollection, id, variant); err != nil {
+			return err
+		}
+		update(variant)
+		return putDoc(tx, variantsCollection, variant.ID, variant)
+	})
+}
+
+func addToSet(set []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range set {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			set = append(set, value)
+		}
+	}
+	return set
+}
+
+func (s *docStore) FinishVariant(id string, status lib.JobStatus, completed time.Time, artifacts []string, failure *lib.Failure) error {
+	return s.updateVariant(id, func(variant *lib.Variant) {
+		variant.Status = status
+		variant.Completed = completed
+		variant.Failure = failure
+		// keep the artifacts already registered by the build with an <ARTIFACT:...> marker
+		variant.Artifacts = addToSet(variant.Artifacts, artifacts...)
+	})
+}
+
+func (s *docStore) SetVariantMetadata(id, name, value string) error {
+	return s.updateVariant(id, func(variant *lib.Variant) {
+		if variant.Metadata == nil {
+			variant.Metadata = map[string]string{}
+		}
+		variant.Metadata[name] = value
+	})
+}
+
+func (s *docStore) AddVariantArtifact(id, artifact string) error {
+	return s.updateVariant(id, func(variant *lib.Variant) {
+		variant.Artifacts = addToSet(variant.Artifacts, artifact)
+	})
+}
+
+func (s *docStore) AppendVariantSummary(id, summary string) error {
+	return s.updateVariant(id, func(variant *lib.Variant) {
+		variant.Summary = append(variant.Summary, summary)
+	})
+}
+
+// logs
+
+func logKey(log *lib.LogEntry) string {
+	return fmt.Sprintf(logKeyPattern, log.JobID, log.Time.UTC().Format(logTimeFormat), log.Seq, log.ID)
+}
+
+func (s *docStore) AddLog(log *lib.LogEntry) error {
+	log.ID = bson.NewObjectId().Hex()
+	return s.backend.Update(func(tx Tx) error {
+		return putDoc(tx, logsCollection, logKey(log), log)
+	})
+}
+
+func (s *docStore) AddLogs(logs []lib.LogEntry) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return s.backend.Update(func(tx Tx) error {
+		for i := range logs {
+			logs[i].ID = bson.NewObjectId().Hex()
+			if err := putDoc(tx, logsCollection, logKey(&logs[i]), &logs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *docStore) GetLog(like *LogExample) ([]lib.LogEntry, error) {
+	result := []lib.LogEntry{}
+	err := s.backend.View(func(tx Tx) error {
+		resolved := *like
+		prefix := ""
+		if len(like.ProjectID) > 0 {
+			project, err := getProject(tx, like.ProjectID)
+			if err != nil {
+				return err
+			}
+			resolved.ProjectID = project.ID
+		}
+		if len(like.JobID) > 0 {
+			job := &lib.Job{}
+			if err := byIDPrefix(tx, jobsCollection, like.JobID, job); err != nil {
+				return err
+			}
+			resolved.JobID = job.ID
+			prefix = job.ID + "/"
+		}
+		if len(like.VariantID) > 0 {
+			variant := &lib.Variant{}
+			if err := byIDPrefix(tx, variantsCollection, like.VariantID, variant); err != nil {
+				return err
+			}
+			resolved.VariantID = variant.ID
+			if len(prefix) == 0 {
+				prefix = variant.JobID + "/"
+			}
+		}
+
+		return forEachDoc(tx, logsCollection, prefix, func() interface{} { return &lib.LogEntry{} }, func(doc interface{}) error {
+			if log := doc.(*lib.LogEntry); resolved.Match(log) {
+				result = append(result, *log)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (s *docStore) RemoveLogs(jobID string, ids []string) error {
+	removed := map[string]struct{}{}
+	for _, id := range ids {
+		removed[id] = struct{}{}
+	}
+
+	return s.backend.Update(func(tx Tx) error {
+		keys := []string{}
+		err := tx.ForEach(logsCollection, jobID+"/", func(key string, _ []byte) error {
+			if _, found := removed[key[strings.LastIndex(key, "/")+1:]]; found {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := tx.Delete(logsCollection, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// images
+
+func (s *docStore) HasImage(name string) (bool, error) {
+	found := false
+	err := s.backend.View(func(tx Tx) error {
+		raw, err := tx.Get(imagesCollection, name)
+		found = raw != nil
+		return err
+	})
+	return found, err
+}
+
+func (s *docStore) GetImage(name string) (*lib.Image, error) {
+	im := lib.Image{}
+	err := s.backend.View(func(tx Tx) error {
+		found, err := getDoc(tx, imagesCollection, name, &im)
+		if err == nil && !found {
+			return ErrNotFound
+		}
+		return err
+	})
+	return &im, err
+}
+
+func (s *docStore) SetImage(name, image string) error {
+	return s.backend.Update(func(tx Tx) error {
+		im := &lib.Image{Name: name}
+		if _, err := getDoc(tx, imagesCollection, name, im); err != nil {
+			return err
+		}
+		im.Image = image
+		return putDoc(tx, imagesCollection, name, im)
+	})
+}
+
+func (s *docStore) GetImages() ([]*lib.Image, error) {
+	res := []*lib.Image{}
+	err := s.backend.View(func(tx Tx) error {
+		return forEachDoc(tx, imagesCollection, "", func() interface{} { return &lib.Image{} }, func(doc interface{}) error {
+			res = append(res, doc.(*lib.Image))
+			return nil
+		})
+	})
+	return res, err
+}
+
+// users
+
+func (s *docStore) GetUserByEmail(email string) (*lib.User, error) {
+	result := &lib.User{}
+	err := s.backend.View(func(tx Tx) error {
+		found, err := getDoc(tx, usersCollection, email, result)
+		if err == nil && !found {
+			return &NotFoundError{usersCollection, "email", email}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Password = ""
+	return result, nil
+}
+
+func (s *docStore) HasUser(email string) (bool, error) {
+	found := false
+	err := s.backend.View(func(tx Tx) error {
+		raw, err := tx.Get(usersCollection, email)
+		found = raw != nil
+		return err
+	})
+	return found, err
+}
+
+func (s *docStore) GetUsers() ([]*lib.User, error) {
+	result := []*lib.User{}
+	err := s.backend.View(func(tx Tx) error {
+		return forEachDoc(tx, usersCollection, "", func() interface{} { return &lib.User{} }, func(doc interface{}) error {
+			user := doc.(*lib.User)
+			user.Password = ""
+			result = append(result, user)
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (s *docStore) GetUsersWithPasswords() ([]*lib.User, error) {
+	result := []*lib.User{}
+	err := s.backend.View(func(tx Tx) error {
+		return forEachDoc(tx, usersCollection, "", func() interface{} { return &lib.User{} }, func(doc interface{}) error {
+			result = append(result, doc.(*lib.User))
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (s *docStore) AddUser(user *lib.User) error {
+	var err error
+	if user.ID, err = randomId(); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 2) // TODO define a smart value
+	if err != nil {
+		return err
+	}
+
+	user.Password = string(hashedPassword)
+	err = s.backend.Update(func(tx Tx) error {
+		return putDoc(tx, usersCollection, user.Email, user)
+	})
+	user.Password = ""
+	return err
+}
+
+func (s *docStore) ComparePassword(email string, password string) bool {
+	result := &lib.User{}
+	found := false
+	err := s.backend.View(func(tx Tx) error {
+		var err error
+		found, err = getDoc(tx, usersCollection, email, result)
+		return err
+	})
+	if err != nil || !found {
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(password)) == nil
+}
+
+func (s *docStore) RestoreUser(user *lib.User) error {
+	return s.backend.Update(func(tx Tx) error {
+		return putDoc(tx, usersCollection, user.Email, user)
+	})
+}
+
+// keys
+
+func (s *docStore) GetProjectKey(projectID string) (*lib.SSHKey, error) {
+	result := &lib.SSHKey{}
+	err := s.backend.View(func(tx Tx) error {
+		project, err := getProject(tx, projectID)
+		if err != nil {
+			return err
+		}
+		found, err := getDoc(tx, keysCollection, project.ID, result)
+		if err == nil && !found {
+			return &NotFoundError{keysCollection, "project_id", project.ID}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *docStore) SetProjectKey(projectID string, key *lib.SSHKey) error {
+	return s.backend.Update(func(tx Tx) error {
+		project, err := getProject(tx, projectID)
+		if err != nil {
+			return err
+		}
+		return putDoc(tx, keysCollection, project.ID, key)
+	})
+}
+
+func (s *docStore) GetProjectCryptoKey(projectID string) (*lib.CryptoKey, error) {
+	result := &lib.CryptoKey{}
+	err := s.backend.View(func(tx Tx) error {
+		found, err := getDoc(tx, cryptoCollection, projectID, result)
+		if err == nil && !found {
+			return &NotFoundError{cryptoCollection, "project_id", projectID}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *docStore) AddCryptoKey(key *lib.CryptoKey) error {
+	return s.backend.Update(func(tx Tx) error {
+		existing := &lib.CryptoKey{}
+		found, err := getDoc(tx, cryptoCollection, key.ProjectID, existing)
+		if err != nil {
+			return err
+		}
+		if found {
+			key.ID = existing.ID
+		} else if key.ID, err = randomId(); err != nil {
+			return err
+		}
+		return putDoc(tx, cryptoCollection, key.ProjectID, key)
+	})
+}
+
+func (s *docStore) GetCryptoKeys(projectID string) ([]*lib.CryptoKey, error) {
+	result := []*lib.CryptoKey{}
+	err := s.backend.View(func(tx Tx) error {
+		project, err := getProject(tx, projectID)
+		if err != nil {
+			return err
+		}
+		key := &lib.CryptoKey{}
+		found, err := getDoc(tx, cryptoCollection, project.ID, key)
+		if found {
+			result = append(result, key)
+		}
+		return err
+	})
+	return result, err
+}
+
+// agents
+
+func (s *docStore) RegisterAgent(agent *lib.Agent) error {
+	return s.backend.Update(func(tx Tx) error {
+		existing := &lib.Agent{}
+		found, err := getDoc(tx, agentsCollection, agent.Name, existing)
+		if err != nil {
+			return err
+		}
+		agent.LastSeen = time.Now()
+		if found {
+			agent.Registered = existing.Registered
+			agent.Leases = existing.Leases
+		} else {
+			agent.Leases = nil
+			agent.Registered = agent.LastSeen
+		}
+		return putDoc(tx, agentsCollection, agent.Name, agent)
+	})
+}
+
+func (s *docStore) GetAgents() ([]*lib.Agent, error) {
+	res := []*lib.Agent{}
+	err := s.backend.View(func(tx Tx) error {
+		return forEachDoc(tx, agentsCollection, "", func() interface{} { return &lib.Agent{} }, func(doc interface{}) error {
+			res = append(res, doc.(*lib.Agent))
+			return nil
+		})
+	})
+	return res, err
+}
+
+func (s *docStore) RemoveAgent(name string) error {
+	return s.backend.Update(func(tx Tx) error {
+		raw, err := tx.Get(agentsCollection, name)
+		if err != nil {
+			return err
+		}
+		if raw == nil {
+			return &NotFoundError{agentsCollection, "name", name}
+		}
+		return tx.Delete(agentsCollection, name)
+	})
+}
+
+func (s *docStore) AcquireAgentLease(name string, lease *lib.AgentLease) (bool, error) {
+	acquired := false
+	err := s.backend.Update(func(tx Tx) error {
+		agent := &lib.Agent{}
+		found, err := getDoc(tx, agentsCollection, name, agent)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return &NotFoundError{agentsCollection, "name", name}
+		}
+		for _, held := range agent.Leases {
+			if held == *lease {
+				acquired = true
+				return nil
+			}
+		}
+		if len(agent.Leases) >= agent.Capacity {
+			return nil
+		}
+		agent.Leases = append(agent.Leases, *lease)
+		acquired = true
+		return putDoc(tx, agentsCollection, name, agent)
+	})
+	return acquired, err
+}
+
+func (s *docStore) ReleaseAgentLease(name string, lease *lib.AgentLease) error {
+	return s.releaseAgentLeases(func(agent *lib.Agent, held lib.AgentLease) bool {
+		return agent.Name == name && held == *lease
+	})
+}
+
+func (s *docStore) ReleaseJobAgentLeases(jobID string) error {
+	return s.releaseAgentLeases(func(agent *lib.Agent, held lib.AgentLease) bool {
+		return held.JobID == jobID
+	})
+}
+
+// releaseAgentLeases removes the leases of the agents matching the predicate
+func (s *docStore) releaseAgentLeases(matches func(*lib.Agent, lib.AgentLease) bool) error {
+	return s.backend.Update(func(tx Tx) error {
+		agents := []*lib.Agent{}
+		err := forEachDoc(tx, agentsCollection, "", func() interface{} { return &lib.Agent{} }, func(doc interface{}) error {
+			agents = append(agents, doc.(*lib.Agent))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, agent := range agents {
+			kept := []lib.AgentLease{}
+			for _, held := range agent.Leases {
+				if !matches(agent, held) {
+					kept = append(kept, held)
+				}
+			}
+			if len(kept) == len(agent.Leases) {
+				continue
+			}
+			agent.Leases = kept
+			if err := putDoc(tx, agentsCollection, agent.Name, agent); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// registry credentials
+
+// registryKey is the key of the credential of a registry, the global credentials having an empty project id
+func registryKey(projectID, registry string) string {
+	return projectID + "/" + registry
+}
+
+func (s *docStore) SetRegistryCredential(credential *lib.RegistryCredential) error {
+	return s.backend.Update(func(tx Tx) error {
+		return putDoc(tx, registryCollection, registryKey(credential.ProjectID, credential.Registry), credential)
+	})
+}
+
+func (s *docStore) GetRegistryCredentials(projectID string) (lib.RegistryCredentials, error) {
+	res := lib.RegistryCredentials{}
+	err := s.backend.View(func(tx Tx) error {
+		return forEachDoc(tx, registryCollection, registryKey(projectID, ""), func() interface{} { return &lib.RegistryCredential{} }, func(doc interface{}) error {
+			res = append(res, doc.(*lib.RegistryCredential))
+			return nil
+		})
+	})
+	return res, err
+}
+
+func (s *docStore) RemoveRegistryCredential(projectID, registry string) error {
+	return s.backend.Update(func(tx Tx) error {
+		key := registryKey(projectID, registry)
+		raw, err := tx.Get(registryCollection, key)
+		if err != nil {
+			return err
+		}
+		if raw == nil {
+			return &NotFoundError{registryCollection, "registry", registry}
+		}
+		return tx.Delete(registryCollection, key)
+	})
+}
@@ -0,0 +1,364 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bzk-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewBoltStore(filepath.Join(dir, "bazooka.db"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	testStore(t, s)
+}
+
+func testStore(t *testing.T, s Store) {
+	project := &lib.Project{Name: "bazooka", ScmType: "git", ScmURI: "https://github.com/bazooka-ci/bazooka.git"}
+	require.NoError(t, s.AddProject(project))
+	require.NotEmpty(t, project.ID)
+
+	exists, err := s.HasProject("bazooka")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	byName, err := s.GetProjectById("bazooka")
+	require.NoError(t, err)
+	assert.Equal(t, project.ID, byName.ID)
+
+	require.NoError(t, s.SetProjectConfigKey(project.ID[:8], "bzk.scm.reuse", "true"))
+	byID, err := s.GetProjectById(project.ID[:8])
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"bzk.scm.reuse": "true"}, byID.Config)
+
+	_, err = s.GetProjectById("unknown")
+	assert.IsType(t, &NotFoundError{}, err)
+
+	t0 := time.Date(2015, 6, 7, 16, 0, 0, 0, time.UTC)
+	first := &lib.Job{ProjectID: project.ID, Started: t0}
+	second := &lib.Job{ProjectID: project.ID, Started: t0.Add(time.Minute)}
+	require.NoError(t, s.AddJob(first))
+	require.NoError(t, s.AddJob(second))
+	assert.Equal(t, 1, first.Number)
+	assert.Equal(t, 2, second.Number)
+	assert.Equal(t, lib.JobStatus(lib.JOB_RUNNING), second.Status)
+
+	require.NoError(t, s.FinishJob(first.ID, lib.JOB_SUCCESS, t0.Add(time.Second), nil))
+	hot, err := s.GetJobsWithHotLogs()
+	require.NoError(t, err)
+	require.Len(t, hot, 1)
+	assert.Equal(t, first.ID, hot[0].ID)
+
+	statuses, err := s.GetProjectsWithStatus()
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	require.NotNil(t, statuses[0].LastJob)
+	assert.Equal(t, second.ID, statuses[0].LastJob.ID)
+
+	variant := &lib.Variant{ProjectID: project.ID, JobID: second.ID, Number: 1}
+	require.NoError(t, s.AddVariant(variant))
+	require.NoError(t, s.AddVariantArtifact(variant.ID, "app.jar"))
+	require.NoError(t, s.SetVariantMetadata(variant.ID, "coverage", "87%"))
+	failure := &lib.Failure{Category: lib.FAILURE_SCRIPT, Reason: "The script exited with code 1"}
+	require.NoError(t, s.FinishVariant(variant.ID, lib.JOB_FAILED, t0.Add(time.Hour), []string{"app.jar", "report.html"}, failure))
+	variants, err := s.GetVariants(second.ID)
+	require.NoError(t, err)
+	require.Len(t, variants, 1)
+	assert.Equal(t, []string{"app.jar", "report.html"}, variants[0].Artifacts)
+	assert.Equal(t, failure, variants[0].Failure)
+	assert.Equal(t, "87%", variants[0].Metadata["coverage"])
+
+	// entries sharing the same timestamp are ordered by their sequence number
+	require.NoError(t, s.AddLogs([]lib.LogEntry{
+		{JobID: second.ID, VariantID: variant.ID, Message: "third", Time: t0.Add(time.Second), Seq: 1},
+		{JobID: second.ID, Message: "second", Time: t0, Seq: 2},
+		{JobID: second.ID, Message: "first", Time: t0, Seq: 1},
+	}))
+	logs, err := s.GetLog(&LogExample{JobID: second.ID[:8]})
+	require.NoError(t, err)
+	require.Len(t, logs, 3)
+	assert.Equal(t, []string{"first", "second", "third"}, []string{logs[0].Message, logs[1].Message, logs[2].Message})
+
+	variantLogs, err := s.GetLog(&LogExample{VariantID: variant.ID})
+	require.NoError(t, err)
+	require.Len(t, variantLogs, 1)
+	assert.Equal(t, "third", variantLogs[0].Message)
+
+	require.NoError(t, s.RemoveLogs(second.ID, []string{logs[0].ID, logs[2].ID}))
+	logs, err = s.GetLog(&LogExample{JobID: second.ID})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "second", logs[0].Message)
+
+	require.NoError(t, s.SetImage("parser/java", "bazooka/parser-java"))
+	image, err := s.GetImage("parser/java")
+	require.NoError(t, err)
+	assert.Equal(t, "bazooka/parser-java", image.Image)
+	_, err = s.GetImage("parser/cobol")
+	assert.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, s.AddUser(&lib.User{Email: "admin@bazooka.io", Password: "s3cr3t"}))
+	assert.True(t, s.ComparePassword("admin@bazooka.io", "s3cr3t"))
+	assert.False(t, s.ComparePassword("admin@bazooka.io", "guess"))
+	user, err := s.GetUserByEmail("admin@bazooka.io")
+	require.NoError(t, err)
+	assert.Empty(t, user.Password)
+}
+
+func TestDeleteProject(t *testing.T) {
+	s := NewMemoryStore()
+
+	kept := &lib.Project{Name: "kept"}
+	deleted := &lib.Project{Name: "deleted"}
+	require.NoError(t, s.AddProject(kept))
+	require.NoError(t, s.AddProject(deleted))
+
+	for _, project := range []*lib.Project{kept, deleted} {
+		job := &lib.Job{ProjectID: project.ID}
+		require.NoError(t, s.AddJob(job))
+		require.NoError(t, s.AddVariant(&lib.Variant{ProjectID: project.ID, JobID: job.ID}))
+		require.NoError(t, s.AddLog(&lib.LogEntry{ProjectID: project.ID, JobID: job.ID, Message: project.Name}))
+		require.NoError(t, s.SetProjectKey(project.ID, &lib.SSHKey{ProjectID: project.ID}))
+		require.NoError(t, s.AddCryptoKey(&lib.CryptoKey{ProjectID: project.ID}))
+	}
+
+	require.NoError(t, s.DeleteProject("deleted"))
+
+	_, err := s.GetProjectById(deleted.ID)
+	assert.IsType(t, &NotFoundError{}, err)
+	_, err = s.GetProjectCryptoKey(deleted.ID)
+	assert.IsType(t, &NotFoundError{}, err)
+
+	jobs, err := s.GetAllJobs()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, kept.ID, jobs[0].ProjectID)
+
+	logs, err := s.GetLog(&LogExample{})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "kept", logs[0].Message)
+
+	variants, err := s.GetVariants(jobs[0].ID)
+	require.NoError(t, err)
+	assert.Len(t, variants, 1)
+	_, err = s.GetProjectKey(kept.ID)
+	assert.NoError(t, err)
+}
+
+func TestFindJobs(t *testing.T) {
+	s := NewMemoryStore()
+
+	project := &lib.Project{Name: "bazooka"}
+	other := &lib.Project{Name: "other"}
+	require.NoError(t, s.AddProject(project))
+	require.NoError(t, s.AddProject(other))
+
+	t0 := time.Date(2015, 6, 7, 16, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		job := &lib.Job{ProjectID: project.ID, Started: t0.Add(time.Duration(i) * time.Hour)}
+		require.NoError(t, s.AddJob(job))
+		reference := "master"
+		if i%2 == 1 {
+			reference = "develop"
+		}
+		require.NoError(t, s.AddJobSCMMetadata(job.ID, &lib.SCMMetadata{Reference: reference}))
+		if i < 2 {
+			require.NoError(t, s.FinishJob(job.ID, lib.JOB_FAILED, job.Started.Add(time.Minute), &lib.Failure{Category: lib.FAILURE_SCRIPT, Reason: "2 variants failed"}))
+		}
+	}
+	require.NoError(t, s.AddJob(&lib.Job{ProjectID: other.ID, Started: t0}))
+
+	all, total, err := s.FindJobs(&lib.JobQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, 6, total)
+	assert.Len(t, all, 6)
+
+	// the most recent jobs come first
+	page, total, err := s.FindJobs(&lib.JobQuery{ProjectID: "bazooka", Offset: 1, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 5, total)
+	require.Len(t, page, 2)
+	assert.Equal(t, []int{4, 3}, []int{page[0].Number, page[1].Number})
+
+	page, total, err = s.FindJobs(&lib.JobQuery{ProjectID: project.ID, Reference: "master", Ascending: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []int{1, 3, 5}, []int{page[0].Number, page[1].Number, page[2].Number})
+
+	page, total, err = s.FindJobs(&lib.JobQuery{Status: lib.JOB_FAILED, From: t0.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, 2, page[0].Number)
+
+	page, total, err = s.FindJobs(&lib.JobQuery{Offset: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 6, total)
+	assert.Empty(t, page)
+
+	_, _, err = s.FindJobs(&lib.JobQuery{ProjectID: "unknown"})
+	assert.IsType(t, &NotFoundError{}, err)
+}
+
+func TestSetJobStages(t *testing.T) {
+	s := NewMemoryStore()
+
+	project := &lib.Project{Name: "bazooka"}
+	require.NoError(t, s.AddProject(project))
+	job := &lib.Job{ProjectID: project.ID}
+	require.NoError(t, s.AddJob(job))
+
+	require.NoError(t, s.SetJobStages(job.ID, []*lib.JobStage{
+		{Name: "build", Status: lib.JOB_SUCCESS},
+		{Name: "test", Status: lib.JOB_RUNNING},
+	}))
+	job, err := s.GetJobByID(job.ID)
+	require.NoError(t, err)
+	require.Len(t, job.Stages, 2)
+	assert.Equal(t, "test", job.Stages[1].Name)
+	assert.Equal(t, lib.JobStatus(lib.JOB_RUNNING), job.Stages[1].Status)
+
+	assert.Error(t, s.SetJobStages("unknown", nil))
+}
+
+func TestAgents(t *testing.T) {
+	s := NewMemoryStore()
+
+	agent := &lib.Agent{Name: "builder-1", DockerURL: "tcp://10.0.0.2:2375", Labels: []string{"large-disk"}, Capacity: 2}
+	require.NoError(t, s.RegisterAgent(agent))
+	registered := agent.Registered
+	assert.False(t, registered.IsZero())
+
+	// a heartbeat keeps the registration date
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, s.RegisterAgent(&lib.Agent{Name: "builder-1", DockerURL: "tcp://10.0.0.2:2375", Capacity: 4}))
+
+	agents, err := s.GetAgents()
+	require.NoError(t, err)
+	require.Len(t, agents, 1)
+	assert.Equal(t, 4, agents[0].Capacity)
+	// the stored dates are rounded to the millisecond
+	assert.WithinDuration(t, registered, agents[0].Registered, time.Millisecond)
+	assert.True(t, agents[0].LastSeen.After(agents[0].Registered))
+
+	require.NoError(t, s.RemoveAgent("builder-1"))
+	agents, err = s.GetAgents()
+	require.NoError(t, err)
+	assert.Empty(t, agents)
+
+	_, notFound := s.RemoveAgent("builder-1").(*NotFoundError)
+	assert.True(t, notFound)
+}
+
+func TestAgentLeases(t *testing.T) {
+	s := NewMemoryStore()
+	require.NoError(t, s.RegisterAgent(&lib.Agent{Name: "builder-1", DockerURL: "tcp://10.0.0.2:2375", Capacity: 2}))
+	require.NoError(t, s.RegisterAgent(&lib.Agent{Name: "builder-2", DockerURL: "tcp://10.0.0.3:2375", Capacity: 1}))
+
+	acquire := func(agent, jobID, id string) bool {
+		acquired, err := s.AcquireAgentLease(agent, &lib.AgentLease{JobID: jobID, ID: id})
+		require.NoError(t, err)
+		return acquired
+	}
+	assert.True(t, acquire("builder-1", "job-1", "1"))
+	assert.True(t, acquire("builder-1", "job-1", "1"), "acquiring a held lease again is a no-op")
+	assert.True(t, acquire("builder-1", "job-2", "1"))
+	assert.False(t, acquire("builder-1", "job-2", "2"), "the capacity is shared by the jobs")
+	assert.True(t, acquire("builder-2", "job-1", "2"))
+
+	// a heartbeat keeps the leases
+	require.NoError(t, s.RegisterAgent(&lib.Agent{Name: "builder-1", DockerURL: "tcp://10.0.0.2:2375", Capacity: 2}))
+	assert.False(t, acquire("builder-1", "job-2", "2"))
+
+	require.NoError(t, s.ReleaseAgentLease("builder-1", &lib.AgentLease{JobID: "job-2", ID: "1"}))
+	assert.True(t, acquire("builder-1", "job-2", "2"))
+
+	require.NoError(t, s.ReleaseJobAgentLeases("job-1"))
+	agents, err := s.GetAgents()
+	require.NoError(t, err)
+	for _, agent := range agents {
+		for _, lease := range agent.Leases {
+			assert.NotEqual(t, "job-1", lease.JobID, agent.Name)
+		}
+	}
+
+	_, err = s.AcquireAgentLease("unknown", &lib.AgentLease{JobID: "job-1", ID: "3"})
+	assert.True(t, IsNotFound(err))
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	s := NewMemoryStore()
+
+	project := &lib.Project{Name: "bazooka"}
+	require.NoError(t, s.AddProject(project))
+
+	require.NoError(t, s.SetRegistryCredential(&lib.RegistryCredential{Registry: "registry.example.com", Username: "global"}))
+	require.NoError(t, s.SetRegistryCredential(&lib.RegistryCredential{ProjectID: project.ID, Registry: "registry.example.com", Username: "old"}))
+	require.NoError(t, s.SetRegistryCredential(&lib.RegistryCredential{ProjectID: project.ID, Registry: "registry.example.com", Username: "project"}))
+
+	global, err := s.GetRegistryCredentials("")
+	require.NoError(t, err)
+	require.Len(t, global, 1)
+	assert.Equal(t, "global", global[0].Username)
+
+	credentials, err := s.GetRegistryCredentials(project.ID)
+	require.NoError(t, err)
+	require.Len(t, credentials, 1)
+	assert.Equal(t, "project", credentials[0].Username)
+
+	_, notFound := s.RemoveRegistryCredential(project.ID, "docker.io").(*NotFoundError)
+	assert.True(t, notFound)
+
+	// the credentials of a project are removed along with it
+	require.NoError(t, s.DeleteProject(project.ID))
+	credentials, err = s.GetRegistryCredentials(project.ID)
+	require.NoError(t, err)
+	assert.Empty(t, credentials)
+
+	require.NoError(t, s.RemoveRegistryCredential("", "registry.example.com"))
+	global, err = s.GetRegistryCredentials("")
+	require.NoError(t, err)
+	assert.Empty(t, global)
+}
+
+func TestRestore(t *testing.T) {
+	s := NewMemoryStore()
+
+	require.NoError(t, s.RestoreProject(&lib.Project{ID: "0123456789", Name: "bazooka", HookKey: "hook", JobCounter: 12}))
+	require.NoError(t, s.RestoreJob(&lib.Job{ID: "job", ProjectID: "0123456789", Number: 12, Status: lib.JOB_SUCCESS}))
+	require.NoError(t, s.RestoreVariant(&lib.Variant{ID: "variant", JobID: "job", Number: 1}))
+	require.NoError(t, s.RestoreUser(&lib.User{ID: "user", Email: "admin@bazooka.io", Password: "$2a$02$hash"}))
+
+	project, err := s.GetProjectById("bazooka")
+	require.NoError(t, err)
+	assert.Equal(t, "hook", project.HookKey)
+
+	// the job counter goes on from the restored one
+	job := &lib.Job{ProjectID: project.ID}
+	require.NoError(t, s.AddJob(job))
+	assert.Equal(t, 13, job.Number)
+
+	variants, err := s.GetVariants("job")
+	require.NoError(t, err)
+	assert.Len(t, variants, 1)
+
+	users, err := s.GetUsersWithPasswords()
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "$2a$02$hash", users[0].Password)
+}
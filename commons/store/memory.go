@@ -0,0 +1,119 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NewMemoryStore returns a store keeping everything in memory, mostly useful for tests
+func NewMemoryStore() Store {
+	return &docStore{
+		backend: &memoryBackend{
+			collections: map[string]map[string][]byte{},
+		},
+	}
+}
+
+type memoryBackend struct {
+	sync.RWMutex
+	collections map[string]map[string][]byte
+}
+
+func (m *memoryBackend) View(fn func(Tx) error) error {
+	m.RLock()
+	defer m.RUnlock()
+	return fn(&memoryTx{backend: m})
+}
+
+func (m *memoryBackend) Update(fn func(Tx) error) error {
+	m.Lock()
+	defer m.Unlock()
+	tx := &memoryTx{
+		backend: m,
+		changes: map[string]map[string][]byte{},
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	tx.commit()
+	return nil
+}
+
+func (m *memoryBackend) Close() error {
+	return nil
+}
+
+// memoryTx keeps the changes of a read-write transaction aside until it is committed
+type memoryTx struct {
+	backend *memoryBackend
+	// pending changes by collection and key, a nil value being a deletion. nil for read-only transactions
+	changes map[string]map[string][]byte
+}
+
+var errReadOnly = errors.New("cannot write in a read-only transaction")
+
+func (tx *memoryTx) Get(collection, key string) ([]byte, error) {
+	if value, changed := tx.changes[collection][key]; changed {
+		return value, nil
+	}
+	return tx.backend.collections[collection][key], nil
+}
+
+func (tx *memoryTx) change(collection, key string, value []byte) error {
+	if tx.changes == nil {
+		return errReadOnly
+	}
+	if _, found := tx.changes[collection]; !found {
+		tx.changes[collection] = map[string][]byte{}
+	}
+	tx.changes[collection][key] = value
+	return nil
+}
+
+func (tx *memoryTx) Put(collection, key string, value []byte) error {
+	return tx.change(collection, key, append([]byte{}, value...))
+}
+
+func (tx *memoryTx) Delete(collection, key string) error {
+	return tx.change(collection, key, nil)
+}
+
+func (tx *memoryTx) ForEach(collection, prefix string, fn func(key string, value []byte) error) error {
+	keys := []string{}
+	for key := range tx.backend.collections[collection] {
+		if _, changed := tx.changes[collection][key]; !changed && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key, value := range tx.changes[collection] {
+		if value != nil && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, _ := tx.Get(collection, key)
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *memoryTx) commit() {
+	for collection, changes := range tx.changes {
+		if _, found := tx.backend.collections[collection]; !found {
+			tx.backend.collections[collection] = map[string][]byte{}
+		}
+		for key, value := range changes {
+			if value == nil {
+				delete(tx.backend.collections[collection], key)
+			} else {
+				tx.backend.collections[collection][key] = value
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Package store defines how bazooka persists its projects, jobs, variants, logs, images, users, keys, agents and registry credentials.
+//
+// The mongo package provides the MongoDB implementation, this package provides the document stores:
+// an embedded single file backend (BoltDB) and an in-memory backend for tests.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+)
+
+type Store interface {
+	Close()
+
+	HasProject(name string) (bool, error)
+	GetProjectById(id string) (*lib.Project, error)
+	GetProjects() ([]*lib.Project, error)
+	GetProjectsWithStatus() ([]*lib.ProjectWithStatus, error)
+	AddProject(project *lib.Project) error
+	SetProjectConfig(id string, config map[string]string) error
+	SetProjectConfigKey(id, key, value string) error
+	UnsetProjectConfigKey(id, key string) error
+	// RestoreProject stores an exported project as is, keeping its id, hook key and job counter
+	RestoreProject(project *lib.Project) error
+	// DeleteProject removes a project along with its jobs, variants, logs and keys
+	DeleteProject(id string) error
+
+	AddJob(job *lib.Job) error
+	GetJobByID(id string) (*lib.Job, error)
+	GetJobs(projectID string) ([]*lib.Job, error)
+	GetAllJobs() ([]*lib.Job, error)
+	// FindJobs returns the page of jobs selected by the query, along with the total count of matching jobs
+	FindJobs(query *lib.JobQuery) ([]*lib.Job, int, error)
+	GetJobsWithHotLogs() ([]*lib.Job, error)
+	// RestoreJob stores an exported job as is, keeping its id and number
+	RestoreJob(job *lib.Job) error
+	SetJobOrchestrationId(id string, orchestrationId string) error
+	AddJobSCMMetadata(id string, metadata *lib.SCMMetadata) error
+	SetJobSecuredValues(id string, secured []string) error
+	SetJobLogArchive(id string, archive string) error
+	// SetJobPinned pins a job, or unpins it, so that the garbage collection keeps it
+	SetJobPinned(id string, pinned bool) error
+	// SetJobStages replaces the status of the stages of the pipeline of a job
+	SetJobStages(id string, stages []*lib.JobStage) error
+	FinishJob(id string, status lib.JobStatus, completed time.Time, failure *lib.Failure) error
+
+	AddVariant(variant *lib.Variant) error
+	GetVariantByID(id string) (*lib.Variant, error)
+	GetVariants(jobID string) ([]*lib.Variant, error)
+	FinishVariant(id string, status lib.JobStatus, completed time.Time, artifacts []string, failure *lib.Failure) error
+	SetVariantMetadata(id, name, value string) error
+	AddVariantArtifact(id, artifact string) error
+	AppendVariantSummary(id, summary string) error
+	RestoreVariant(variant *lib.Variant) error
+
+	AddLog(log *lib.LogEntry) error
+	AddLogs(logs []lib.LogEntry) error
+	GetLog(like *LogExample) ([]lib.LogEntry, error)
+	RemoveLogs(jobID string, ids []string) error
+
+	HasImage(name string) (bool, error)
+	GetImage(name string) (*lib.Image, error)
+	SetImage(name, image string) error
+	GetImages() ([]*lib.Image, error)
+
+	HasUser(email string) (bool, error)
+	GetUserByEmail(email string) (*lib.User, error)
+	GetUsers() ([]*lib.User, error)
+	// GetUsersWithPasswords returns the users along with their password hashes, to export them
+	GetUsersWithPasswords() ([]*lib.User, error)
+	AddUser(user *lib.User) error
+	ComparePassword(email string, password string) bool
+	// RestoreUser stores an exported user as is, its password being already hashed
+	RestoreUser(user *lib.User) error
+
+	GetProjectKey(projectID string) (*lib.SSHKey, error)
+	SetProjectKey(projectID string, key *lib.SSHKey) error
+
+	GetProjectCryptoKey(projectID string) (*lib.CryptoKey, error)
+	AddCryptoKey(key *lib.CryptoKey) error
+	GetCryptoKeys(projectID string) ([]*lib.CryptoKey, error)
+
+	// RegisterAgent adds a build agent, or updates the one of the same name, marking it as seen now
+	RegisterAgent(agent *lib.Agent) error
+	GetAgents() ([]*lib.Agent, error)
+	RemoveAgent(name string) error
+	// AcquireAgentLease takes one of the slots of the capacity of an agent, returning false if they are all taken
+	AcquireAgentLease(name string, lease *lib.AgentLease) (bool, error)
+	ReleaseAgentLease(name string, lease *lib.AgentLease) error
+	// ReleaseJobAgentLeases releases the leases a job still holds on all the agents
+	ReleaseJobAgentLeases(jobID string) error
+
+	// SetRegistryCredential adds the credential of a registry, replacing the one of the same registry and project.
+	// The credentials without project id apply to all the projects
+	SetRegistryCredential(credential *lib.RegistryCredential) error
+	// GetRegistryCredentials returns the credentials of a project, or the global ones if projectID is empty
+	GetRegistryCredentials(projectID string) (lib.RegistryCredentials, error)
+	RemoveRegistryCredential(projectID, registry string) error
+}
+
+type LogExample struct {
+	ProjectID string
+	JobID     string
+	VariantID string
+	Images    []string
+	After     time.Time
+}
+
+// Match tells if a log entry satisfies the example, whose ids must be complete ids, not prefixes
+func (like *LogExample) Match(l *lib.LogEntry) bool {
+	if len(like.ProjectID) > 0 && l.ProjectID != like.ProjectID {
+		return false
+	}
+	if len(like.JobID) > 0 && l.JobID != like.JobID {
+		return false
+	}
+	if len(like.VariantID) > 0 && l.VariantID != like.VariantID {
+		return false
+	}
+	if len(like.Images) > 0 {
+		found := false
+		for _, image := range like.Images {
+			if l.Image == image {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return like.After.IsZero() || l.Time.After(like.After)
+}
+
+// ErrNotFound is returned when a single document lookup, which is not a lookup by id, finds nothing
+var ErrNotFound = errors.New("not found")
+
+type NotFoundError struct {
+	Collection string
+	Field      string
+	Value      string
+}
+
+func (n *NotFoundError) Error() string {
+	return fmt.Sprintf("%s[%s:%s] not found", n.Collection, n.Field, n.Value)
+}
+
+// IsNotFound tells whether err reports a missing document, whichever backend returned it
+func IsNotFound(err error) bool {
+	if _, notFound := err.(*NotFoundError); notFound {
+		return true
+	}
+	return err == ErrNotFound || err.Error() == ErrNotFound.Error()
+}
+
+type ManyFoundError struct {
+	Collection string
+	Field      string
+	Value      string
+	Count      int
+}
+
+func (m *ManyFoundError) Error() string {
+	return fmt.Sprintf("%s[%s:%s] returned %d results", m.Collection, m.Field, m.Value, m.Count)
+}
@@ -14,6 +14,24 @@ type Person struct {
 	Email string `bson:"email" json:"email" yaml:"email"`
 }
 
+var (
+	// DefaultImages are the images registered by the server when missing, and those used by the local builds
+	DefaultImages = map[string]string{
+		"orchestration":  "bazooka/orchestration",
+		"parser":         "bazooka/parser",
+		"scm/fetch/git":  "bazooka/scm-git",
+		"scm/fetch/hg":   "bazooka/scm-hg",
+		"parser/golang":  "bazooka/parser-golang",
+		"parser/go":      "bazooka/parser-golang",
+		"parser/java":    "bazooka/parser-java",
+		"parser/python":  "bazooka/parser-python",
+		"parser/ruby":    "bazooka/parser-ruby",
+		"parser/node_js": "bazooka/parser-nodejs",
+		"parser/nodejs":  "bazooka/parser-nodejs",
+		"parser/php":     "bazooka/parser-php",
+	}
+)
+
 type Image struct {
 	Name        string `bson:"name" json:"name"`
 	Description string `bson:"description" json:"description"`
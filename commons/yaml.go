@@ -13,7 +13,7 @@ func Parse(file string, object interface{}) error {
 		return err
 	}
 
-	// TODO Add validation
+	// the configuration files are checked beforehand with Lint, which reports all their problems
 	return yaml.Unmarshal(b, object)
 }
 
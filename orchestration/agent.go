@@ -0,0 +1,329 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+// agentLeaser hands out the slots of the capacity of the agents, shared by the variants of all the jobs
+type agentLeaser interface {
+	AcquireAgentLease(name string, lease *lib.AgentLease) (bool, error)
+	ReleaseAgentLease(name string, lease *lib.AgentLease) error
+}
+
+// leaseRetry is the interval at which an agent running at its capacity is asked again for a lease
+const leaseRetry = 2 * time.Second
+
+// agentPool dispatches the variants selecting build agents to the agents which are up and have all the selected labels.
+// Each agent builds or runs at most its capacity of variants at once, counting those of all the jobs:
+// the server holds the leases of the agents, which the jobs acquire before using an agent
+type agentPool struct {
+	sync.Mutex
+	agents []*lib.Agent
+	// the number of variants dispatched to each agent, by agent name
+	dispatched map[string]int
+	apis       map[string]*dockerclient.Client
+	// the folder of the cert.pem, key.pem and ca.pem files authenticating to the agents Docker API, if any
+	certs  string
+	leaser agentLeaser
+	jobID  string
+	// the number of leases acquired by the job, numbering them
+	leases int
+	retry  time.Duration
+}
+
+func newAgentPool(agents []*lib.Agent, leaser agentLeaser, jobID string, now time.Time) *agentPool {
+	p := &agentPool{
+		dispatched: map[string]int{},
+		apis:       map[string]*dockerclient.Client{},
+		leaser:     leaser,
+		jobID:      jobID,
+		retry:      leaseRetry,
+	}
+	for _, agent := range agents {
+		if agent.Alive(now) {
+			p.agents = append(p.agents, agent)
+		}
+	}
+	return p
+}
+
+// loadAgents returns the pool of the build agents if some variants select them, nil otherwise
+func loadAgents(context *context, variants []*variantData) (*agentPool, error) {
+	selecting := false
+	for _, vd := range variants {
+		selecting = selecting || vd.agent != nil
+	}
+	if !selecting {
+		return nil, nil
+	}
+	if context.local {
+		log.Info("The local builds run on the local Docker host, ignoring the agent selection")
+		return nil, nil
+	}
+
+	agents, err := context.client.Internal.GetAgents()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list the build agents: %v", err)
+	}
+	pool := newAgentPool(agents, context.client.Internal, context.jobID, time.Now())
+	if len(context.paths.agentCerts.host) > 0 {
+		pool.certs = context.paths.agentCerts.container
+	}
+	return pool, nil
+}
+
+// dispatch assigns the variant to the agent having its labels to which the job dispatched the least variants, relative to the agents capacity
+func (p *agentPool) dispatch(vd *variantData) error {
+	p.Lock()
+	defer p.Unlock()
+
+	var best *lib.Agent
+	for _, agent := range p.agents {
+		if !agent.HasLabels(vd.agent.Labels) {
+			continue
+		}
+		if best == nil || p.dispatched[agent.Name]*capacity(best) < p.dispatched[best.Name]*capacity(agent) {
+			best = agent
+		}
+	}
+	if best == nil {
+		return fmt.Errorf("No build agent is up with the labels [%s]", strings.Join(vd.agent.Labels, ", "))
+	}
+
+	p.dispatched[best.Name]++
+	vd.host = best
+	log.WithFields(log.Fields{
+		"variant": vd.counter,
+		"agent":   best.Name,
+	}).Info("Variant dispatched to build agent")
+	return nil
+}
+
+func capacity(agent *lib.Agent) int {
+	if agent.Capacity <= 0 {
+		return 1
+	}
+	return agent.Capacity
+}
+
+// acquire waits until the server gives the job a lease on the agent, and returns a client of its Docker API
+// along with the function releasing the lease
+func (p *agentPool) acquire(agent *lib.Agent) (*dockerclient.Client, func(), error) {
+	p.Lock()
+	api, found := p.apis[agent.Name]
+	if !found {
+		var err error
+		if api, err = p.newClient(agent.DockerURL); err != nil {
+			p.Unlock()
+			return nil, nil, fmt.Errorf("Invalid Docker URL %s of agent %s: %v", agent.DockerURL, agent.Name, err)
+		}
+		p.apis[agent.Name] = api
+	}
+	p.leases++
+	lease := &lib.AgentLease{JobID: p.jobID, ID: strconv.Itoa(p.leases)}
+	p.Unlock()
+
+	for {
+		acquired, err := p.leaser.AcquireAgentLease(agent.Name, lease)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to acquire a lease on agent %s: %v", agent.Name, err)
+		}
+		if acquired {
+			break
+		}
+		time.Sleep(p.retry)
+	}
+	return api, func() {
+		if err := p.leaser.ReleaseAgentLease(agent.Name, lease); err != nil {
+			log.Errorf("Error while releasing the lease %s of agent %s, released once the job finishes: %v\n", lease.ID, agent.Name, err)
+		}
+	}, nil
+}
+
+// newClient returns a client of the Docker API of an agent, over TLS with the client certificate of the server if it has one
+func (p *agentPool) newClient(endpoint string) (*dockerclient.Client, error) {
+	if len(p.certs) == 0 {
+		return dockerclient.NewClient(endpoint)
+	}
+	return dockerclient.NewTLSClient(endpoint,
+		filepath.Join(p.certs, "cert.pem"),
+		filepath.Join(p.certs, "key.pem"),
+		filepath.Join(p.certs, "ca.pem"))
+}
+
+// removeImages removes the images built on the agents, which the garbage collection of the server doesn't reach
+func (p *agentPool) removeImages(variants []*variantData) {
+	for _, vd := range variants {
+		if vd.host == nil || len(vd.imageTag) == 0 {
+			continue
+		}
+		api, release, err := p.acquire(vd.host)
+		if err != nil {
+			log.Errorf("Error while removing the image of variant %v: %v\n", vd.counter, err)
+			continue
+		}
+		if err := api.RemoveImage(vd.imageTag); err != nil {
+			log.Errorf("Error while removing the image %s from agent %s: %v\n", vd.imageTag, vd.host.Name, err)
+		}
+		release()
+	}
+}
+
+// runOnAgent runs the variant on the build agent it was dispatched to
+func (r *Runner) runOnAgent(vd *variantData) error {
+	api, release, err := r.agents.acquire(vd.host)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	log.WithFields(log.Fields{
+		"variant": vd.counter,
+		"agent":   vd.host.Name,
+	}).Info("Running variant on build agent")
+
+	agentRunner := &Runner{
+		context: r.context,
+		api:     api,
+		ctx:     r.ctx,
+		agent:   vd.host,
+	}
+	return agentRunner.runContainer(vd)
+}
+
+// downloadArtifacts copies the /artifacts folder of a container run on an agent into dir
+func (r *Runner) downloadArtifacts(container, dir string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(r.api.DownloadFromContainer(container, dockerclient.DownloadFromContainerOptions{
+			Path:         "/artifacts",
+			OutputStream: writer,
+		}))
+	}()
+	err := extractArtifacts(reader, dir)
+	reader.Close()
+	return err
+}
+
+// extractArtifacts extracts the files and folders of an archive of the /artifacts folder into dir
+func extractArtifacts(archive io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// the entries are relative to the parent of the archived folder: artifacts/...
+		name := filepath.Clean(header.Name)
+		parts := strings.SplitN(name, string(filepath.Separator), 2)
+		if len(parts) < 2 {
+			continue
+		}
+		if strings.HasPrefix(parts[1], "..") {
+			return fmt.Errorf("Invalid artifact path %s", header.Name)
+		}
+		target := filepath.Join(dir, parts[1])
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&os.ModePerm)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// uploadArtifacts copies the artifacts of the variants of the runner in /artifacts/<variant number> of a container created on an agent
+func (r *Runner) uploadArtifacts(container string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(writer)
+		err := r.archiveArtifacts(tw)
+		if err == nil {
+			err = tw.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	err := r.api.UploadToContainer(container, dockerclient.UploadToContainerOptions{
+		Path:        "/artifacts",
+		InputStream: reader,
+	})
+	reader.Close()
+	return err
+}
+
+func (r *Runner) archiveArtifacts(tw *tar.Writer) error {
+	for _, vd := range r.variants {
+		root := filepath.Join(r.context.paths.artifacts.container, vd.variant.ID)
+		prefix := strconv.Itoa(vd.variant.Number)
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return nil
+				}
+				return err
+			}
+			if !info.IsDir() && !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentPoolDispatch(t *testing.T) {
+	now := time.Now()
+	pool := newAgentPool([]*lib.Agent{
+		{Name: "small", Labels: []string{"linux"}, Capacity: 1, LastSeen: now},
+		{Name: "large", Labels: []string{"linux", "large-disk"}, Capacity: 2, LastSeen: now},
+		{Name: "gone", Labels: []string{"linux", "gpu-free"}, Capacity: 4, LastSeen: now.Add(-time.Hour)},
+	}, store.NewMemoryStore(), "job-1", now)
+
+	selecting := func(labels ...string) *variantData {
+		return &variantData{counter: "00", agent: &lib.AgentSelector{Labels: labels}}
+	}
+
+	// the variants are spread according to the capacity of the agents
+	hosts := map[string]int{}
+	for i := 0; i < 3; i++ {
+		vd := selecting("linux")
+		require.NoError(t, pool.dispatch(vd))
+		hosts[vd.host.Name]++
+	}
+	assert.Equal(t, map[string]int{"small": 1, "large": 2}, hosts)
+
+	vd := selecting("large-disk", "linux")
+	require.NoError(t, pool.dispatch(vd))
+	assert.Equal(t, "large", vd.host.Name)
+
+	// the agents which stopped sending heartbeats are ignored
+	assert.Error(t, pool.dispatch(selecting("gpu-free")))
+}
+
+func TestAgentPoolLeases(t *testing.T) {
+	leaser := store.NewMemoryStore()
+	agent := &lib.Agent{Name: "builder-1", DockerURL: "tcp://10.0.0.2:2376", Capacity: 1}
+	require.NoError(t, leaser.RegisterAgent(agent))
+
+	// two jobs competing for the single slot of the agent
+	first := newAgentPool([]*lib.Agent{agent}, leaser, "job-1", agent.LastSeen)
+	second := newAgentPool([]*lib.Agent{agent}, leaser, "job-2", agent.LastSeen)
+	second.retry = 10 * time.Millisecond
+
+	_, release, err := first.acquire(agent)
+	require.NoError(t, err)
+
+	acquired := make(chan func())
+	go func() {
+		_, release, err := second.acquire(agent)
+		assert.NoError(t, err)
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("the second job acquired the agent running at its capacity")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("the second job did not acquire the agent released by the first one")
+	}
+
+	agents, err := leaser.GetAgents()
+	require.NoError(t, err)
+	require.Len(t, agents, 1)
+	assert.Empty(t, agents[0].Leases)
+}
+
+func TestExtractArtifacts(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, entry := range []struct {
+		name    string
+		content string
+	}{
+		{"artifacts/", ""},
+		{"artifacts/report.xml", "<report/>"},
+		{"artifacts/bin/", ""},
+		{"artifacts/bin/app", "binary"},
+	} {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.content == "" {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		}
+		require.NoError(t, tw.WriteHeader(header))
+		_, err := tw.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	dir, err := ioutil.TempDir("", "bzk-artifacts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, extractArtifacts(&archive, filepath.Join(dir, "variant")))
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "variant", "report.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "<report/>", string(content))
+	content, err = ioutil.ReadFile(filepath.Join(dir, "variant", "bin", "app"))
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(content))
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	gocontext "context"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -9,37 +11,45 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	lib "github.com/bazooka-ci/bazooka/commons"
-	docker "github.com/bywan/go-dockercommand"
+	dockerclient "github.com/fsouza/go-dockerclient"
 )
 
 type Builder struct {
 	context  *context
 	variants []*variantData
+	api      *dockerclient.Client
+	// the build agents the variants may be dispatched to
+	agents *agentPool
 }
 
 func (b *Builder) Build() error {
 	log.Info("Starting building Dockerfiles")
 	paths := b.context.paths
 
-	client, err := docker.NewDocker(paths.dockerEndpoint.container)
+	var err error
+	b.api, err = dockerclient.NewClient(paths.dockerEndpoint.container)
 	if err != nil {
 		return err
 	}
 
-	par := parallel.New()
+	par := parallel.NewWithContext(gocontext.Background(), b.context.maxParallel)
 	for _, ivariant := range b.variants {
+		if ivariant.variant.Status != lib.JOB_RUNNING {
+			continue
+		}
 		variant := ivariant
 		par.Submit(func() error {
-			return b.buildContainer(client, variant)
+			return b.buildContainer(variant)
 		}, variant)
 	}
 
-	par.Exec(func(tag interface{}, err error) {
+	err = par.Exec(func(tag interface{}, err error) {
 		v := tag.(*variantData)
 		if err != nil {
 			log.Errorf("Build error %v for variant %v\n", err, v)
 			v.variant.Status = lib.JOB_ERRORED
 			v.variant.Completed = time.Now()
+			v.variant.Failure = failureOf(fail(lib.FAILURE_IMAGE_BUILD, err))
 			return
 		}
 		log.WithFields(log.Fields{
@@ -47,24 +57,55 @@ func (b *Builder) Build() error {
 		}).Info("Build success for variant")
 
 	})
-	return nil
+	if err != nil {
+		log.Errorf("Variant image builds failed: %v\n", err)
+	}
+	return unrecordedError(err)
 }
 
-func (b *Builder) buildContainer(client *docker.Docker, vd *variantData) error {
+func (b *Builder) buildContainer(vd *variantData) error {
 	log.WithFields(log.Fields{
 		"variant": vd.counter,
 	}).Info("Building container for variant")
 
 	tag := fmt.Sprintf("bazooka-build/%s-%s-%d", b.context.projectID, vd.variant.JobID, vd.variant.Number)
 
-	err := client.Build(&docker.BuildOptions{
-		Tag:        tag,
-		Dockerfile: strings.TrimPrefix(vd.dockerFile, "/bazooka/"), //Ugly hack: the Dockerfile path needs to be relative to context dir
-		Path:       b.context.paths.base.container,
-	})
+	dockerfile := strings.TrimPrefix(vd.dockerFile, "/bazooka/") //Ugly hack: the Dockerfile path needs to be relative to context dir
+	var err error
+	limits := vd.resources.Cap(b.context.maxResources)
+	if vd.host != nil {
+		err = b.buildOnAgent(vd, tag, dockerfile, limits)
+	} else {
+		err = b.buildImage(b.api, tag, dockerfile, limits)
+	}
 	if err != nil {
 		return err
 	}
 	vd.imageTag = tag
 	return nil
 }
+
+// buildOnAgent builds the image of the variant on the build agent it was dispatched to, sending it the build folder
+func (b *Builder) buildOnAgent(vd *variantData, tag, dockerfile string, limits *lib.Resources) error {
+	api, release, err := b.agents.acquire(vd.host)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	log.WithFields(log.Fields{
+		"variant": vd.counter,
+		"agent":   vd.host.Name,
+	}).Info("Building container on build agent")
+
+	return b.buildImage(api, tag, dockerfile, limits)
+}
+
+// buildImage builds the image of a variant from the build folder, with the resource limits of the variant
+// and the credentials of the private registries for the base image pulls
+func (b *Builder) buildImage(api *dockerclient.Client, tag, dockerfile string, limits *lib.Resources) error {
+	opts := buildImageOptions(tag, dockerfile, b.context.paths.base.container, limits)
+	opts.OutputStream = os.Stdout
+	opts.AuthConfigs = b.context.registries.AuthConfigurations()
+	return api.BuildImage(opts)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+)
+
+// The project cache folder holds one folder per branch, named after its cache key, in branches/,
+// and the directories saved by the running variants in tmp/
+const (
+	cacheBranchesFolder = "branches"
+	cacheTmpFolder      = "tmp"
+)
+
+// cacheVolumes returns the volumes mounting, in the variant container, the cache of the built branch
+// (or of the default branch when the former does not exist yet) in /bazooka-cache/restore,
+// and an empty folder in /bazooka-cache/save, which is returned as well
+func (r *Runner) cacheVolumes(vd *variantData) ([]string, string, error) {
+	paths := r.context.paths
+	if len(vd.cache) == 0 || len(paths.cache.host) == 0 || len(r.context.cacheKey) == 0 {
+		return nil, "", nil
+	}
+
+	var volumes []string
+	for _, key := range []string{r.context.cacheKey, r.context.cacheFallback} {
+		if len(key) == 0 {
+			continue
+		}
+		exists, err := lib.FileExists(filepath.Join(paths.cache.container, cacheBranchesFolder, key))
+		if err != nil {
+			return nil, "", err
+		}
+		if exists {
+			volumes = append(volumes, fmt.Sprintf("%s/%s/%s:/bazooka-cache/restore:ro", paths.cache.host, cacheBranchesFolder, key))
+			break
+		}
+	}
+
+	save := fmt.Sprintf("%s-%d", r.context.jobID, vd.variant.Number)
+	if err := os.MkdirAll(filepath.Join(paths.cache.container, cacheTmpFolder, save), 0755); err != nil {
+		return nil, "", err
+	}
+	volumes = append(volumes, fmt.Sprintf("%s/%s/%s:/bazooka-cache/save", paths.cache.host, cacheTmpFolder, save))
+	return volumes, save, nil
+}
+
+// storeCache replaces the cache of the built branch with the directories saved by a successful variant.
+// The saved directories of a failed variant are dropped
+func (r *Runner) storeCache(save string, success bool) error {
+	root := r.context.paths.cache.container
+	saved := filepath.Join(root, cacheTmpFolder, save)
+	if !success {
+		return os.RemoveAll(saved)
+	}
+
+	// the variants of a job finish concurrently, the last successful one wins
+	r.cacheLock.Lock()
+	defer r.cacheLock.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(root, cacheBranchesFolder), 0755); err != nil {
+		return err
+	}
+	current := filepath.Join(root, cacheBranchesFolder, r.context.cacheKey)
+	previous := saved + ".previous"
+	if err := os.Rename(current, previous); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(saved, current); err != nil {
+		return err
+	}
+	return os.RemoveAll(previous)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "bzk-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	r := &Runner{context: &context{
+		jobID:         "job",
+		cacheKey:      "feature%2Fcache",
+		cacheFallback: "master",
+		paths:         paths{cache: path{root, "/host/cache"}},
+	}}
+	vd := &variantData{cache: lib.Dirs{"node_modules"}, variant: &lib.Variant{Number: 1}}
+
+	// without any cache, only the save folder is mounted
+	volumes, save, err := r.cacheVolumes(vd)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/host/cache/tmp/job-1:/bazooka-cache/save"}, volumes)
+	assert.Equal(t, "job-1", save)
+
+	// the cache of the default branch is used until the branch has its own
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "branches", "master"), 0755))
+	volumes, _, err = r.cacheVolumes(vd)
+	require.NoError(t, err)
+	assert.Equal(t, "/host/cache/branches/master:/bazooka-cache/restore:ro", volumes[0])
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "tmp", save, "saved"), []byte("1"), 0644))
+	require.NoError(t, r.storeCache(save, true))
+	_, err = os.Stat(filepath.Join(root, "branches", "feature%2Fcache", "saved"))
+	assert.NoError(t, err)
+
+	volumes, save, err = r.cacheVolumes(vd)
+	require.NoError(t, err)
+	assert.Equal(t, "/host/cache/branches/feature%2Fcache:/bazooka-cache/restore:ro", volumes[0])
+
+	// a failed variant leaves the branch cache untouched
+	require.NoError(t, r.storeCache(save, false))
+	_, err = os.Stat(filepath.Join(root, "tmp", save))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "branches", "feature%2Fcache", "saved"))
+	assert.NoError(t, err)
+
+	// variants without cached directories get no cache volume
+	volumes, save, err = r.cacheVolumes(&variantData{variant: &lib.Variant{Number: 2}})
+	require.NoError(t, err)
+	assert.Empty(t, volumes)
+	assert.Empty(t, save)
+}
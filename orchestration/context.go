@@ -7,8 +7,12 @@ import (
 
 	"log"
 
+	"strconv"
+
 	"github.com/bazooka-ci/bazooka/client"
+	lib "github.com/bazooka-ci/bazooka/commons"
 	"github.com/bazooka-ci/bazooka/commons/mongo"
+	dockerclient "github.com/fsouza/go-dockerclient"
 )
 
 const (
@@ -22,24 +26,52 @@ const (
 	BazookaEnvSCM           = "BZK_SCM"
 	BazookaEnvSCMUrl        = "BZK_SCM_URL"
 	BazookaEnvSCMReference  = "BZK_SCM_REFERENCE"
+	BazookaEnvSCMName       = "BZK_SCM_REFERENCE_NAME"
+	BazookaEnvSCMTag        = "BZK_SCM_TAG"
 	BazookaEnvProjectID     = "BZK_PROJECT_ID"
 	BazookaEnvJobID         = "BZK_JOB_ID"
 	BazookaEnvJobParameters = "BZK_JOB_PARAMETERS"
+	BazookaEnvCache         = "BZK_CACHE"
+	BazookaEnvCacheKey      = "BZK_CACHE_KEY"
+	BazookaEnvCacheFallback = "BZK_CACHE_FALLBACK_KEY"
+	BazookaEnvMaxParallel   = "BZK_MAX_PARALLEL"
+	BazookaEnvMaxMemory     = "BZK_MAX_MEMORY"
+	BazookaEnvMaxCPUs       = "BZK_MAX_CPUS"
+	BazookaEnvMaxPids       = "BZK_MAX_PIDS"
+	BazookaEnvIsolated      = "BZK_NETWORK_ISOLATED"
+	BazookaEnvRegistries    = "BZK_REGISTRY_CREDENTIALS"
+	BazookaEnvAgentCerts    = "BZK_AGENT_TLS_CERTS"
+
+	// the local builds run without a bazooka server, possibly restricted to a single variant
+	BazookaEnvLocal      = "BZK_LOCAL"
+	BazookaEnvRunVariant = "BZK_RUN_VARIANT"
 )
 
 type context struct {
 	connector     *mongo.MongoConnector
 	client        *client.Client
+	reporter      reporter
 	apiUrl        string
 	syslogUrl     string
 	scm           string
 	scmUrl        string
 	scmReference  string
+	scmName       string
+	scmTag        bool
 	projectID     string
 	jobID         string
 	jobParameters string
 	reuseScm      bool
-	paths         paths
+	isolated      bool
+	local         bool
+	runVariant    int
+	cacheKey      string
+	cacheFallback string
+	maxParallel   int
+	maxResources  *lib.Resources
+	// the credentials pulling the images of the private registries
+	registries lib.RegistryCredentials
+	paths      paths
 }
 
 type paths struct {
@@ -50,8 +82,11 @@ type paths struct {
 	artifacts      path
 	scmKey         path
 	cryptoKey      path
+	registries     path
 	dockerSock     path
 	dockerEndpoint path
+	cache          path
+	agentCerts     path
 }
 
 type path struct {
@@ -68,17 +103,54 @@ func initContext() *context {
 		log.Fatal(err)
 	}
 
-	return &context{
+	maxParallel := 0
+	if v := os.Getenv(BazookaEnvMaxParallel); len(v) > 0 {
+		maxParallel, err = strconv.Atoi(v)
+		if err != nil || maxParallel < 0 {
+			log.Fatalf("%s should be a positive number of variants, got %s", BazookaEnvMaxParallel, v)
+		}
+	}
+
+	local := os.Getenv(BazookaEnvLocal) != ""
+	var jobReporter reporter = client.Internal
+	if local {
+		jobReporter = &localReporter{}
+	}
+
+	runVariant := -1
+	if v := os.Getenv(BazookaEnvRunVariant); len(v) > 0 {
+		runVariant, err = strconv.Atoi(v)
+		if err != nil || runVariant < 0 {
+			log.Fatalf("%s should be a variant number, got %s", BazookaEnvRunVariant, v)
+		}
+	}
+
+	maxResources, err := lib.ParseResources(os.Getenv(BazookaEnvMaxMemory), os.Getenv(BazookaEnvMaxCPUs), os.Getenv(BazookaEnvMaxPids))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c := &context{
 		client:        client,
+		reporter:      jobReporter,
 		apiUrl:        os.Getenv(BazookaEnvApiUrl),
 		syslogUrl:     os.Getenv(BazookaEnvSyslogUrl),
 		scm:           os.Getenv(BazookaEnvSCM),
 		scmUrl:        os.Getenv(BazookaEnvSCMUrl),
 		scmReference:  os.Getenv(BazookaEnvSCMReference),
+		scmName:       os.Getenv(BazookaEnvSCMName),
+		scmTag:        os.Getenv(BazookaEnvSCMTag) != "",
 		projectID:     os.Getenv(BazookaEnvProjectID),
 		jobID:         os.Getenv(BazookaEnvJobID),
 		jobParameters: os.Getenv(BazookaEnvJobParameters),
 		reuseScm:      os.Getenv("BZK_REUSE_SCM_CHECKOUT") != "",
+		isolated:      os.Getenv(BazookaEnvIsolated) != "",
+		local:         local,
+		runVariant:    runVariant,
+		cacheKey:      os.Getenv(BazookaEnvCacheKey),
+		cacheFallback: os.Getenv(BazookaEnvCacheFallback),
+		maxParallel:   maxParallel,
+		maxResources:  maxResources,
 		paths: paths{
 			base:           path{"/bazooka", os.Getenv(BazookaEnvHome)},
 			source:         path{"/bazooka/source", os.Getenv(BazookaEnvSrc)},
@@ -87,13 +159,65 @@ func initContext() *context {
 			artifacts:      path{"/bazooka/artifacts", os.Getenv(BazookaEnvHome) + "/artifacts"},
 			scmKey:         path{"/bazooka/key", os.Getenv(BazookaEnvSCMKeyfile)},
 			cryptoKey:      path{"/bazooka/crypto-key", os.Getenv(BazookaEnvCryptoKeyfile)},
+			registries:     path{"/bazooka-registries", os.Getenv(BazookaEnvRegistries)},
 			dockerSock:     path{"/var/run/docker.sock", os.Getenv(BazookaEnvDockerSock)},
 			dockerEndpoint: path{"unix:///var/run/docker.sock", "unix://" + os.Getenv(BazookaEnvDockerSock)},
+			cache:          path{"/bazooka/cache", os.Getenv(BazookaEnvCache)},
+			agentCerts:     path{"/bazooka-agent-certs", os.Getenv(BazookaEnvAgentCerts)},
 		},
 	}
+
+	if len(c.paths.registries.host) > 0 {
+		if c.registries, err = lib.ReadRegistryCredentials(c.paths.registries.container); err != nil {
+			log.Fatalf("Cannot read the registry credentials: %v", err)
+		}
+	}
+	return c
+}
+
+// image resolves a bazooka image by name, from the server or from the default ones for the local builds
+func (c *context) image(name string) (string, error) {
+	if c.local {
+		image, found := lib.DefaultImages[name]
+		if !found {
+			return "", fmt.Errorf("Unknown bazooka image %s", name)
+		}
+		return image, nil
+	}
+	image, err := c.client.Image.Get(name)
+	if err != nil {
+		return "", err
+	}
+	return image.Image, nil
+}
+
+// pullImage pulls an image on the Docker host of the server with the credential of its registry, if any
+func (c *context) pullImage(image string) error {
+	if c.registries.For(image) == nil {
+		return nil
+	}
+	api, err := dockerclient.NewClient(c.paths.dockerEndpoint.container)
+	if err != nil {
+		return err
+	}
+	if err := c.registries.PullImage(api, image); err != nil {
+		return fmt.Errorf("Failed to pull the image %s: %v", image, err)
+	}
+	return nil
+}
+
+// loggingDriver sends the logs of the containers to the bazooka server, the local builds keeping the default one
+func (c *context) loggingDriver() string {
+	if c.local {
+		return ""
+	}
+	return "syslog"
 }
 
 func (c *context) loggerConfig(image string, variantID string) map[string]string {
+	if c.local {
+		return nil
+	}
 	tag := fmt.Sprintf("image=%s;project=%s;job=%s", image, c.projectID, c.jobID)
 	if len(variantID) > 0 {
 		tag += ";variant=" + variantID
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+// deployer returns the variant whose image is used to deploy the job, if the job deploys
+func deployer(context *context, variants []*variantData) *variantData {
+	for _, vd := range variants {
+		if vd.deploy == nil {
+			continue
+		}
+		if !vd.deploy.On.Matches(context.scmName, context.scmTag) {
+			log.WithFields(log.Fields{
+				"reference": context.scmName,
+				"tag":       context.scmTag,
+			}).Info("The reference doesn't match the deploy conditions, skipping the deploy")
+			return nil
+		}
+		return vd
+	}
+	return nil
+}
+
+// Deploy runs the deploy script in a container of the image of the deployer variant, once all the variants succeeded.
+// The artifacts of these variants are mounted read-only in /artifacts/<variant number>, or copied there
+// when the deployer variant was built on a build agent, where the deploy runs as well
+func (r *Runner) Deploy(deployer *variantData, deploy *variantData) error {
+	paths := r.context.paths
+
+	if deployer.host != nil {
+		api, release, err := r.agents.acquire(deployer.host)
+		if err != nil {
+			return fail(lib.FAILURE_AGENT, err)
+		}
+		defer release()
+		r.api = api
+		r.agent = deployer.host
+	} else {
+		api, err := dockerclient.NewClient(paths.dockerEndpoint.container)
+		if err != nil {
+			return err
+		}
+		r.api = api
+	}
+
+	config := &dockerclient.Config{
+		Image: deployer.imageTag,
+		Cmd:   []string{"./bazooka_deploy.sh"},
+		Env: envList(map[string]string{
+			BazookaEnvSCM:           r.context.scm,
+			BazookaEnvSCMUrl:        r.context.scmUrl,
+			BazookaEnvSCMReference:  r.context.scmReference,
+			BazookaEnvProjectID:     r.context.projectID,
+			BazookaEnvJobID:         r.context.jobID,
+			BazookaEnvJobParameters: r.context.jobParameters,
+			"BZK_VARIANT":           strconv.Itoa(deployer.variant.Number),
+			"BZK_DEPLOY":            "1",
+		}),
+	}
+
+	var volumes []string
+	if r.agent != nil {
+		config.Volumes = map[string]struct{}{"/artifacts": {}}
+	} else {
+		volumes = r.deployVolumes()
+	}
+
+	hostConfig := &dockerclient.HostConfig{
+		Binds: volumes,
+		LogConfig: dockerclient.LogConfig{
+			Type:   r.context.loggingDriver(),
+			Config: r.context.loggerConfig(deployer.imageTag, deploy.variant.ID),
+		},
+	}
+	limitHostConfig(hostConfig, deployer.resources.Cap(r.context.maxResources))
+
+	// the deploy needs an outbound access, even for isolated jobs
+	name := fmt.Sprintf("bazooka-deploy-%s-%s", r.context.projectID, r.context.jobID)
+	container, err := r.create(name, config, hostConfig, "bridge")
+	if err != nil {
+		return err
+	}
+	defer r.removeContainer(container)
+
+	if r.agent != nil {
+		if err := r.uploadArtifacts(container); err != nil {
+			return fail(lib.FAILURE_AGENT, fmt.Errorf("Error while copying the artifacts to agent %s: %v", r.agent.Name, err))
+		}
+	}
+	if err := r.api.StartContainer(container, nil); err != nil {
+		return err
+	}
+
+	exitCode, err := r.api.WaitContainer(container)
+	if err != nil {
+		return err
+	}
+
+	deploy.variant.Completed = time.Now()
+	if exitCode == 0 {
+		deploy.variant.Status = lib.JOB_SUCCESS
+	} else {
+		deploy.variant.Status = lib.JOB_FAILED
+		deploy.variant.Failure = &lib.Failure{
+			Category: lib.FAILURE_SCRIPT,
+			Reason:   fmt.Sprintf("The deploy script exited with code %d", exitCode),
+		}
+	}
+	return nil
+}
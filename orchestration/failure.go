@@ -0,0 +1,141 @@
+package main
+
+import (
+	gocontext "context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/parallel"
+)
+
+// failure is an error making a job or a variant fail, along with its category and the step it happened at
+type failure struct {
+	category lib.FailureCategory
+	step     lib.FailureCategory
+	err      error
+}
+
+func (f *failure) Error() string {
+	return f.err.Error()
+}
+
+// fail categorizes an error. The innermost category wins: an error already categorized keeps its category,
+// the first different one enclosing it being recorded as its step, e.g. a timeout at the service step
+func fail(category lib.FailureCategory, err error) error {
+	if f, categorized := err.(*failure); categorized {
+		if len(f.step) == 0 && f.category != category {
+			return &failure{category: f.category, step: category, err: f.err}
+		}
+		return err
+	}
+	return &failure{category: category, err: err}
+}
+
+// failureOf returns the failure recorded for an error, the errors which were not categorized being internal ones
+func failureOf(err error) *lib.Failure {
+	res := &lib.Failure{
+		Category: lib.FAILURE_INTERNAL,
+		Reason:   strings.TrimSpace(err.Error()),
+	}
+	if f, categorized := err.(*failure); categorized {
+		res.Category, res.Step = f.category, f.step
+	}
+	return res
+}
+
+// runError categorizes the error of a variant run: the variants stopped, or skipped, once the status of the job
+// was decided are cancelled
+func runError(ctx gocontext.Context, err error) error {
+	if ctx.Err() != nil {
+		return fail(lib.FAILURE_CANCELLED, err)
+	}
+	return err
+}
+
+// unrecordedError returns the error of the parallel build or run of some variants, unless it only aggregates
+// the errors of variants whose failure was recorded: these variants failed, not the whole job
+func unrecordedError(err error) error {
+	errs, aggregated := err.(parallel.Errors)
+	if !aggregated {
+		return err
+	}
+	for _, e := range errs {
+		vd, isVariant := e.Tag.(*variantData)
+		if !isVariant || vd.variant == nil || vd.variant.Failure == nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containerError returns the error written in reasonFile by a bazooka container which exited with a non zero code,
+// or err if it wrote none
+func containerError(reasonFile string, err error) error {
+	reason, readErr := ioutil.ReadFile(reasonFile)
+	if readErr != nil || len(strings.TrimSpace(string(reason))) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s", strings.TrimSpace(string(reason)))
+}
+
+// clearContainerError removes the error file a previous run of a bazooka container may have left
+func clearContainerError(reasonFile string) error {
+	if err := os.Remove(reasonFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// abortJob marks the job as errored because of err, and exits
+func abortJob(context *context, err error) {
+	clientErr := context.reporter.MarkJobAsFinished(context.jobID, lib.JOB_ERRORED, failureOf(err))
+	if clientErr != nil {
+		log.Fatal(err, clientErr)
+	}
+	log.Fatal(err)
+}
+
+// jobFailure explains the status of a job with the failure of the first variant, not allowed to fail, which has this status:
+// the errored variants come first, as they make the job errored. It is nil when all these variants succeeded
+func jobFailure(variants []*variantData) *lib.Failure {
+	var errored, failed *variantData
+	count := 0
+	for _, vd := range variants {
+		if vd.allowFailure || vd.variant.Status == lib.JOB_SUCCESS {
+			continue
+		}
+		count++
+		switch {
+		case vd.variant.Status == lib.JOB_ERRORED && errored == nil:
+			errored = vd
+		case vd.variant.Status == lib.JOB_FAILED && failed == nil:
+			failed = vd
+		}
+	}
+	first := errored
+	if first == nil {
+		first = failed
+	}
+	if first == nil {
+		return nil
+	}
+	others := count - 1
+
+	res := &lib.Failure{Category: lib.FAILURE_INTERNAL, Reason: "unknown reason"}
+	if first.variant.Failure != nil {
+		*res = *first.variant.Failure
+	}
+	name := fmt.Sprintf("Variant %d", first.variant.Number)
+	if first.variant.Deploy {
+		name = "The deploy"
+	}
+	res.Reason = fmt.Sprintf("%s did not succeed: %s", name, res.Reason)
+	if others > 0 {
+		res.Reason += fmt.Sprintf(" (and %d other variants)", others)
+	}
+	return res
+}
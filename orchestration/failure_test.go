@@ -0,0 +1,131 @@
+package main
+
+import (
+	gocontext "context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/parallel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureOf(t *testing.T) {
+	assert.Equal(t, &lib.Failure{Category: lib.FAILURE_INTERNAL, Reason: "no such image"},
+		failureOf(fmt.Errorf("no such image\n")))
+
+	// the innermost category wins, the first step enclosing it is recorded
+	err := fail(lib.FAILURE_SERVICE, fail(lib.FAILURE_TIMEOUT, fmt.Errorf("Service db never became ready")))
+	assert.Equal(t, &lib.Failure{Category: lib.FAILURE_TIMEOUT, Step: lib.FAILURE_SERVICE, Reason: "Service db never became ready"}, failureOf(err))
+	assert.Equal(t, lib.FAILURE_SERVICE, failureOf(fail(lib.FAILURE_CANCELLED, err)).Step)
+	assert.Equal(t, &lib.Failure{Category: lib.FAILURE_SERVICE, Reason: "exit 1"},
+		failureOf(fail(lib.FAILURE_SERVICE, fail(lib.FAILURE_SERVICE, fmt.Errorf("exit 1")))))
+}
+
+func TestJobFailure(t *testing.T) {
+	variant := func(number int, status lib.JobStatus, allowFailure bool, failure *lib.Failure) *variantData {
+		return &variantData{
+			allowFailure: allowFailure,
+			variant:      &lib.Variant{Number: number, Status: status, Failure: failure},
+		}
+	}
+	script := &lib.Failure{Category: lib.FAILURE_SCRIPT, Reason: "The script exited with code 1"}
+	build := &lib.Failure{Category: lib.FAILURE_IMAGE_BUILD, Reason: "no such image"}
+
+	assert.Nil(t, jobFailure([]*variantData{
+		variant(0, lib.JOB_SUCCESS, false, nil),
+		variant(1, lib.JOB_FAILED, true, script),
+	}))
+
+	failure := jobFailure([]*variantData{
+		variant(0, lib.JOB_SUCCESS, false, nil),
+		variant(1, lib.JOB_FAILED, false, script),
+		variant(2, lib.JOB_ERRORED, false, build),
+	})
+	require.NotNil(t, failure)
+	assert.Equal(t, lib.FAILURE_IMAGE_BUILD, failure.Category)
+	assert.Equal(t, "Variant 2 did not succeed: no such image (and 1 other variants)", failure.Reason)
+	// the failure of the variant is left untouched
+	assert.Equal(t, "no such image", build.Reason)
+}
+
+func TestJobFailureDeploy(t *testing.T) {
+	for _, tc := range []struct {
+		status   lib.JobStatus
+		failure  *lib.Failure
+		expected *lib.Failure
+	}{
+		{
+			lib.JOB_FAILED,
+			&lib.Failure{Category: lib.FAILURE_SCRIPT, Reason: "The deploy script exited with code 2"},
+			&lib.Failure{Category: lib.FAILURE_SCRIPT, Reason: "The deploy did not succeed: The deploy script exited with code 2"},
+		},
+		{
+			lib.JOB_ERRORED,
+			failureOf(fail(lib.FAILURE_AGENT, fmt.Errorf("Error while copying the artifacts to agent builder-1: EOF"))),
+			&lib.Failure{Category: lib.FAILURE_AGENT, Reason: "The deploy did not succeed: Error while copying the artifacts to agent builder-1: EOF"},
+		},
+		{
+			lib.JOB_ERRORED,
+			failureOf(fmt.Errorf("no such image")),
+			&lib.Failure{Category: lib.FAILURE_INTERNAL, Reason: "The deploy did not succeed: no such image"},
+		},
+		{
+			lib.JOB_ERRORED,
+			nil,
+			&lib.Failure{Category: lib.FAILURE_INTERNAL, Reason: "The deploy did not succeed: unknown reason"},
+		},
+	} {
+		// the deploy only runs once the variants not allowed to fail succeeded
+		failure := jobFailure([]*variantData{
+			{variant: &lib.Variant{Number: 0, Status: lib.JOB_SUCCESS}},
+			{allowFailure: true, variant: &lib.Variant{Number: 1, Status: lib.JOB_FAILED, Failure: &lib.Failure{Category: lib.FAILURE_SCRIPT}}},
+			{variant: &lib.Variant{Number: 2, Status: tc.status, Deploy: true, Failure: tc.failure}},
+		})
+		assert.Equal(t, tc.expected, failure)
+	}
+}
+
+func TestContainerError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bzk-failure")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	reasonFile := filepath.Join(dir, lib.FailureReasonFile)
+	generic := fmt.Errorf("Error during execution of Parser container")
+
+	assert.Equal(t, generic, containerError(reasonFile, generic), "without a reason file, the generic error is kept")
+
+	require.NoError(t, ioutil.WriteFile(reasonFile, []byte("Invalid configuration file .bazooka.yml:\n.bazooka.yml: 3:1: unknown key 'sudo'\n"), 0644))
+	assert.EqualError(t, containerError(reasonFile, generic), "Invalid configuration file .bazooka.yml:\n.bazooka.yml: 3:1: unknown key 'sudo'")
+
+	require.NoError(t, clearContainerError(reasonFile))
+	assert.Equal(t, generic, containerError(reasonFile, generic))
+	assert.NoError(t, clearContainerError(reasonFile), "clearing a missing reason file is fine")
+}
+
+func TestRunError(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	assert.Equal(t, lib.FAILURE_INTERNAL, failureOf(runError(ctx, fmt.Errorf("no such image"))).Category)
+
+	cancel()
+	// the variants skipped once the job status was decided get the error of the context
+	assert.Equal(t, &lib.Failure{Category: lib.FAILURE_CANCELLED, Reason: "context canceled"}, failureOf(runError(ctx, gocontext.Canceled)))
+	assert.Equal(t, lib.FAILURE_SCRIPT, failureOf(runError(ctx, fail(lib.FAILURE_SCRIPT, fmt.Errorf("exit 1")))).Category)
+}
+
+func TestUnrecordedError(t *testing.T) {
+	assert.NoError(t, unrecordedError(nil))
+
+	recorded := &variantData{variant: &lib.Variant{Failure: &lib.Failure{Category: lib.FAILURE_IMAGE_BUILD}}}
+	unrecorded := &variantData{variant: &lib.Variant{}}
+	buildErr := fmt.Errorf("no such image")
+
+	assert.NoError(t, unrecordedError(parallel.Errors{{Tag: recorded, Err: buildErr}}), "the failure of the variant was recorded")
+	errs := parallel.Errors{{Tag: recorded, Err: buildErr}, {Tag: unrecorded, Err: buildErr}}
+	assert.Equal(t, errs, unrecordedError(errs))
+	assert.Equal(t, buildErr, unrecordedError(buildErr))
+}
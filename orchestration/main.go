@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
-	"strconv"
+	gocontext "context"
+	"os"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -30,18 +30,18 @@ func main() {
 	f := &SCMFetcher{
 		context: context,
 	}
-	err := f.Fetch()
+	// the local builds run on the working directory of the developer
+	var err error
+	if !context.local {
+		err = f.Fetch()
+	}
 	if err != nil && context.reuseScm {
 		log.Info("First SCM fetch with bzk.scm.reuse true failed, retrying with a clean SCM fetch")
 		f.update = false
 		err = f.Fetch()
 	}
 	if err != nil {
-		clientErr := context.client.Internal.MarkJobAsFinished(context.jobID, lib.JOB_ERRORED)
-		if clientErr != nil {
-			log.Fatal(err, clientErr)
-		}
-		log.Fatal(err)
+		abortJob(context, fail(lib.FAILURE_SCM_FETCH, err))
 	}
 
 	p := &Parser{
@@ -49,120 +49,253 @@ func main() {
 	}
 	parsedVariants, err := p.Parse()
 	if err != nil {
-		clientErr := context.client.Internal.MarkJobAsFinished(context.jobID, lib.JOB_ERRORED)
-		if clientErr != nil {
-			log.Fatal(err, clientErr)
+		abortJob(context, fail(lib.FAILURE_PARSE, err))
+	}
+
+	matrix, err := p.matrixSettings()
+	if err != nil {
+		abortJob(context, fail(lib.FAILURE_PARSE, err))
+	}
+
+	// let the server know the secured values so that it can mask them in the logs
+	securedValues, err := p.securedValues()
+	if err == nil && len(securedValues) > 0 {
+		err = context.reporter.SetJobSecuredValues(context.jobID, securedValues)
+	}
+	if err != nil {
+		abortJob(context, err)
+	}
+
+	if context.runVariant >= 0 {
+		if context.runVariant >= len(parsedVariants) {
+			log.Fatalf("Unknown variant %d, the job has %d variants", context.runVariant, len(parsedVariants))
 		}
-		log.Fatal(err)
+		parsedVariants = parsedVariants[context.runVariant : context.runVariant+1]
+	}
+
+	stageNames, err := p.stages()
+	if err != nil {
+		abortJob(context, fail(lib.FAILURE_PARSE, err))
+	}
+	stages, err := groupStages(stageNames, parsedVariants)
+	if err != nil {
+		abortJob(context, fail(lib.FAILURE_PARSE, err))
+	}
+	if err := reportStages(context, stages); err != nil {
+		abortJob(context, err)
 	}
 
-	for i, v := range parsedVariants {
-		variant := &lib.Variant{
-			Started:   time.Now(),
-			Status:    lib.JOB_RUNNING,
-			Number:    i,
-			ProjectID: context.projectID,
-			JobID:     context.jobID,
-			Metas:     v.meta,
+	agents, err := loadAgents(context, parsedVariants)
+	if err != nil {
+		abortJob(context, fail(lib.FAILURE_AGENT, err))
+	}
+
+	// the job status is decided once deployed, if it deploys, which the local builds never do
+	var deployVariant *variantData
+	if !context.local {
+		deployVariant = deployer(context, parsedVariants)
+	}
+
+	// the variants of the stages which were run
+	ranVariants := []*variantData{}
+	jobFinished := false
+	stagesSucceeded := true
+	for si, st := range stages {
+		st.status.Status = lib.JOB_RUNNING
+		st.status.Started = time.Now()
+		if err := reportStages(context, stages); err != nil {
+			log.Fatal(err)
 		}
-		var err error
-		variant, err = context.client.Internal.AddVariant(variant)
-		if err != nil {
-			clientErr := context.client.Internal.MarkJobAsFinished(context.jobID, lib.JOB_ERRORED)
-			if clientErr != nil {
-				log.Fatal(err, clientErr)
+		if len(st.status.Name) > 0 {
+			log.WithFields(log.Fields{
+				"stage": st.status.Name,
+			}).Info("Starting stage")
+		}
+
+		for _, v := range st.variants {
+			variant := &lib.Variant{
+				Started:      time.Now(),
+				Status:       lib.JOB_RUNNING,
+				Number:       len(ranVariants),
+				ProjectID:    context.projectID,
+				JobID:        context.jobID,
+				Metas:        v.meta,
+				AllowFailure: v.allowFailure,
+				Stage:        st.status.Name,
+			}
+			// the variant records its agent, whose containers and images are removed with the project
+			var dispatchErr error
+			if v.agent != nil && agents != nil {
+				if dispatchErr = agents.dispatch(v); dispatchErr == nil {
+					variant.Agent = v.host.Name
+				}
+			}
+
+			var err error
+			variant, err = context.reporter.AddVariant(variant)
+			if err != nil {
+				abortJob(context, err)
+			}
+			v.variant = variant
+			ranVariants = append(ranVariants, v)
+
+			if dispatchErr != nil {
+				log.Errorf("Dispatch error %v for variant %v\n", dispatchErr, v.counter)
+				v.variant.Status = lib.JOB_ERRORED
+				v.variant.Completed = time.Now()
+				v.variant.Failure = failureOf(fail(lib.FAILURE_AGENT, dispatchErr))
 			}
-			log.Fatal(err)
 		}
-		v.variant = variant
-	}
 
-	b := &Builder{
-		context:  context,
-		variants: parsedVariants,
-	}
+		b := &Builder{
+			context:  context,
+			variants: st.variants,
+			agents:   agents,
+		}
 
-	if err := b.Build(); err != nil {
-		clientErr := context.client.Internal.MarkJobAsFinished(context.jobID, lib.JOB_ERRORED)
-		if clientErr != nil {
-			log.Fatal(err, clientErr)
+		if err := b.Build(); err != nil {
+			abortJob(context, err)
 		}
-		log.Fatal(err)
-	}
 
-	// variantsToBuild are the variants that we succeeded in generating a doocker image for them
-	variantsToBuild := []*variantData{}
-	for _, vd := range parsedVariants {
-		switch vd.variant.Status {
-		case lib.JOB_ERRORED:
-			if err := context.client.Internal.MarkVariantAsFinished(vd.variant.ID, lib.JOB_ERRORED, vd.variant.Completed, nil); err != nil {
-				log.Fatal(err)
+		// variantsToBuild are the variants that we succeeded in generating a doocker image for them
+		variantsToBuild := []*variantData{}
+		for _, vd := range st.variants {
+			switch vd.variant.Status {
+			case lib.JOB_ERRORED:
+				if err := context.reporter.MarkVariantAsFinished(vd.variant.ID, lib.JOB_ERRORED, vd.variant.Completed, nil, vd.variant.Failure); err != nil {
+					log.Fatal(err)
+				}
+			default:
+				variantsToBuild = append(variantsToBuild, vd)
 			}
-		default:
-			variantsToBuild = append(variantsToBuild, vd)
 		}
-	}
 
-	r := &Runner{
-		variants: variantsToBuild,
-		context:  context,
-	}
+		ctx, cancel := gocontext.WithCancel(gocontext.Background())
 
-	err = r.Run()
-	if err != nil {
-		clientErr := context.client.Internal.MarkJobAsFinished(context.jobID, lib.JOB_ERRORED)
-		if clientErr != nil {
-			log.Fatal(err, clientErr)
+		r := &Runner{
+			variants: variantsToBuild,
+			context:  context,
+			ctx:      ctx,
+			agents:   agents,
 		}
-		log.Fatal(err)
-	}
 
-	for _, vd := range variantsToBuild {
-		if err := context.client.Internal.MarkVariantAsFinished(vd.variant.ID, vd.variant.Status, vd.variant.Completed, vd.variant.Artifacts); err != nil {
+		// the job status can only be decided early during its last stage
+		if matrix.FastFinish && si == len(stages)-1 && deployVariant == nil {
+			r.requiredFinished = func() {
+				// decide the job status without waiting for the variants allowed to fail
+				finishJob(context, ranVariants)
+				jobFinished = true
+				if matrix.CancelAllowedFailures {
+					cancel()
+				}
+			}
+		}
+
+		err = r.Run()
+		cancel()
+		if err != nil {
+			abortJob(context, err)
+		}
+
+		st.status.Status, _ = variantsStatus(st.variants)
+		st.status.Completed = time.Now()
+		if err := reportStages(context, stages); err != nil {
 			log.Fatal(err)
 		}
+		// the next stages are only run once this one succeeded
+		if st.status.Status != lib.JOB_SUCCESS {
+			stagesSucceeded = false
+			if si < len(stages)-1 {
+				log.WithFields(log.Fields{
+					"stage":  st.status.Name,
+					"status": st.status.Status,
+				}).Info("Stage did not succeed, skipping the next stages")
+			}
+			break
+		}
 	}
 
-	var (
-		errorCount   = 0
-		successCount = 0
-		failCount    = 0
-	)
-	for _, vd := range parsedVariants {
-		switch vd.variant.Status {
-		case lib.JOB_ERRORED:
-			errorCount++
-		case lib.JOB_SUCCESS:
-			successCount++
-		case lib.JOB_FAILED:
-			failCount++
-		default:
-			log.Fatal(fmt.Errorf("Found a variant without a status %v", vd))
+	if deployVariant != nil && stagesSucceeded {
+		if status, _ := variantsStatus(ranVariants); status == lib.JOB_SUCCESS {
+			ranVariants = append(ranVariants, deploy(context, agents, deployVariant, ranVariants))
 		}
 	}
+	if agents != nil {
+		agents.removeImages(ranVariants)
+	}
 
-	log.WithFields(log.Fields{
-		"ERRORED":   strconv.Itoa(errorCount),
-		"SUCCEEDED": strconv.Itoa(successCount),
-		"FAILED":    strconv.Itoa(failCount),
-	}).Info("Job Completed")
-
-	var jobStatus lib.JobStatus
-	switch {
-	case errorCount > 0:
-		jobStatus = lib.JOB_ERRORED
-	case failCount > 0:
-		jobStatus = lib.JOB_FAILED
-	default:
-		jobStatus = lib.JOB_SUCCESS
-	}
-
-	if err = context.client.Internal.MarkJobAsFinished(context.jobID, jobStatus); err != nil {
-		log.Fatal(err)
+	if !jobFinished {
+		finishJob(context, ranVariants)
 	}
 	elapsed := time.Since(start)
 
 	log.WithFields(log.Fields{
 		"elapsed": elapsed,
 	}).Info("Job Orchestration finished")
+
+	// the exit code of the local builds reflects the job status
+	if local, ok := context.reporter.(*localReporter); ok && local.status != lib.JOB_SUCCESS {
+		if local.failure != nil {
+			log.Errorf("Job %s, %s\n", local.status, local.failure)
+		}
+		os.Exit(1)
+	}
+}
+
+// deploy runs the deploy of the job as a distinguished variant, after the other ones
+func deploy(context *context, agents *agentPool, deployer *variantData, variants []*variantData) *variantData {
+	log.Info("Starting deploy")
+	variant := &lib.Variant{
+		Started:   time.Now(),
+		Status:    lib.JOB_RUNNING,
+		Number:    len(variants),
+		ProjectID: context.projectID,
+		JobID:     context.jobID,
+		Metas:     deployer.meta,
+		Deploy:    true,
+	}
+	// the deploy runs where the image of the deployer variant was built
+	if deployer.host != nil {
+		variant.Agent = deployer.host.Name
+	}
+	variant, err := context.reporter.AddVariant(variant)
+	if err != nil {
+		abortJob(context, err)
+	}
+	vd := &variantData{
+		counter: "deploy",
+		meta:    deployer.meta,
+		variant: variant,
+	}
+
+	r := &Runner{
+		variants: variants,
+		context:  context,
+		ctx:      gocontext.Background(),
+		agents:   agents,
+	}
+	if err := r.Deploy(deployer, vd); err != nil {
+		log.Errorf("Deploy error %v\n", err)
+		vd.variant.Status = lib.JOB_ERRORED
+		vd.variant.Completed = time.Now()
+		vd.variant.Failure = failureOf(err)
+	}
+	log.WithFields(log.Fields{
+		"status": vd.variant.Status,
+	}).Info("Deploy Completed")
+
+	if err := context.reporter.MarkVariantAsFinished(vd.variant.ID, vd.variant.Status, vd.variant.Completed, nil, vd.variant.Failure); err != nil {
+		log.Errorf("Error while marking the deploy variant as finished: %v\n", err)
+	}
+	return vd
+}
+
+// finishJob aggregates the status of the finished variants into the job status, ignoring the variants allowed to fail
+func finishJob(context *context, variants []*variantData) {
+	jobStatus, counts := variantsStatus(variants)
+	log.WithFields(counts).Info("Job Completed")
+
+	if err := context.reporter.MarkJobAsFinished(context.jobID, jobStatus, jobFailure(variants)); err != nil {
+		log.Fatal(err)
+	}
 }
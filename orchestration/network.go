@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+// createNetwork creates the network of a variant, on which its build and service containers reach each other,
+// without any outbound access if the job is isolated. It returns the name of the network
+func (r *Runner) createNetwork(vd *variantData) (string, error) {
+	name := fmt.Sprintf("bazooka-%s-%s-%d", r.context.projectID, r.context.jobID, vd.variant.Number)
+	if _, err := r.api.CreateNetwork(dockerclient.CreateNetworkOptions{
+		Name:           name,
+		Driver:         "bridge",
+		Internal:       r.context.isolated,
+		CheckDuplicate: true,
+	}); err != nil {
+		return "", err
+	}
+
+	// the orchestration probes the services of the variant through their alias on this network,
+	// except on the build agents where the probes run in containers of the network
+	if len(vd.services) > 0 && r.agent == nil {
+		if err := r.api.ConnectNetwork(name, dockerclient.NetworkConnectionOptions{Container: orchestrationContainer()}); err != nil {
+			log.Errorf("Failed to connect the orchestration to the network %s, the services healthchecks will fail: %v\n", name, err)
+		}
+	}
+	return name, nil
+}
+
+// removeNetwork removes the network of a variant, once all its containers are removed
+func (r *Runner) removeNetwork(vd *variantData, name string) {
+	if len(vd.services) > 0 && r.agent == nil {
+		r.api.DisconnectNetwork(name, dockerclient.NetworkConnectionOptions{Container: orchestrationContainer(), Force: true})
+	}
+	if err := r.api.RemoveNetwork(name); err != nil {
+		log.Errorf("Error while removing the network %s: %v\n", name, err)
+	}
+}
+
+// run creates and starts a container attached to network under the given aliases
+func (r *Runner) run(name string, config *dockerclient.Config, hostConfig *dockerclient.HostConfig, network string, aliases ...string) (string, error) {
+	container, err := r.create(name, config, hostConfig, network, aliases...)
+	if err != nil {
+		return "", err
+	}
+	if err := r.api.StartContainer(container, nil); err != nil {
+		r.removeContainer(container)
+		return "", err
+	}
+	return container, nil
+}
+
+// create creates a container attached to network under the given aliases, without starting it
+func (r *Runner) create(name string, config *dockerclient.Config, hostConfig *dockerclient.HostConfig, network string, aliases ...string) (string, error) {
+	hostConfig.NetworkMode = network
+	container, err := r.api.CreateContainer(dockerclient.CreateContainerOptions{
+		Name:       name,
+		Config:     config,
+		HostConfig: hostConfig,
+		NetworkingConfig: &dockerclient.NetworkingConfig{
+			EndpointsConfig: map[string]*dockerclient.EndpointConfig{
+				network: {Aliases: aliases},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return container.ID, nil
+}
+
+func (r *Runner) removeContainer(id string) {
+	if err := r.api.RemoveContainer(dockerclient.RemoveContainerOptions{
+		ID:            id,
+		Force:         true,
+		RemoveVolumes: true,
+	}); err != nil {
+		log.WithFields(log.Fields{
+			"name":  id,
+			"error": err.Error(),
+		}).Error("Error while removing container, Be aware that this could cause container leaks")
+	}
+}
+
+// orchestrationContainer is the ID of the container running the orchestration, which Docker sets as its host name
+func orchestrationContainer() string {
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+func envList(env map[string]string) []string {
+	res := make([]string, 0, len(env))
+	for k, v := range env {
+		res = append(res, fmt.Sprintf("%s=%s", k, v))
+	}
+	return res
+}
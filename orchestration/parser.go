@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -24,6 +25,18 @@ type variantData struct {
 	variant    *lib.Variant
 	imageTag   string
 	services   []lib.Service
+	cache      lib.Dirs
+	resources  *lib.Resources
+	// the failure of this variant doesn't fail the job
+	allowFailure bool
+	// the name of the stage of the pipeline this variant belongs to, if any
+	stage string
+	// the deploy of the job, run in the image of this variant
+	deploy *lib.Deploy
+	// the labels of the build agents this variant is dispatched to, if any
+	agent *lib.AgentSelector
+	// the build agent the variant was dispatched to, nil for the Docker host of the server
+	host *lib.Agent
 }
 
 func (p *Parser) Parse() ([]*variantData, error) {
@@ -42,6 +55,10 @@ func (p *Parser) Parse() ([]*variantData, error) {
 		"image": image,
 	}).Info("Running Parsing Image on checked-out source")
 
+	if err := p.context.pullImage(image); err != nil {
+		return nil, err
+	}
+
 	env := map[string]string{
 		BazookaEnvApiUrl:        p.context.apiUrl,
 		BazookaEnvSyslogUrl:     p.context.syslogUrl,
@@ -51,6 +68,9 @@ func (p *Parser) Parse() ([]*variantData, error) {
 		BazookaEnvJobID:         p.context.jobID,
 		BazookaEnvJobParameters: p.context.jobParameters,
 	}
+	if p.context.local {
+		env[BazookaEnvLocal] = "1"
+	}
 
 	volumes := []string{
 		fmt.Sprintf("%s:/bazooka", paths.source.host),
@@ -64,12 +84,23 @@ func (p *Parser) Parse() ([]*variantData, error) {
 		env[BazookaEnvCryptoKeyfile] = paths.cryptoKey.host
 	}
 
+	// the parser pulls the language parser images from the private registries too
+	if len(paths.registries.host) > 0 {
+		volumes = append(volumes, fmt.Sprintf("%s:/bazooka-registries", paths.registries.host))
+		env[BazookaEnvRegistries] = paths.registries.host
+	}
+
+	reasonFile := filepath.Join(paths.work.container, lib.FailureReasonFile)
+	if err := clearContainerError(reasonFile); err != nil {
+		return nil, err
+	}
+
 	container, err := client.Run(&docker.RunOptions{
 		Image:               image,
 		Env:                 env,
 		VolumeBinds:         volumes,
 		Detach:              true,
-		LoggingDriver:       "syslog",
+		LoggingDriver:       p.context.loggingDriver(),
 		LoggingDriverConfig: p.context.loggerConfig(image, ""),
 	})
 	if err != nil {
@@ -78,12 +109,16 @@ func (p *Parser) Parse() ([]*variantData, error) {
 
 	defer lib.RemoveContainer(container)
 
+	if p.context.local {
+		container.Logs(image)
+	}
+
 	exitCode, err := container.Wait()
 	if err != nil {
 		return nil, err
 	}
 	if exitCode != 0 {
-		return nil, fmt.Errorf("Error during execution of Parser container %s/parser\n Check Docker container logs, id is %s\n", image, container.ID())
+		return nil, containerError(reasonFile, fmt.Errorf("Error during execution of Parser container %s/parser\n Check Docker container logs, id is %s\n", image, container.ID()))
 	}
 
 	log.WithFields(log.Fields{
@@ -120,6 +155,35 @@ func (p *Parser) variantsData() ([]*variantData, error) {
 						return nil, fmt.Errorf("Failed to parse services file %s: %v", fullName, err)
 					}
 					vf.services = servicesList
+				case "cache":
+					cache := lib.Dirs{}
+					if err := lib.Parse(fullName, &cache); err != nil {
+						return nil, fmt.Errorf("Failed to parse cache file %s: %v", fullName, err)
+					}
+					vf.cache = cache
+				case "resources":
+					vf.resources = &lib.Resources{}
+					if err := lib.Parse(fullName, vf.resources); err != nil {
+						return nil, fmt.Errorf("Failed to parse resources file %s: %v", fullName, err)
+					}
+				case "allow_failure":
+					if err := lib.Parse(fullName, &vf.allowFailure); err != nil {
+						return nil, fmt.Errorf("Failed to parse allow_failure file %s: %v", fullName, err)
+					}
+				case "stage":
+					if err := lib.Parse(fullName, &vf.stage); err != nil {
+						return nil, fmt.Errorf("Failed to parse stage file %s: %v", fullName, err)
+					}
+				case "deploy":
+					vf.deploy = &lib.Deploy{}
+					if err := lib.Parse(fullName, vf.deploy); err != nil {
+						return nil, fmt.Errorf("Failed to parse deploy file %s: %v", fullName, err)
+					}
+				case "agent":
+					vf.agent = &lib.AgentSelector{}
+					if err := lib.Parse(fullName, vf.agent); err != nil {
+						return nil, fmt.Errorf("Failed to parse agent file %s: %v", fullName, err)
+					}
 				default:
 					vf.scripts = append(vf.scripts, fullName)
 				}
@@ -143,12 +207,67 @@ func (p *Parser) variantsData() ([]*variantData, error) {
 	return output, nil
 }
 
+// matrixSettings reads the job-wide matrix settings written by the parser, if any
+func (p *Parser) matrixSettings() (*lib.ConfigMatrix, error) {
+	settings := &lib.ConfigMatrix{}
+	file := fmt.Sprintf("%s/matrix", p.context.paths.work.container)
+	exists, err := lib.FileExists(file)
+	if err != nil || !exists {
+		return settings, err
+	}
+	if err := lib.Parse(file, settings); err != nil {
+		return nil, fmt.Errorf("Failed to parse the matrix settings file %s: %v", file, err)
+	}
+	return settings, nil
+}
+
+// stages reads the names of the stages of the pipeline written by the parser, in order, if any
+func (p *Parser) stages() ([]string, error) {
+	var names []string
+	file := fmt.Sprintf("%s/stages", p.context.paths.work.container)
+	exists, err := lib.FileExists(file)
+	if err != nil || !exists {
+		return nil, err
+	}
+	if err := lib.Parse(file, &names); err != nil {
+		return nil, fmt.Errorf("Failed to parse the stages file %s: %v", file, err)
+	}
+	return names, nil
+}
+
+// securedValues collects the encrypted 'secure: <string>' env entries of the generated variants configurations
+func (p *Parser) securedValues() ([]string, error) {
+	files, err := lib.ListFilesWithPrefix(p.context.paths.work.container, ".bazooka")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list the generated configuration files: %v", err)
+	}
+
+	var res []string
+	for _, file := range files {
+		// the env entries are not parsed as lib.BzkString to avoid decrypting them
+		config := struct {
+			Env []interface{} `yaml:"env"`
+		}{}
+		if err := lib.Parse(file, &config); err != nil {
+			return nil, fmt.Errorf("Failed to parse the generated configuration file %s: %v", file, err)
+		}
+		for _, env := range config.Env {
+			if m, ok := env.(map[interface{}]interface{}); ok {
+				if secure, ok := m["secure"].(string); ok {
+					res = append(res, secure)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
 func (f *Parser) resolveImage() (string, error) {
-	image, err := f.context.client.Image.Get("parser")
+	image, err := f.context.image("parser")
 	if err != nil {
 		return "", fmt.Errorf("Unable to find Bazooka Docker Image for parser\n")
 	}
-	return image.Image, nil
+	return image, nil
 }
 
 func parseMeta(file string, vf *variantData) error {
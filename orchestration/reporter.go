@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
+)
+
+// reporter records the progress of the job: the bazooka server, or the terminal for the local builds
+type reporter interface {
+	AddJobSCMMetadata(jobID string, m *lib.SCMMetadata) error
+	SetJobSecuredValues(jobID string, secured []string) error
+	SetJobStages(jobID string, stages []*lib.JobStage) error
+	AddVariant(variant *lib.Variant) (*lib.Variant, error)
+	MarkVariantAsFinished(variantID string, status lib.JobStatus, completed time.Time, artifacts []string, failure *lib.Failure) error
+	MarkJobAsFinished(jobID string, status lib.JobStatus, failure *lib.Failure) error
+}
+
+// localReporter logs the progress of a local build, run without a bazooka server
+type localReporter struct {
+	sync.Mutex
+	variants int
+	// the job status and the reason why it did not succeed, once finished
+	status  lib.JobStatus
+	failure *lib.Failure
+}
+
+func (l *localReporter) AddJobSCMMetadata(jobID string, m *lib.SCMMetadata) error {
+	return nil
+}
+
+func (l *localReporter) SetJobSecuredValues(jobID string, secured []string) error {
+	return nil
+}
+
+func (l *localReporter) SetJobStages(jobID string, stages []*lib.JobStage) error {
+	return nil
+}
+
+func (l *localReporter) AddVariant(variant *lib.Variant) (*lib.Variant, error) {
+	l.Lock()
+	defer l.Unlock()
+	res := *variant
+	res.ID = fmt.Sprintf("local-%d", l.variants)
+	l.variants++
+	return &res, nil
+}
+
+func (l *localReporter) MarkVariantAsFinished(variantID string, status lib.JobStatus, completed time.Time, artifacts []string, failure *lib.Failure) error {
+	fields := log.Fields{
+		"variant":   variantID,
+		"status":    status,
+		"artifacts": artifacts,
+	}
+	if failure != nil {
+		fields["failure"] = failure.String()
+	}
+	log.WithFields(fields).Info("Variant finished")
+	return nil
+}
+
+func (l *localReporter) MarkJobAsFinished(jobID string, status lib.JobStatus, failure *lib.Failure) error {
+	l.Lock()
+	defer l.Unlock()
+	l.status = status
+	l.failure = failure
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalReporter(t *testing.T) {
+	r := &localReporter{}
+
+	first, err := r.AddVariant(&lib.Variant{Number: 0})
+	require.NoError(t, err)
+	second, err := r.AddVariant(&lib.Variant{Number: 1})
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.ID)
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Equal(t, 1, second.Number)
+
+	failure := &lib.Failure{Category: lib.FAILURE_SCRIPT, Reason: "The script exited with code 1"}
+	require.NoError(t, r.MarkJobAsFinished("local", lib.JOB_FAILED, failure))
+	assert.Equal(t, lib.JobStatus(lib.JOB_FAILED), r.status)
+	assert.Equal(t, failure, r.failure)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	lib "github.com/bazooka-ci/bazooka/commons"
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+// CFS scheduler period, in microseconds, the CPU quota of a container is relative to
+const cpuPeriod = 100000
+
+// limitHostConfig limits the containers created with hostConfig to limits, the memory limit including the swap
+func limitHostConfig(hostConfig *dockerclient.HostConfig, limits *lib.Resources) {
+	if limits.Memory > 0 {
+		hostConfig.Memory = int64(limits.Memory)
+		hostConfig.MemorySwap = int64(limits.Memory)
+	}
+	if limits.CPUs > 0 {
+		hostConfig.CPUPeriod = cpuPeriod
+		hostConfig.CPUQuota = int64(limits.CPUs * cpuPeriod)
+	}
+	if limits.Pids > 0 {
+		pids := limits.Pids
+		hostConfig.PidsLimit = &pids
+	}
+}
+
+// buildImageOptions returns the options of a docker build limited to the memory and CPUs of limits
+func buildImageOptions(tag, dockerfile, contextDir string, limits *lib.Resources) dockerclient.BuildImageOptions {
+	opts := dockerclient.BuildImageOptions{
+		Name:       tag,
+		Dockerfile: dockerfile,
+		ContextDir: contextDir,
+	}
+	if limits.Memory > 0 {
+		opts.Memory = int64(limits.Memory)
+		opts.Memswap = int64(limits.Memory)
+	}
+	if limits.CPUs > 0 {
+		opts.CPUPeriod = cpuPeriod
+		opts.CPUQuota = int64(limits.CPUs * cpuPeriod)
+	}
+	return opts
+}
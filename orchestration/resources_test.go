@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourcesOptions(t *testing.T) {
+	limits := &lib.Resources{Memory: 512 << 20, CPUs: 1.5, Pids: 100}
+
+	pids := int64(100)
+	hostConfig := &dockerclient.HostConfig{Binds: []string{"/host:/container"}}
+	limitHostConfig(hostConfig, limits)
+	assert.Equal(t, &dockerclient.HostConfig{
+		Binds:      []string{"/host:/container"},
+		Memory:     512 << 20,
+		MemorySwap: 512 << 20,
+		CPUPeriod:  100000,
+		CPUQuota:   150000,
+		PidsLimit:  &pids,
+	}, hostConfig)
+
+	assert.Equal(t, dockerclient.BuildImageOptions{
+		Name:       "bazooka-build/p-j-0",
+		Dockerfile: "work/0/Dockerfile",
+		ContextDir: "/bazooka",
+		Memory:     512 << 20,
+		Memswap:    512 << 20,
+		CPUPeriod:  100000,
+		CPUQuota:   150000,
+	}, buildImageOptions("bazooka-build/p-j-0", "work/0/Dockerfile", "/bazooka", limits))
+
+	hostConfig = &dockerclient.HostConfig{}
+	limitHostConfig(hostConfig, &lib.Resources{CPUs: 0.5})
+	assert.Equal(t, &dockerclient.HostConfig{CPUPeriod: 100000, CPUQuota: 50000}, hostConfig)
+}
@@ -1,63 +1,139 @@
 package main
 
 import (
+	gocontext "context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 
 	commons "github.com/bazooka-ci/bazooka/commons"
 	"github.com/bazooka-ci/bazooka/commons/parallel"
-	docker "github.com/bywan/go-dockercommand"
+	dockerclient "github.com/fsouza/go-dockerclient"
 )
 
 type Runner struct {
-	variants []*variantData
-	context  *context
-	client   *docker.Docker
+	variants  []*variantData
+	context   *context
+	api       *dockerclient.Client
+	cacheLock sync.Mutex
+	// the variants still running are stopped once ctx is done
+	ctx gocontext.Context
+	// if set, called as soon as all the variants not allowed to fail finished
+	requiredFinished func()
+	// the build agents the variants may be dispatched to
+	agents *agentPool
+	// the build agent the runner runs on, nil for the Docker host of the server
+	agent *commons.Agent
 }
 
 func (r *Runner) Run() error {
 	paths := r.context.paths
 
-	client, err := docker.NewDocker(paths.dockerEndpoint.container)
+	api, err := dockerclient.NewClient(paths.dockerEndpoint.container)
 	if err != nil {
 		return err
 	}
-	r.client = client
+	r.api = api
 
-	par := parallel.New()
+	par := parallel.NewWithContext(r.ctx, r.context.maxParallel)
 
+	required := newRequiredTracker(r.variants, r.requiredFinished)
 	for _, ivariant := range r.variants {
 		if ivariant.variant.Status != commons.JOB_RUNNING {
 			continue
 		}
 		variant := ivariant
 		par.Submit(func() error {
+			if variant.host != nil {
+				return r.runOnAgent(variant)
+			}
 			return r.runContainer(variant)
 		}, variant)
 	}
 
-	par.Exec(func(tag interface{}, err error) {
+	err = par.Exec(func(tag interface{}, err error) {
 		v := tag.(*variantData)
 		if err != nil {
+			err = runError(r.ctx, err)
 			log.Errorf("Run error %v for variant %v\n", err, v)
 			v.variant.Status = commons.JOB_ERRORED
+			v.variant.Failure = failureOf(err)
 		} else {
 			log.WithFields(log.Fields{
 				"variant": v.counter,
 			}).Info("Variant Completed")
 		}
 		v.variant.Completed = time.Now()
+		if err := r.context.reporter.MarkVariantAsFinished(v.variant.ID, v.variant.Status, v.variant.Completed, v.variant.Artifacts, v.variant.Failure); err != nil {
+			log.Errorf("Error while marking variant %v as finished: %v\n", v.counter, err)
+		}
+
+		required.done(v)
 	})
 
+	if err != nil {
+		log.Errorf("Variant runs failed: %v\n", err)
+	}
 	log.Info("Dockerfiles builds finished")
-	return nil
+	return unrecordedError(err)
+}
+
+// requiredTracker calls finished once all the run variants not allowed to fail finished.
+// When all of them are allowed to fail, finished is never called: the job status is decided once they all finished
+type requiredTracker struct {
+	remaining int
+	finished  func()
+}
+
+func newRequiredTracker(variants []*variantData, finished func()) *requiredTracker {
+	t := &requiredTracker{finished: finished}
+	for _, vd := range variants {
+		if vd.variant.Status == commons.JOB_RUNNING && !vd.allowFailure {
+			t.remaining++
+		}
+	}
+	return t
+}
+
+// done is called as each variant finishes
+func (t *requiredTracker) done(vd *variantData) {
+	if vd.allowFailure || t.finished == nil || t.remaining == 0 {
+		return
+	}
+	t.remaining--
+	if t.remaining == 0 {
+		t.finished()
+	}
+}
+
+// variantVolumes returns the volumes bound in the container of a variant running on the server host.
+// The Docker socket gives a way out of the network of the variant: isolated variants can't use Docker
+func (r *Runner) variantVolumes(hostArtifactsFolder string) []string {
+	return append([]string{fmt.Sprintf("%s:/artifacts", hostArtifactsFolder)}, r.dockerSockVolumes()...)
+}
+
+// deployVolumes returns the volumes bound in the deploy container run on the server host:
+// the artifacts of the variants, read-only in /artifacts/<variant number>, and the Docker socket unless the job is isolated
+func (r *Runner) deployVolumes() []string {
+	volumes := r.dockerSockVolumes()
+	for _, vd := range r.variants {
+		volumes = append(volumes, fmt.Sprintf("%s/%s:/artifacts/%d:ro", r.context.paths.artifacts.host, vd.variant.ID, vd.variant.Number))
+	}
+	return volumes
+}
+
+func (r *Runner) dockerSockVolumes() []string {
+	if r.context.isolated {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s:/var/run/docker.sock", r.context.paths.dockerSock.host)}
 }
 
 func (r *Runner) runContainer(vd *variantData) error {
@@ -65,37 +141,43 @@ func (r *Runner) runContainer(vd *variantData) error {
 
 	success := true
 
-	serviceContainers := []*docker.Container{}
-	containerLinks := []string{}
-	for sidx, service := range vd.services {
+	limits := vd.resources.Cap(r.context.maxResources)
+
+	network, err := r.createNetwork(vd)
+	if err != nil {
+		return fmt.Errorf("Failed to create the network of the variant: %v", err)
+	}
+	// runs once all the containers of the variant are removed
+	defer r.removeNetwork(vd, network)
+
+	serviceContainers := []string{}
+	for sidx := range vd.services {
+		service := &vd.services[sidx]
 		name := fmt.Sprintf("bazooka-service-%s-%s-%d-%d", r.context.projectID, r.context.jobID, vd.variant.Number, sidx)
 		if len(service.Alias) == 0 {
 			service.Alias = safeDockerAlias(strings.Split(service.Image, ":")[0])
 		}
-		containerLinks = append(containerLinks, fmt.Sprintf("%s:%s", name, service.Alias))
-		serviceContainer, err := r.client.Run(&docker.RunOptions{
-			Name:   name,
-			Image:  service.Image,
-			Detach: true,
-		})
+		serviceContainer, err := r.startService(name, network, service, limits)
 		if err != nil {
-			return err
+			return fail(commons.FAILURE_SERVICE, err)
 		}
-		defer commons.RemoveContainer(serviceContainer)
+		defer r.removeContainer(serviceContainer)
 		serviceContainers = append(serviceContainers, serviceContainer)
 	}
 
+	// the build only starts once all the services are ready
+	for sidx := range vd.services {
+		if err := r.waitForService(vd, network, serviceContainers[sidx], &vd.services[sidx]); err != nil {
+			return fail(commons.FAILURE_SERVICE, err)
+		}
+	}
+
 	hostArtifactsFolder := fmt.Sprintf("%s/%s", paths.artifacts.host, vd.variant.ID)
 	containerArtifactsFolder := fmt.Sprintf("%s/%s", paths.artifacts.container, vd.variant.ID)
 
-	container, err := r.client.Run(&docker.RunOptions{
+	config := &dockerclient.Config{
 		Image: vd.imageTag,
-		Links: containerLinks,
-		VolumeBinds: []string{
-			fmt.Sprintf("%s:/var/run/docker.sock", paths.dockerSock.host),
-			fmt.Sprintf("%s:/artifacts", hostArtifactsFolder),
-		},
-		Env: map[string]string{
+		Env: envList(map[string]string{
 			BazookaEnvSCM:           r.context.scm,
 			BazookaEnvSCMUrl:        r.context.scmUrl,
 			BazookaEnvSCMReference:  r.context.scmReference,
@@ -103,23 +185,83 @@ func (r *Runner) runContainer(vd *variantData) error {
 			BazookaEnvJobID:         r.context.jobID,
 			BazookaEnvJobParameters: r.context.jobParameters,
 			"BZK_VARIANT":           strconv.Itoa(vd.variant.Number),
+		}),
+	}
+
+	// the folders of the server are out of reach of the agents: the artifacts are copied back once the variant finished
+	var volumes []string
+	var cacheSave string
+	if r.agent != nil {
+		config.Volumes = map[string]struct{}{"/artifacts": {}}
+		if len(vd.cache) > 0 {
+			log.WithFields(log.Fields{
+				"variant": vd.counter,
+				"agent":   r.agent.Name,
+			}).Warn("The cached directories are not available on build agents")
+		}
+	} else {
+		volumes = r.variantVolumes(hostArtifactsFolder)
+		cacheVolumes, save, err := r.cacheVolumes(vd)
+		if err != nil {
+			return fmt.Errorf("Error while preparing the cache: %v", err)
+		}
+		volumes = append(volumes, cacheVolumes...)
+		cacheSave = save
+	}
+	if len(cacheSave) > 0 {
+		// runs once the container is removed, whatever the outcome of the variant
+		defer func() {
+			if err := r.storeCache(cacheSave, vd.variant.Status == commons.JOB_SUCCESS); err != nil {
+				log.Errorf("Error while storing the cache of variant %v: %v\n", vd.counter, err)
+			}
+		}()
+	}
+
+	hostConfig := &dockerclient.HostConfig{
+		Binds: volumes,
+		LogConfig: dockerclient.LogConfig{
+			Type:   r.context.loggingDriver(),
+			Config: r.context.loggerConfig(vd.imageTag, vd.variant.ID),
 		},
-		Detach:              true,
-		LoggingDriver:       "syslog",
-		LoggingDriverConfig: r.context.loggerConfig(vd.imageTag, vd.variant.ID),
-	})
+	}
+	limitHostConfig(hostConfig, limits)
+
+	// named after the project so that deleting it can stop the variants still running
+	name := fmt.Sprintf("bazooka-variant-%s-%s-%d", r.context.projectID, r.context.jobID, vd.variant.Number)
+	container, err := r.run(name, config, hostConfig, network)
 	if err != nil {
 		return err
 	}
-	defer commons.RemoveContainer(container)
+	defer r.removeContainer(container)
+
+	if r.context.local {
+		go r.streamLogs(container)
+	}
+
+	// stop the container if the job no longer needs this variant
+	waited := make(chan struct{})
+	defer close(waited)
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			if err := r.api.StopContainer(container, 10); err != nil {
+				log.Errorf("Error while stopping the container of variant %v: %v\n", vd.counter, err)
+			}
+		case <-waited:
+		}
+	}()
 
-	exitCode, err := container.Wait()
+	exitCode, err := r.api.WaitContainer(container)
 	if err != nil {
 		return err
 	}
+	if r.ctx.Err() != nil {
+		return fail(commons.FAILURE_CANCELLED, fmt.Errorf("Run cancelled once the job status was decided"))
+	}
 	if exitCode != 0 {
+		// bazooka_run.sh exits with 42 when the before_install, install or before_script phase failed
 		if exitCode == 42 {
-			return fmt.Errorf("Run failed\n Check Docker container logs, id is %s\n", container.ID())
+			return fail(commons.FAILURE_SETUP_PHASE, fmt.Errorf("A setup phase (before_install, install or before_script) failed\n Check Docker container logs, id is %s\n", container))
 		}
 		success = false
 	}
@@ -128,6 +270,16 @@ func (r *Runner) runContainer(vd *variantData) error {
 		vd.variant.Status = commons.JOB_SUCCESS
 	} else {
 		vd.variant.Status = commons.JOB_FAILED
+		vd.variant.Failure = &commons.Failure{
+			Category: commons.FAILURE_SCRIPT,
+			Reason:   fmt.Sprintf("The script exited with code %d", exitCode),
+		}
+	}
+
+	if r.agent != nil {
+		if err := r.downloadArtifacts(container, containerArtifactsFolder); err != nil {
+			return fmt.Errorf("Error while copying the artifacts from agent %s: %v", r.agent.Name, err)
+		}
 	}
 
 	// Capture the artifacts list
@@ -156,6 +308,20 @@ func (r *Runner) runContainer(vd *variantData) error {
 	return nil
 }
 
+// streamLogs prints the output of a container of a local build, until it exits
+func (r *Runner) streamLogs(container string) {
+	if err := r.api.Logs(dockerclient.LogsOptions{
+		Container:    container,
+		Follow:       true,
+		Stdout:       true,
+		Stderr:       true,
+		OutputStream: os.Stdout,
+		ErrorStream:  os.Stderr,
+	}); err != nil {
+		log.Errorf("Error while streaming the logs of container %s: %v\n", container, err)
+	}
+}
+
 func safeDockerAlias(unsafeAlias string) string {
 	re := regexp.MustCompile("(/|;|:|-|\\.)")
 	return re.ReplaceAllString(unsafeAlias, "_")
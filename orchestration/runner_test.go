@@ -3,6 +3,7 @@ package main
 import (
 	"testing"
 
+	commons "github.com/bazooka-ci/bazooka/commons"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,3 +15,62 @@ func TestParser(t *testing.T) {
 	assert.Equal(t, "bazooka_test", safeDockerAlias("bazooka:test"))
 	assert.Equal(t, "baz_o_oka_te_st_bzk", safeDockerAlias("baz.o-oka/te:st-bzk"))
 }
+
+func TestVariantVolumes(t *testing.T) {
+	r := &Runner{context: &context{paths: paths{dockerSock: path{"/var/run/docker.sock", "/run/docker.sock"}}}}
+	assert.Equal(t, []string{"/bazooka/artifacts/v1:/artifacts", "/run/docker.sock:/var/run/docker.sock"}, r.variantVolumes("/bazooka/artifacts/v1"))
+
+	r.context.isolated = true
+	assert.Equal(t, []string{"/bazooka/artifacts/v1:/artifacts"}, r.variantVolumes("/bazooka/artifacts/v1"))
+}
+
+func TestDeployVolumes(t *testing.T) {
+	r := &Runner{
+		context: &context{paths: paths{
+			dockerSock: path{"/var/run/docker.sock", "/run/docker.sock"},
+			artifacts:  path{"/bazooka/artifacts", "/home/bzk/build/p/j/artifacts"},
+		}},
+		variants: []*variantData{
+			{variant: &commons.Variant{ID: "v0", Number: 0}},
+			{variant: &commons.Variant{ID: "v1", Number: 1}},
+		},
+	}
+	assert.Equal(t, []string{
+		"/run/docker.sock:/var/run/docker.sock",
+		"/home/bzk/build/p/j/artifacts/v0:/artifacts/0:ro",
+		"/home/bzk/build/p/j/artifacts/v1:/artifacts/1:ro",
+	}, r.deployVolumes())
+
+	r.context.isolated = true
+	assert.Equal(t, []string{
+		"/home/bzk/build/p/j/artifacts/v0:/artifacts/0:ro",
+		"/home/bzk/build/p/j/artifacts/v1:/artifacts/1:ro",
+	}, r.deployVolumes())
+}
+
+func TestRequiredTracker(t *testing.T) {
+	running := func(allowFailure bool) *variantData {
+		return &variantData{variant: &commons.Variant{Status: commons.JOB_RUNNING}, allowFailure: allowFailure}
+	}
+
+	// all the variants are allowed to fail: nothing decides the job status before they all finished
+	calls := 0
+	allowed := []*variantData{running(true), running(true)}
+	tracker := newRequiredTracker(allowed, func() { calls++ })
+	for _, vd := range allowed {
+		tracker.done(vd)
+	}
+	assert.Equal(t, 0, calls)
+
+	errored := running(false)
+	errored.variant.Status = commons.JOB_ERRORED
+	variants := []*variantData{running(false), running(true), running(false), errored}
+	tracker = newRequiredTracker(variants, func() { calls++ })
+	tracker.done(variants[0])
+	tracker.done(variants[1])
+	assert.Equal(t, 0, calls)
+	tracker.done(variants[2])
+	assert.Equal(t, 1, calls, "called once the last required variant finished")
+
+	newRequiredTracker(variants, nil).done(variants[0])
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 
 	log "github.com/Sirupsen/logrus"
 	lib "github.com/bazooka-ci/bazooka/commons"
@@ -28,6 +29,10 @@ func (f *SCMFetcher) Fetch() error {
 		"image": image,
 	}).Info("Starting SCM Fetch")
 
+	if err := f.context.pullImage(image); err != nil {
+		return err
+	}
+
 	client, err := docker.NewDocker(paths.dockerEndpoint.container)
 	if err != nil {
 		return err
@@ -47,18 +52,24 @@ func (f *SCMFetcher) Fetch() error {
 	volumes := []string{
 		fmt.Sprintf("%s:/bazooka", paths.source.host),
 		fmt.Sprintf("%s:/meta", paths.meta.host),
+		fmt.Sprintf("%s:/bazooka-output", paths.work.host),
 	}
 	scmKeyFile := paths.scmKey.host
 	if len(scmKeyFile) > 0 {
 		volumes = append(volumes, fmt.Sprintf("%s:/bazooka-key", scmKeyFile))
 	}
 
+	reasonFile := filepath.Join(paths.work.container, lib.FailureReasonFile)
+	if err := clearContainerError(reasonFile); err != nil {
+		return err
+	}
+
 	container, err := client.Run(&docker.RunOptions{
 		Image:               image,
 		VolumeBinds:         volumes,
 		Env:                 env,
 		Detach:              true,
-		LoggingDriver:       "syslog",
+		LoggingDriver:       f.context.loggingDriver(),
 		LoggingDriverConfig: f.context.loggerConfig(image, ""),
 	})
 	if err != nil {
@@ -72,7 +83,7 @@ func (f *SCMFetcher) Fetch() error {
 		return err
 	}
 	if exitCode != 0 {
-		return fmt.Errorf("Error during execution of SCM container %s\n Check Docker container logs, id is %s\n", image, container.ID())
+		return containerError(reasonFile, fmt.Errorf("Error during execution of SCM container %s\n Check Docker container logs, id is %s\n", image, container.ID()))
 	}
 
 	log.WithFields(log.Fields{
@@ -87,7 +98,7 @@ func (f *SCMFetcher) Fetch() error {
 		return err
 	}
 
-	err = f.context.client.Internal.AddJobSCMMetadata(f.context.jobID, scmMetadata)
+	err = f.context.reporter.AddJobSCMMetadata(f.context.jobID, scmMetadata)
 	if err != nil {
 		return err
 	}
@@ -95,9 +106,9 @@ func (f *SCMFetcher) Fetch() error {
 }
 
 func (f *SCMFetcher) resolveImage() (string, error) {
-	image, err := f.context.client.Image.Get(fmt.Sprintf("scm/fetch/%s", f.context.scm))
+	image, err := f.context.image(fmt.Sprintf("scm/fetch/%s", f.context.scm))
 	if err != nil {
 		return "", fmt.Errorf("Unable to find Bazooka Docker Image for SCM %s\n, error is %v", f.context.scm, err)
 	}
-	return image.Image, nil
+	return image, nil
 }
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	commons "github.com/bazooka-ci/bazooka/commons"
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	defaultServiceTimeout = 60 * time.Second
+	serviceProbeInterval  = time.Second
+	// number of lines of the logs of a service shown when it never becomes ready
+	serviceLogsTail = "100"
+	// the image of the containers probing the services of the variants run on build agents
+	probeImage = "busybox:latest"
+)
+
+// startService runs the container of a service on the network of its variant, reachable under its alias
+func (r *Runner) startService(name, network string, service *commons.Service, limits *commons.Resources) (string, error) {
+	ports, err := portBindings(service.Ports)
+	if err != nil {
+		return "", fmt.Errorf("Invalid ports of service %s: %v", service.Alias, err)
+	}
+	exposed := map[dockerclient.Port]struct{}{}
+	for port := range ports {
+		exposed[port] = struct{}{}
+	}
+
+	hostConfig := &dockerclient.HostConfig{PortBindings: ports}
+	limitHostConfig(hostConfig, limits)
+
+	if err := r.context.registries.PullImage(r.api, service.Image); err != nil {
+		return "", fmt.Errorf("Failed to pull the image %s of service %s: %v", service.Image, service.Alias, err)
+	}
+
+	return r.run(name, &dockerclient.Config{
+		Image:        service.Image,
+		Cmd:          service.Command,
+		Env:          service.Env,
+		ExposedPorts: exposed,
+	}, hostConfig, network, service.Alias)
+}
+
+// waitForService blocks until the healthcheck of the service passes.
+// If it doesn't before its timeout, the last logs of the service are logged and an error is returned
+func (r *Runner) waitForService(vd *variantData, network, containerID string, service *commons.Service) error {
+	check := service.Healthcheck
+	if check == nil {
+		return nil
+	}
+	if len(check.Command) == 0 && check.Port <= 0 {
+		return fmt.Errorf("The healthcheck of service %s (%s) needs a port to probe or a command to run", service.Alias, service.Image)
+	}
+
+	timeout := defaultServiceTimeout
+	if check.Timeout > 0 {
+		timeout = time.Duration(check.Timeout) * time.Second
+	}
+
+	// the orchestration is attached to the network of the variant, unless it runs on a build agent.
+	// It is attached to the networks of the other variants as well, whose services may have the same alias:
+	// the service is reached at its address on the network of its variant
+	var ip string
+	if check.Port > 0 {
+		container, err := r.api.InspectContainer(containerID)
+		if err != nil {
+			return err
+		}
+		if ip, err = networkIP(container, network); err != nil {
+			return fmt.Errorf("Service %s (%s): %v", service.Alias, service.Image, err)
+		}
+	}
+	addr := net.JoinHostPort(ip, strconv.Itoa(check.Port))
+	url := fmt.Sprintf("http://%s/%s", addr, strings.TrimPrefix(check.HTTP, "/"))
+	var probe func() error
+	switch {
+	case len(check.Command) > 0:
+		probe = r.commandProbe(containerID, check.Command)
+	case r.agent != nil:
+		if err := r.api.PullImage(dockerclient.PullImageOptions{Repository: probeImage}, dockerclient.AuthConfiguration{}); err != nil {
+			log.Errorf("Failed to pull the probe image %s on agent %s: %v\n", probeImage, r.agent.Name, err)
+		}
+		if len(check.HTTP) > 0 {
+			probe = r.containerProbe(network, "wget", "-q", "-T", "1", "-O", "/dev/null", url)
+		} else {
+			probe = r.containerProbe(network, "nc", "-z", "-w", "1", ip, strconv.Itoa(check.Port))
+		}
+	case len(check.HTTP) > 0:
+		probe = httpProbe(url)
+	default:
+		probe = tcpProbe(addr)
+	}
+
+	log.WithFields(log.Fields{
+		"variant": vd.counter,
+		"service": service.Alias,
+	}).Info("Waiting for service to be ready")
+
+	if err := waitReady(probe, timeout, serviceProbeInterval); err != nil {
+		var logs bytes.Buffer
+		if logsErr := r.api.Logs(dockerclient.LogsOptions{
+			Container:    containerID,
+			OutputStream: &logs,
+			ErrorStream:  &logs,
+			Stdout:       true,
+			Stderr:       true,
+			Tail:         serviceLogsTail,
+		}); logsErr != nil {
+			log.Errorf("Failed to retrieve the logs of service %s: %v\n", service.Alias, logsErr)
+		}
+		log.WithFields(log.Fields{
+			"variant": vd.counter,
+			"service": service.Alias,
+		}).Errorf("Service never became ready, its last logs are:\n%s", logs.String())
+		return fail(commons.FAILURE_TIMEOUT, fmt.Errorf("Service %s (%s) never became ready: %v", service.Alias, service.Image, err))
+	}
+	return nil
+}
+
+// networkIP returns the IP address of a container on a network
+func networkIP(container *dockerclient.Container, network string) (string, error) {
+	if container.NetworkSettings != nil {
+		if endpoint, attached := container.NetworkSettings.Networks[network]; attached && len(endpoint.IPAddress) > 0 {
+			return endpoint.IPAddress, nil
+		}
+	}
+	return "", fmt.Errorf("the container %s has no address on the network %s", container.ID, network)
+}
+
+// waitReady calls probe every interval until it succeeds, or fails with its last error once timeout elapsed
+func waitReady(probe func() error, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := probe()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not ready after %v: %v", timeout, err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func tcpProbe(addr string) func() error {
+	return func() error {
+		conn, err := net.DialTimeout("tcp", addr, serviceProbeInterval)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+func httpProbe(url string) func() error {
+	client := &http.Client{Timeout: serviceProbeInterval}
+	return func() error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("%s answered with status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// containerProbe runs the command in a container of the network of a variant run on a build agent
+func (r *Runner) containerProbe(network string, command ...string) func() error {
+	return func() error {
+		container, err := r.run("", &dockerclient.Config{
+			Image: probeImage,
+			Cmd:   command,
+		}, &dockerclient.HostConfig{}, network)
+		if err != nil {
+			return err
+		}
+		defer r.removeContainer(container)
+		exitCode, err := r.api.WaitContainer(container)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("%s exited with %d", strings.Join(command, " "), exitCode)
+		}
+		return nil
+	}
+}
+
+// commandProbe runs the command with sh in the container
+func (r *Runner) commandProbe(containerID, command string) func() error {
+	return func() error {
+		exec, err := r.api.CreateExec(dockerclient.CreateExecOptions{
+			Container:    containerID,
+			Cmd:          []string{"sh", "-c", command},
+			AttachStdout: true,
+			AttachStderr: true,
+		})
+		if err != nil {
+			return err
+		}
+		var output bytes.Buffer
+		if err := r.api.StartExec(exec.ID, dockerclient.StartExecOptions{
+			OutputStream: &output,
+			ErrorStream:  &output,
+		}); err != nil {
+			return err
+		}
+		info, err := r.api.InspectExec(exec.ID)
+		if err != nil {
+			return err
+		}
+		if info.ExitCode != 0 {
+			return fmt.Errorf("%s exited with %d: %s", command, info.ExitCode, strings.TrimSpace(output.String()))
+		}
+		return nil
+	}
+}
+
+// portBindings parses the ports of a service, either "container port", "host port:container port"
+// or "host ip:host port:container port", the container port being optionally suffixed with the protocol, e.g. "53/udp"
+func portBindings(ports []string) (map[dockerclient.Port][]dockerclient.PortBinding, error) {
+	if len(ports) == 0 {
+		return nil, nil
+	}
+	res := map[dockerclient.Port][]dockerclient.PortBinding{}
+	for _, port := range ports {
+		parts := strings.Split(port, ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid port %q", port)
+		}
+		containerPort := parts[len(parts)-1]
+		if len(containerPort) == 0 {
+			return nil, fmt.Errorf("missing container port in %q", port)
+		}
+		if !strings.Contains(containerPort, "/") {
+			containerPort += "/tcp"
+		}
+		binding := dockerclient.PortBinding{}
+		if len(parts) > 1 {
+			binding.HostPort = parts[len(parts)-2]
+		}
+		if len(parts) > 2 {
+			binding.HostIP = parts[0]
+		}
+		key := dockerclient.Port(containerPort)
+		res[key] = append(res[key], binding)
+	}
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitReady(t *testing.T) {
+	calls := 0
+	err := waitReady(func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, time.Second, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	err = waitReady(func() error {
+		return errors.New("connection refused")
+	}, 10*time.Millisecond, time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+}
+
+func TestProbes(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	assert.NoError(t, tcpProbe(addr)())
+	listener.Close()
+	assert.Error(t, tcpProbe(addr)())
+
+	var ready int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&ready) == 0 || r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	assert.Error(t, httpProbe(server.URL+"/health")())
+	atomic.StoreInt32(&ready, 1)
+	assert.NoError(t, httpProbe(server.URL+"/health")())
+}
+
+func TestPortBindings(t *testing.T) {
+	bindings, err := portBindings([]string{"5432", "8080:80", "53/udp", "127.0.0.1:9000:9000"})
+	require.NoError(t, err)
+	assert.Equal(t, map[dockerclient.Port][]dockerclient.PortBinding{
+		"5432/tcp": {{HostPort: ""}},
+		"80/tcp":   {{HostPort: "8080"}},
+		"53/udp":   {{HostPort: ""}},
+		"9000/tcp": {{HostIP: "127.0.0.1", HostPort: "9000"}},
+	}, bindings)
+
+	_, err = portBindings([]string{"8080:"})
+	assert.Error(t, err)
+	_, err = portBindings([]string{"0.0.0.0:1:2:3"})
+	assert.Error(t, err)
+}
+
+func TestNetworkIP(t *testing.T) {
+	// two variants of a job run at once, each with a postgres service on its own network
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer first.Close()
+	_, port, err := net.SplitHostPort(first.Addr().String())
+	require.NoError(t, err)
+	second, err := net.Listen("tcp", net.JoinHostPort("127.0.0.2", port))
+	if err != nil {
+		t.Skipf("no second loopback address: %v", err)
+	}
+	defer second.Close()
+
+	services := map[string]*dockerclient.Container{
+		"bazooka-p-j-0": {ID: "postgres-0", NetworkSettings: &dockerclient.NetworkSettings{Networks: map[string]dockerclient.ContainerNetwork{
+			"bazooka-p-j-0": {IPAddress: "127.0.0.1", Aliases: []string{"postgres"}},
+		}}},
+		"bazooka-p-j-1": {ID: "postgres-1", NetworkSettings: &dockerclient.NetworkSettings{Networks: map[string]dockerclient.ContainerNetwork{
+			"bazooka-p-j-1": {IPAddress: "127.0.0.2", Aliases: []string{"postgres"}},
+		}}},
+	}
+	accepted := func(listener net.Listener) <-chan string {
+		peers := make(chan string, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				close(peers)
+				return
+			}
+			peers <- conn.LocalAddr().String()
+			conn.Close()
+		}()
+		return peers
+	}
+	firstPeers, secondPeers := accepted(first), accepted(second)
+
+	probed := make(chan error, len(services))
+	for network, container := range services {
+		ip, err := networkIP(container, network)
+		require.NoError(t, err)
+		go func(addr string) {
+			probed <- tcpProbe(addr)()
+		}(net.JoinHostPort(ip, port))
+	}
+	for range services {
+		assert.NoError(t, <-probed)
+	}
+	assert.Equal(t, first.Addr().String(), <-firstPeers, "each variant probes its own service")
+	assert.Equal(t, net.JoinHostPort("127.0.0.2", port), <-secondPeers)
+
+	_, err = networkIP(services["bazooka-p-j-0"], "bazooka-p-j-1")
+	assert.Error(t, err, "the service of a variant is not reached through the network of another one")
+	_, err = networkIP(&dockerclient.Container{ID: "stopped"}, "bazooka-p-j-0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
+)
+
+// stage is a step of the pipeline of the job, whose variants are only run once those of the previous stages succeeded
+type stage struct {
+	status   *lib.JobStage
+	variants []*variantData
+}
+
+// groupStages dispatches the variants into the stages, in the order of their names.
+// Without stage names, all the variants belong to a single unnamed stage
+func groupStages(names []string, variants []*variantData) ([]*stage, error) {
+	if len(names) == 0 {
+		return []*stage{{status: &lib.JobStage{}, variants: variants}}, nil
+	}
+
+	res := make([]*stage, len(names))
+	byName := make(map[string]*stage, len(names))
+	for i, name := range names {
+		res[i] = &stage{status: &lib.JobStage{Name: name}}
+		byName[name] = res[i]
+	}
+	for _, vd := range variants {
+		st, found := byName[vd.stage]
+		if !found {
+			return nil, fmt.Errorf("The variant %s belongs to an unknown stage '%s'", vd.counter, vd.stage)
+		}
+		st.variants = append(st.variants, vd)
+	}
+	return res, nil
+}
+
+// reportStages lets the server know the status of the named stages of the job
+func reportStages(context *context, stages []*stage) error {
+	statuses := make([]*lib.JobStage, 0, len(stages))
+	for _, st := range stages {
+		if len(st.status.Name) > 0 {
+			statuses = append(statuses, st.status)
+		}
+	}
+	if len(statuses) == 0 {
+		return nil
+	}
+	return context.reporter.SetJobStages(context.jobID, statuses)
+}
+
+// variantsStatus aggregates the status of the finished variants, ignoring the variants allowed to fail
+func variantsStatus(variants []*variantData) (lib.JobStatus, log.Fields) {
+	var (
+		errorCount   = 0
+		successCount = 0
+		failCount    = 0
+		allowedCount = 0
+	)
+	for _, vd := range variants {
+		if vd.allowFailure {
+			allowedCount++
+			continue
+		}
+		switch vd.variant.Status {
+		case lib.JOB_ERRORED:
+			errorCount++
+		case lib.JOB_SUCCESS:
+			successCount++
+		case lib.JOB_FAILED:
+			failCount++
+		default:
+			log.Fatal(fmt.Errorf("Found a variant without a status %v", vd))
+		}
+	}
+
+	counts := log.Fields{
+		"ERRORED":         strconv.Itoa(errorCount),
+		"SUCCEEDED":       strconv.Itoa(successCount),
+		"FAILED":          strconv.Itoa(failCount),
+		"ALLOWED_TO_FAIL": strconv.Itoa(allowedCount),
+	}
+
+	switch {
+	case errorCount > 0:
+		return lib.JOB_ERRORED, counts
+	case failCount > 0:
+		return lib.JOB_FAILED, counts
+	default:
+		return lib.JOB_SUCCESS, counts
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupStages(t *testing.T) {
+	build := &variantData{counter: "s00", stage: "build"}
+	unit := &variantData{counter: "s10", stage: "test"}
+	integration := &variantData{counter: "s11", stage: "test"}
+
+	stages, err := groupStages(nil, []*variantData{build, unit})
+	require.NoError(t, err)
+	require.Len(t, stages, 1)
+	assert.Equal(t, "", stages[0].status.Name)
+	assert.Equal(t, []*variantData{build, unit}, stages[0].variants)
+
+	stages, err = groupStages([]string{"build", "test", "deploy"}, []*variantData{build, unit, integration})
+	require.NoError(t, err)
+	require.Len(t, stages, 3)
+	assert.Equal(t, "build", stages[0].status.Name)
+	assert.Equal(t, []*variantData{build}, stages[0].variants)
+	assert.Equal(t, "test", stages[1].status.Name)
+	assert.Equal(t, []*variantData{unit, integration}, stages[1].variants)
+	assert.Equal(t, "deploy", stages[2].status.Name)
+	assert.Empty(t, stages[2].variants)
+
+	_, err = groupStages([]string{"build"}, []*variantData{build, unit})
+	assert.Error(t, err)
+}
+
+func TestVariantsStatus(t *testing.T) {
+	withStatus := func(status lib.JobStatus, allowFailure bool) *variantData {
+		return &variantData{variant: &lib.Variant{Status: status}, allowFailure: allowFailure}
+	}
+
+	status, _ := variantsStatus(nil)
+	assert.Equal(t, lib.JobStatus(lib.JOB_SUCCESS), status)
+
+	status, _ = variantsStatus([]*variantData{withStatus(lib.JOB_SUCCESS, false), withStatus(lib.JOB_FAILED, true)})
+	assert.Equal(t, lib.JobStatus(lib.JOB_SUCCESS), status)
+
+	status, _ = variantsStatus([]*variantData{withStatus(lib.JOB_FAILED, false), withStatus(lib.JOB_SUCCESS, false)})
+	assert.Equal(t, lib.JobStatus(lib.JOB_FAILED), status)
+
+	status, counts := variantsStatus([]*variantData{withStatus(lib.JOB_FAILED, false), withStatus(lib.JOB_ERRORED, false)})
+	assert.Equal(t, lib.JobStatus(lib.JOB_ERRORED), status)
+	assert.Equal(t, "1", counts["FAILED"])
+}
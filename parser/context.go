@@ -10,6 +10,7 @@ import (
 
 	"github.com/bazooka-ci/bazooka/client"
 	lib "github.com/bazooka-ci/bazooka/commons"
+	dockerclient "github.com/fsouza/go-dockerclient"
 )
 
 const (
@@ -21,6 +22,8 @@ const (
 	BazookaEnvDockerSock    = "BZK_DOCKERSOCK"
 	BazookaEnvProjectID     = "BZK_PROJECT_ID"
 	BazookaEnvJobID         = "BZK_JOB_ID"
+	BazookaEnvLocal         = "BZK_LOCAL"
+	BazookaEnvRegistries    = "BZK_REGISTRY_CREDENTIALS"
 )
 
 type context struct {
@@ -29,7 +32,10 @@ type context struct {
 	projectID     string
 	jobID         string
 	jobParameters string
-	paths         paths
+	local         bool
+	// the credentials pulling the images of the private registries
+	registries lib.RegistryCredentials
+	paths      paths
 }
 
 type paths struct {
@@ -37,6 +43,7 @@ type paths struct {
 	output         path
 	meta           path
 	cryptoKey      path
+	registries     path
 	dockerSock     path
 	dockerEndpoint path
 }
@@ -54,24 +61,59 @@ func initContext() *context {
 	if err != nil {
 		log.Fatal(err)
 	}
-	return &context{
+	c := &context{
 		client:        client,
 		syslogUrl:     os.Getenv(BazookaEnvSyslogUrl),
 		projectID:     os.Getenv(BazookaEnvProjectID),
 		jobID:         os.Getenv(BazookaEnvJobID),
 		jobParameters: os.Getenv(BazookaEnvJobParameters),
+		local:         os.Getenv(BazookaEnvLocal) != "",
 		paths: paths{
 			source:         path{"/bazooka", os.Getenv(BazookaEnvSrc)},
 			output:         path{"/bazooka-output", os.Getenv(BazookaEnvHome) + "/work"},
 			meta:           path{"/meta", os.Getenv(BazookaEnvHome) + "/meta"},
 			cryptoKey:      path{"/bazooka-cryptokey", os.Getenv(BazookaEnvCryptoKeyfile)},
+			registries:     path{"/bazooka-registries", os.Getenv(BazookaEnvRegistries)},
 			dockerSock:     path{"/var/run/docker.sock", ""},
 			dockerEndpoint: path{"unix:///var/run/docker.sock", ""},
 		},
 	}
+
+	if len(c.paths.registries.host) > 0 {
+		if c.registries, err = lib.ReadRegistryCredentials(c.paths.registries.container); err != nil {
+			log.Fatalf("Cannot read the registry credentials: %v", err)
+		}
+	}
+	return c
+}
+
+// pullImage pulls an image with the credential of its registry, if any
+func (c *context) pullImage(image string) error {
+	if c.registries.For(image) == nil {
+		return nil
+	}
+	api, err := dockerclient.NewClient(c.paths.dockerEndpoint.container)
+	if err != nil {
+		return err
+	}
+	if err := c.registries.PullImage(api, image); err != nil {
+		return fmt.Errorf("Failed to pull the image %s: %v", image, err)
+	}
+	return nil
+}
+
+// loggingDriver sends the logs of the containers to the bazooka server, the local builds keeping the default one
+func (c *context) loggingDriver() string {
+	if c.local {
+		return ""
+	}
+	return "syslog"
 }
 
 func (c *context) loggerConfig(image string) map[string]string {
+	if c.local {
+		return nil
+	}
 	return map[string]string{
 		"syslog-address": c.syslogUrl,
 		"syslog-tag":     fmt.Sprintf("image=%s;project=%s;job=%s", image, c.projectID, c.jobID),
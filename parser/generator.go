@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 	"text/template"
 
 	lib "github.com/bazooka-ci/bazooka/commons"
@@ -12,6 +14,10 @@ type Generator struct {
 	Config       *lib.Config
 	OutputFolder string
 	Index        string
+	AllowFailure bool
+	Stage        string
+	// the image of this variant is used to deploy
+	Deploy bool
 }
 
 type TemplateValues struct {
@@ -32,7 +38,14 @@ func (g *Generator) GenerateDockerfile() error {
 		return err
 	}
 
+	buildDir := lib.GetEnvMap(g.Config.Env)["BZK_BUILD_DIR"][0].Value
+
 	phases := []*BuildPhase{
+		&BuildPhase{
+			Name:               "cache_restore",
+			Commands:           cacheRestoreCommands(g.Config.Cache, buildDir),
+			ContinueOnCmdError: true,
+		},
 		&BuildPhase{
 			Name:     "before_install",
 			Commands: g.Config.BeforeInstall,
@@ -49,6 +62,11 @@ func (g *Generator) GenerateDockerfile() error {
 			Name:     "script",
 			Commands: g.Config.Script,
 		},
+		&BuildPhase{
+			Name:               "cache_save",
+			Commands:           cacheSaveCommands(g.Config.Cache, buildDir),
+			ContinueOnCmdError: true,
+		},
 		&BuildPhase{
 			Name:               "archive",
 			Commands:           archiveCommands(g.Config.Archive),
@@ -76,11 +94,16 @@ func (g *Generator) GenerateDockerfile() error {
 			Name:     "after_script",
 			Commands: g.Config.AfterScript,
 		},
+		// only run by the deploy container, once all the variants of the job succeeded
+		&BuildPhase{
+			Name:     "deploy",
+			Commands: deployCommands(g.Config.Deploy),
+		},
 	}
 
 	templateValues := &TemplateValues{
 		Generator:   g,
-		BzkBuildDir: lib.GetEnvMap(g.Config.Env)["BZK_BUILD_DIR"][0].Value,
+		BzkBuildDir: buildDir,
 		Phases:      phases,
 	}
 
@@ -101,6 +124,48 @@ func (g *Generator) GenerateDockerfile() error {
 		}
 	}
 
+	if len(g.Config.Cache) > 0 {
+		err = lib.Flush(g.Config.Cache, fmt.Sprintf("%s/%s/cache", g.OutputFolder, g.Index))
+		if err != nil {
+			return fmt.Errorf("Phase [%s/cache]: writing file failed: %v", g.Index, err)
+		}
+	}
+
+	if !g.Config.Resources.IsZero() {
+		err = lib.Flush(g.Config.Resources, fmt.Sprintf("%s/%s/resources", g.OutputFolder, g.Index))
+		if err != nil {
+			return fmt.Errorf("Phase [%s/resources]: writing file failed: %v", g.Index, err)
+		}
+	}
+
+	if g.Config.Agent != nil {
+		err = lib.Flush(g.Config.Agent, fmt.Sprintf("%s/%s/agent", g.OutputFolder, g.Index))
+		if err != nil {
+			return fmt.Errorf("Phase [%s/agent]: writing file failed: %v", g.Index, err)
+		}
+	}
+
+	if g.AllowFailure {
+		err = lib.Flush(true, fmt.Sprintf("%s/%s/allow_failure", g.OutputFolder, g.Index))
+		if err != nil {
+			return fmt.Errorf("Phase [%s/allow_failure]: writing file failed: %v", g.Index, err)
+		}
+	}
+
+	if len(g.Stage) > 0 {
+		err = lib.Flush(g.Stage, fmt.Sprintf("%s/%s/stage", g.OutputFolder, g.Index))
+		if err != nil {
+			return fmt.Errorf("Phase [%s/stage]: writing file failed: %v", g.Index, err)
+		}
+	}
+
+	if g.Deploy {
+		err = lib.Flush(g.Config.Deploy, fmt.Sprintf("%s/%s/deploy", g.OutputFolder, g.Index))
+		if err != nil {
+			return fmt.Errorf("Phase [%s/deploy]: writing file failed: %v", g.Index, err)
+		}
+	}
+
 	if len(g.Config.Services) > 0 {
 		err = lib.Flush(g.Config.Services, fmt.Sprintf("%s/%s/services", g.OutputFolder, g.Index))
 		if err != nil {
@@ -118,6 +183,59 @@ func archiveCommands(globs lib.Globs) []string {
 	return res
 }
 
+func deployCommands(deploy *lib.Deploy) []string {
+	if deploy == nil {
+		return nil
+	}
+	return deploy.Script
+}
+
+// The orchestration mounts the cached directories of the previous build in /bazooka-cache/restore,
+// and keeps those copied to /bazooka-cache/save when the build succeeds
+func cacheRestoreCommands(dirs lib.Dirs, buildDir string) []string {
+	res := make([]string, len(dirs))
+	for i, dir := range dirs {
+		cached := shellQuote("/bazooka-cache/restore/" + cacheKey(dir))
+		path := cachePath(dir, buildDir)
+		res[i] = fmt.Sprintf("if test -d %s; then mkdir -p %s && cp -a %s/. %s/; fi", cached, path, cached, path)
+	}
+	return res
+}
+
+func cacheSaveCommands(dirs lib.Dirs, buildDir string) []string {
+	res := make([]string, len(dirs))
+	for i, dir := range dirs {
+		cached := shellQuote("/bazooka-cache/save/" + cacheKey(dir))
+		path := cachePath(dir, buildDir)
+		res[i] = fmt.Sprintf("if test -d %s; then mkdir -p %s && cp -a %s/. %s/; fi", path, cached, path, cached)
+	}
+	return res
+}
+
+// cacheKey is the name of the folder holding a cached directory
+func cacheKey(dir string) string {
+	return url.QueryEscape(dir)
+}
+
+// cachePath returns the absolute path of a cached directory, quoted for the shell.
+// The commands are echoed between double quotes by the phase scripts, hence the single quotes
+func cachePath(dir, buildDir string) string {
+	switch {
+	case dir == "~":
+		return "$HOME"
+	case strings.HasPrefix(dir, "~/"):
+		return "$HOME" + shellQuote(dir[1:])
+	case strings.HasPrefix(dir, "/"):
+		return shellQuote(dir)
+	default:
+		return shellQuote(buildDir + "/" + dir)
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
 func writeTemplate(t interface{}, templateFile, outputFile string) error {
 	tmpl, err := template.ParseFiles(templateFile)
 	if err != nil {
@@ -3,6 +3,9 @@ package main
 import (
 	"testing"
 	"text/template"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestParseTemplate(t *testing.T) {
@@ -10,3 +13,17 @@ func TestParseTemplate(t *testing.T) {
 	template.Must(template.ParseFiles("template/bazooka_run.sh"))
 	template.Must(template.ParseFiles("template/Dockerfile"))
 }
+
+func TestCacheCommands(t *testing.T) {
+	dirs := lib.Dirs{"node_modules", "~/.m2", "/var/cache/it's"}
+
+	assert.Equal(t, []string{
+		"if test -d '/bazooka-cache/restore/node_modules'; then mkdir -p '/bazooka/build/node_modules' && cp -a '/bazooka-cache/restore/node_modules'/. '/bazooka/build/node_modules'/; fi",
+		"if test -d '/bazooka-cache/restore/~%2F.m2'; then mkdir -p $HOME'/.m2' && cp -a '/bazooka-cache/restore/~%2F.m2'/. $HOME'/.m2'/; fi",
+		`if test -d '/bazooka-cache/restore/%2Fvar%2Fcache%2Fit%27s'; then mkdir -p '/var/cache/it'\''s' && cp -a '/bazooka-cache/restore/%2Fvar%2Fcache%2Fit%27s'/. '/var/cache/it'\''s'/; fi`,
+	}, cacheRestoreCommands(dirs, "/bazooka/build"))
+
+	assert.Equal(t, []string{
+		"if test -d '/bazooka/build/node_modules'; then mkdir -p '/bazooka-cache/save/node_modules' && cp -a '/bazooka/build/node_modules'/. '/bazooka-cache/save/node_modules'/; fi",
+	}, cacheSaveCommands(dirs[:1], "/bazooka/build"))
+}
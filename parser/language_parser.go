@@ -20,6 +20,21 @@ type variantData struct {
 	meta    map[string]interface{}
 }
 
+// volumes returns the volumes bound in the language parser container. The crypto key is only bound if the job has one,
+// which the local builds only have when given --crypto-key
+func (p *LanguageParser) volumes() []string {
+	paths := p.context.paths
+	volumes := []string{
+		fmt.Sprintf("%s:/bazooka", paths.source.host),
+		fmt.Sprintf("%s:/bazooka-output", paths.output.host),
+		fmt.Sprintf("%s:/meta", paths.meta.host),
+	}
+	if len(paths.cryptoKey.host) > 0 {
+		volumes = append(volumes, fmt.Sprintf("%s:/bazooka-cryptokey", paths.cryptoKey.host))
+	}
+	return volumes
+}
+
 func (p *LanguageParser) Parse() ([]*variantData, error) {
 	log.WithFields(log.Fields{
 		"image": p.image,
@@ -27,21 +42,20 @@ func (p *LanguageParser) Parse() ([]*variantData, error) {
 
 	paths := p.context.paths
 
+	if err := p.context.pullImage(p.image); err != nil {
+		return nil, err
+	}
+
 	client, err := docker.NewDocker(paths.dockerEndpoint.container)
 	if err != nil {
 		return nil, err
 	}
 
 	container, err := client.Run(&docker.RunOptions{
-		Image: p.image,
-		VolumeBinds: []string{
-			fmt.Sprintf("%s:/bazooka", paths.source.host),
-			fmt.Sprintf("%s:/bazooka-output", paths.output.host),
-			fmt.Sprintf("%s:/meta", paths.meta.host),
-			fmt.Sprintf("%s:/bazooka-cryptokey", paths.cryptoKey.host),
-		},
+		Image:               p.image,
+		VolumeBinds:         p.volumes(),
 		Detach:              true,
-		LoggingDriver:       "syslog",
+		LoggingDriver:       p.context.loggingDriver(),
 		LoggingDriverConfig: p.context.loggerConfig(p.image),
 	})
 	if err != nil {
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguageParserVolumes(t *testing.T) {
+	p := &LanguageParser{context: &context{paths: paths{
+		source: path{"/bazooka", "/home/bzk/work/source"},
+		output: path{"/bazooka-output", "/home/bzk/work/output"},
+		meta:   path{"/meta", "/home/bzk/work/meta"},
+	}}}
+	// bzk run without --crypto-key
+	assert.Equal(t, []string{
+		"/home/bzk/work/source:/bazooka",
+		"/home/bzk/work/output:/bazooka-output",
+		"/home/bzk/work/meta:/meta",
+	}, p.volumes())
+
+	p.context.paths.cryptoKey = path{"/bazooka-cryptokey", "/home/bzk/keys/project.key"}
+	assert.Contains(t, p.volumes(), "/home/bzk/keys/project.key:/bazooka-cryptokey")
+}
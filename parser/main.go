@@ -3,12 +3,13 @@ package main
 import (
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 
 	"github.com/bazooka-ci/bazooka/commons/matrix"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/bazooka-ci/bazooka/client"
 	lib "github.com/bazooka-ci/bazooka/commons"
 	bzklog "github.com/bazooka-ci/bazooka/commons/logs"
 )
@@ -20,9 +21,23 @@ const (
 	BazookaEnvJobParameters = "BZK_JOB_PARAMETERS"
 )
 
+// failureReasonHook writes the fatal error of the parser in the output folder, for the orchestration to report it
+type failureReasonHook struct {
+	file string
+}
+
+func (h *failureReasonHook) Levels() []log.Level {
+	return []log.Level{log.FatalLevel}
+}
+
+func (h *failureReasonHook) Fire(entry *log.Entry) error {
+	return ioutil.WriteFile(h.file, []byte(entry.Message), 0644)
+}
+
 func init() {
 	log.SetFormatter(&bzklog.BzkFormatter{})
 	context := initContext()
+	log.AddHook(&failureReasonHook{filepath.Join(context.paths.output.container, lib.FailureReasonFile)})
 	err := lib.LoadCryptoKeyFromFile(context.paths.cryptoKey.container)
 	if err != nil {
 		log.Fatal(err)
@@ -41,6 +56,19 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// fail early and with the keys of the problems, instead of deep in the parsing
+	configErrors, err := lib.LintFile(configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(configErrors) > 0 {
+		msgs := make([]string, len(configErrors))
+		for i, configError := range configErrors {
+			msgs[i] = fmt.Sprintf("%s: %v", filepath.Base(configFile), configError)
+		}
+		log.Fatalf("Invalid configuration file %s:\n%s", filepath.Base(configFile), strings.Join(msgs, "\n"))
+	}
+
 	envParams, err := context.unmarshalJobParameters()
 	if err != nil {
 		log.Fatal(err)
@@ -67,7 +95,7 @@ func main() {
 		variants = generateImageVariants(config)
 	} else {
 		// resolve the docker image corresponding to this particular language parser
-		image, err := resolveLanguageParser(context.client, config.Language)
+		image, err := resolveLanguageParser(context, config.Language)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -83,63 +111,169 @@ func main() {
 		}
 	}
 
-	log.Info("Starting Matrix generation")
+	// a configuration without stages is a pipeline of a single unnamed stage
+	stages := config.Stages
+	if len(stages) == 0 {
+		stages = []lib.Stage{{}}
+	} else if err := checkStages(stages); err != nil {
+		log.Fatal(err)
+	}
 
-	for _, variant := range variants {
-		// create a matrix from the environment variables
-		// a matrix has N variables (dimensions) where each variable has M values
-		// config.Env is a list of key=value strings
-		// groupByName transforms that into a map[string][]string
-		// for example ["A=1", "A=2", B="3"]
-		// when grouped by name gets transformed into
-		// {A: [1, 2], B: [3]}
-		// this matches the matrix layout, so we could store them directly into the matrix
-		// but since we would like to be able to extract them later, and to avoid mixing them with a language specific variables (like jdk, go, etc.)
-		// explode prefixes the env variables names with a prefix defined in the constant MX_ENV_PREFIX
-		// Hence, our matrix is more like: {"env::A": [1, 2], "env::B": [3]}
-		variantVariables := groupByName(variant.config.Env, MX_ENV_PREFIX)
-
-		// insert or replace environment variables defined by the job parameters
-		for k, v := range jobParameters {
-			variantVariables[k] = v
+	// the deploy runs in the image of one of the variants of the last stage
+	deploy := config.WithStage(&stages[len(stages)-1]).Deploy
+	var deploySelector *matrix.Matrix
+	if deploy != nil {
+		if len(deploy.Script) == 0 {
+			log.Fatal("Invalid config: the deploy section has no script")
 		}
-
-		// check if all environment variables are defined
-		for k, v := range variantVariables {
-			if len(v) == 1 && len(v[0]) == 0 {
-				log.Fatalf("Missing required parameter %v", k)
+		if len(deploy.Variant) > 0 {
+			selectors, err := exclusionsMatrices([]map[string]interface{}{deploy.Variant})
+			if err != nil {
+				log.Fatal(err)
 			}
+			deploySelector = selectors[0]
 		}
+	}
+	// the counter of the variant whose image is used to deploy
+	deployer := ""
 
-		mx := matrix.Matrix(variantVariables)
+	log.Info("Starting Matrix generation")
 
-		// and then add the new language specific variables parsed from the meta file to the build matrix (which already contains the env variables)
-		err = feedMatrix(variant.meta, &mx)
-		if err != nil {
-			log.Fatal(err)
+	// the variants allowed to fail, by counter
+	allowFailure := map[string]bool{}
+	// the stage of the variants, by counter
+	stageOf := map[string]string{}
+
+	for si := range stages {
+		stage := &stages[si]
+		// the counters of the variants of a stage are prefixed by the stage index, so that they are still ordered by stage
+		stagePrefix := ""
+		if len(config.Stages) > 0 {
+			stagePrefix = fmt.Sprintf("s%0*d", len(fmt.Sprintf("%d", len(stages)-1)), si)
 		}
+		// the include entries applying to at least one variant, by index
+		includedOnce := map[int]bool{}
+
+		for _, variant := range variants {
+			variantConfig := variant.config.WithStage(stage)
+			rootCounter := stagePrefix + variant.counter
+
+			// create a matrix from the environment variables
+			// a matrix has N variables (dimensions) where each variable has M values
+			// config.Env is a list of key=value strings
+			// groupByName transforms that into a map[string][]string
+			// for example ["A=1", "A=2", B="3"]
+			// when grouped by name gets transformed into
+			// {A: [1, 2], B: [3]}
+			// this matches the matrix layout, so we could store them directly into the matrix
+			// but since we would like to be able to extract them later, and to avoid mixing them with a language specific variables (like jdk, go, etc.)
+			// explode prefixes the env variables names with a prefix defined in the constant MX_ENV_PREFIX
+			// Hence, our matrix is more like: {"env::A": [1, 2], "env::B": [3]}
+			variantVariables := groupByName(variantConfig.Env, MX_ENV_PREFIX)
+
+			// insert or replace environment variables defined by the job parameters
+			for k, v := range jobParameters {
+				variantVariables[k] = v
+			}
 
-		// we're not done yet: we need to also handle the matrix exclusions
-		// we parse them into a list of matrices
-		exclusions, err := exclusionsMatrices(variant.config.Matrix.Exclude)
-		if err != nil {
-			log.Fatal(err)
-		}
+			// check if all environment variables are defined
+			for k, v := range variantVariables {
+				if len(v) == 1 && len(v[0]) == 0 {
+					log.Fatalf("Missing required parameter %v", k)
+				}
+			}
+
+			mx := matrix.Matrix(variantVariables)
+
+			// and then add the new language specific variables parsed from the meta file to the build matrix (which already contains the env variables)
+			err = feedMatrix(variant.meta, &mx)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// we're not done yet: we need to also handle the matrix exclusions
+			// we parse them into a list of matrices
+			exclusions, err := exclusionsMatrices(variantConfig.Matrix.Exclude)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// the permutations matching one of the allow_failures selectors don't fail the job
+			allowedFailures, err := exclusionsMatrices(variantConfig.Matrix.AllowFailures)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// the include entries add one-off variants on top of the cartesian product
+			// an entry only applies to the variants whose language specific variables it matches
+			inclusions, err := exclusionsMatrices(variantConfig.Matrix.Include)
+			if err != nil {
+				log.Fatal(err)
+			}
+			inclusions = inclusionsFor(inclusions, mx)
+			for i, inclusion := range inclusions {
+				if inclusion != nil {
+					includedOnce[i] = true
+				}
+			}
 
-		// and finally, we iterate over all the permutations of the build matrix
-		// these permutations are the list of all the combinations of env variables and language specific variables, minux the exclusions
-		mx.IterAll(func(permutation map[string]string, counter string) {
-			// we get called for every non-excluded permutations with the different variables values for this permutations and a unique permutation counter
-			// handlePermutation will start from the .bazooka.*.yml file, which should already contain a single language specific permutation
-			// and enrich it with the env variables combination
-			// the same goes for the meta file
-			if err := handlePermutation(context, permutation, variant.config, variant.meta, counter, variant.counter); err != nil {
-				log.Fatal(fmt.Errorf("Error while generating the permutations: %v", err))
+			// and finally, we iterate over all the permutations of the build matrix
+			// these permutations are the list of all the combinations of env variables and language specific variables, minux the exclusions
+			generate := func(permutation map[string]string, counter string) {
+				// we get called for every non-excluded permutations with the different variables values for this permutations and a unique permutation counter
+				// handlePermutation will start from the .bazooka.*.yml file, which should already contain a single language specific permutation
+				// and enrich it with the env variables combination
+				// the same goes for the meta file
+				if err := handlePermutation(context, permutation, variantConfig, variant.meta, counter, rootCounter); err != nil {
+					log.Fatal(fmt.Errorf("Error while generating the permutations: %v", err))
+				}
+				for _, allowed := range allowedFailures {
+					if allowed.Matches(permutation) {
+						allowFailure[rootCounter+counter] = true
+						break
+					}
+				}
+				stageOf[rootCounter+counter] = stage.Name
+				if deploy != nil && len(deployer) == 0 && si == len(stages)-1 && (deploySelector == nil || deploySelector.Matches(permutation)) {
+					deployer = rootCounter + counter
+				}
+			}
+			mx.IterAll(generate, exclusions)
+			// the included permutations not already generated get their own counters, after the others
+			mx.IterIncluded(generate, inclusions, exclusions)
+		}
+		for i, entry := range config.WithStage(stage).Matrix.Include {
+			if !includedOnce[i] {
+				// the language parser only generated the versions of the build matrix, an entry can't add a new one
+				log.Fatalf("Invalid config: the matrix include entry %v selects none of the language versions of the build matrix", entry)
 			}
-		}, exclusions)
+		}
+	}
+	if deploy != nil && len(deployer) == 0 {
+		log.Fatalf("Invalid config: the deploy variant %v matches none of the variants", deploy.Variant)
 	}
 	log.Info("Matrix generated")
 
+	// the orchestration needs the job-wide matrix settings to decide the job status
+	settings := lib.ConfigMatrix{
+		FastFinish:            config.Matrix.FastFinish,
+		CancelAllowedFailures: config.Matrix.CancelAllowedFailures,
+	}
+	if err := lib.Flush(settings, fmt.Sprintf("%s/matrix", context.paths.output.container)); err != nil {
+		log.Fatal(fmt.Errorf("Error while writing the matrix settings: %v", err))
+	}
+
+	// the orchestration runs the stages in order
+	if len(config.Stages) > 0 {
+		names := make([]string, len(stages))
+		for i, stage := range stages {
+			names[i] = stage.Name
+		}
+		if err := lib.Flush(names, fmt.Sprintf("%s/stages", context.paths.output.container)); err != nil {
+			log.Fatal(fmt.Errorf("Error while writing the stages: %v", err))
+		}
+	}
+
 	log.Info("Starting generating Dockerfiles from Matrix")
 	// Now we're left with the final build files
 	files, err := lib.ListFilesWithPrefix(context.paths.output.container, ".bazooka")
@@ -159,6 +293,9 @@ func main() {
 			Config:       config,
 			OutputFolder: context.paths.output.container,
 			Index:        parseCounter(file),
+			AllowFailure: allowFailure[parseCounter(file)],
+			Stage:        stageOf[parseCounter(file)],
+			Deploy:       deployer == parseCounter(file),
 		}
 		err = g.GenerateDockerfile()
 		if err != nil {
@@ -169,6 +306,21 @@ func main() {
 
 }
 
+// checkStages makes sure every stage has a name, and that it is unique
+func checkStages(stages []lib.Stage) error {
+	names := map[string]bool{}
+	for i, stage := range stages {
+		if len(stage.Name) == 0 {
+			return fmt.Errorf("Invalid config: the stage #%d has no name", i+1)
+		}
+		if names[stage.Name] {
+			return fmt.Errorf("Invalid config: the stage name %s is used more than once", stage.Name)
+		}
+		names[stage.Name] = true
+	}
+	return nil
+}
+
 func handlePermutation(context *context, permutation map[string]string, config *lib.Config, meta map[string]interface{}, counter, rootCounter string) error {
 	// start from the language-spcecific permutation
 	newConfig := *config
@@ -261,6 +413,44 @@ func exclusionsMatrices(xs []map[string]interface{}) ([]*matrix.Matrix, error) {
 	return res, nil
 }
 
+// inclusionsFor restricts the included matrices to those whose language specific variables match the ones of mx, which have a single value.
+// The other ones are replaced by nil, keeping the indexes of the included matrices and thus their permutations counters stable
+func inclusionsFor(inclusions []*matrix.Matrix, mx matrix.Matrix) []*matrix.Matrix {
+	res := make([]*matrix.Matrix, len(inclusions))
+	for i, inclusion := range inclusions {
+		langVars := matrix.Matrix{}
+		for k, vs := range *inclusion {
+			if !strings.HasPrefix(k, MX_ENV_PREFIX) {
+				langVars[k] = vs
+			}
+		}
+		if !langVars.Matches(singleValues(mx, langVars)) {
+			continue
+		}
+		// pin the language specific variables to the ones of this variant
+		pinned := matrix.Matrix{}
+		for k, vs := range *inclusion {
+			pinned[k] = vs
+		}
+		for k := range langVars {
+			pinned[k] = mx[k]
+		}
+		res[i] = &pinned
+	}
+	return res
+}
+
+// singleValues returns the value of each of the variables of mx which are also in vars
+func singleValues(mx, vars matrix.Matrix) map[string]string {
+	res := map[string]string{}
+	for k := range vars {
+		if vs, ok := mx[k]; ok && len(vs) > 0 {
+			res[k] = vs[0]
+		}
+	}
+	return res
+}
+
 // parseCounter extract the * part from a .bazooka.*.yml file name
 func parseCounter(filePath string) string {
 	splits := strings.Split(filePath, "/")
@@ -317,15 +507,18 @@ func mapValues(m map[string]lib.BzkString) []lib.BzkString {
 }
 
 func generateEnvForMeta(env []lib.BzkString, cryptoKeyPath string) ([]string, error) {
-	key, err := lib.ReadCryptoKey(cryptoKeyPath)
-	if err != nil {
-		return nil, err
-	}
-
+	// the key is only needed by the secured values, the local builds may run without it
+	var key []byte
 	res := make([]string, 0, len(env))
 	for _, e := range env {
 		value := e.Value
 		if e.Secured {
+			if key == nil {
+				var err error
+				if key, err = lib.ReadCryptoKey(cryptoKeyPath); err != nil {
+					return nil, err
+				}
+			}
 			eValue, err := lib.Encrypt(key, []byte(value))
 			if err != nil {
 				return nil, err
@@ -337,8 +530,16 @@ func generateEnvForMeta(env []lib.BzkString, cryptoKeyPath string) ([]string, er
 	return res, nil
 }
 
-func resolveLanguageParser(client *client.Client, language string) (string, error) {
-	image, err := client.Image.Get(fmt.Sprintf("parser/%s", language))
+func resolveLanguageParser(context *context, language string) (string, error) {
+	name := fmt.Sprintf("parser/%s", language)
+	if context.local {
+		image, found := lib.DefaultImages[name]
+		if !found {
+			return "", fmt.Errorf("No Language Parser for %s in the local builds", language)
+		}
+		return image, nil
+	}
+	image, err := context.client.Image.Get(name)
 	if err != nil {
 		return "", fmt.Errorf("Error while fetching image for Language Parser %s: %v", language, err)
 	}
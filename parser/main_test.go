@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/matrix"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleValues(t *testing.T) {
+	mx := matrix.Matrix{
+		"go":                   {"1.4"},
+		MX_ENV_PREFIX + "DB":   {"mysql", "postgres"},
+		MX_ENV_PREFIX + "MODE": {"fast"},
+	}
+	assert.Equal(t, map[string]string{"go": "1.4"}, singleValues(mx, matrix.Matrix{"go": {"1.3"}, "jdk": {"8"}}))
+}
+
+func TestInclusionsFor(t *testing.T) {
+	inclusions := []*matrix.Matrix{
+		{"go": {"1.4"}, MX_ENV_PREFIX + "RACE": {"1"}},
+		{"go": {"1.5"}, MX_ENV_PREFIX + "RACE": {"1"}},
+		{MX_ENV_PREFIX + "DEBUG": {"1"}},
+	}
+	mx := matrix.Matrix{
+		"go":                 {"1.4"},
+		MX_ENV_PREFIX + "DB": {"mysql", "postgres"},
+	}
+
+	res := inclusionsFor(inclusions, mx)
+	require.Len(t, res, 3, "the indexes of the included matrices are kept")
+	require.NotNil(t, res[0])
+	assert.Equal(t, matrix.Matrix{"go": {"1.4"}, MX_ENV_PREFIX + "RACE": {"1"}}, *res[0])
+	assert.Nil(t, res[1], "an entry can't add a language version")
+	require.NotNil(t, res[2])
+	assert.Equal(t, matrix.Matrix{MX_ENV_PREFIX + "DEBUG": {"1"}}, *res[2], "the entries without language variables apply to all the versions")
+}
+
+func TestGenerateEnvForMetaWithoutKey(t *testing.T) {
+	env, err := generateEnvForMeta([]lib.BzkString{{Name: "A", Value: "1"}}, "/does/not/exist")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A=1"}, env)
+
+	_, err = generateEnvForMeta([]lib.BzkString{{Name: "B", Value: "2", Secured: true}}, "/does/not/exist")
+	assert.Error(t, err)
+}
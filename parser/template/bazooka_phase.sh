@@ -9,10 +9,12 @@ set -e
 {{end}}
 
 echo "<PHASE:{{.Name}}>"
+trap 'echo "<PHASE_END:$?>"' EXIT
 
 {{range .Commands}}
 echo "<CMD:{{.}}>"
 {{.}}
+echo "<CMD_END:$?>"
 {{end}}
 
 echo "cd \"$(pwd)\"" > /.bzkenv
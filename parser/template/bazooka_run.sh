@@ -1,5 +1,7 @@
 #!/bin/bash
 
+{{$.BzkBuildDir}}/bazooka_cache_restore.sh
+
 if {{$.BzkBuildDir}}/bazooka_before_install.sh && \
    {{$.BzkBuildDir}}/bazooka_install.sh && \
    {{$.BzkBuildDir}}/bazooka_before_script.sh
@@ -15,6 +17,7 @@ exitCode=$?
 
 if [[ $exitCode == 0 ]]
 then
+  {{$.BzkBuildDir}}/bazooka_cache_save.sh
   {{$.BzkBuildDir}}/bazooka_archive_success.sh
   {{$.BzkBuildDir}}/bazooka_after_success.sh
 else
@@ -6,7 +6,7 @@ set -ev
 go get -u github.com/mitchellh/gox
 go get -u github.com/kisielk/errcheck
 
-go_projects=( "parser" "orchestration" "server" "cli" )
+go_projects=( "parser" "orchestration" "server" "cli" "agent" )
 
 for project in "${go_projects[@]}"
 do
@@ -2,7 +2,7 @@
 
 set -e
 
-docker_projects=( "parser" "orchestration" "server" "web")
+docker_projects=( "parser" "orchestration" "server" "web" "agent")
 
 if [ -n "$DO_PUSH" ]; then
   docker login -e "$DOCKER_EMAIL" -p "$DOCKER_PASSWORD" -u "$DOCKER_USERNAME"
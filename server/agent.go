@@ -0,0 +1,128 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+// registerAgent registers a build agent, the agents calling it again at every heartbeat
+func (c *context) registerAgent(r *request) (*response, error) {
+	var agent lib.Agent
+	r.parseBody(&agent)
+
+	agent.Name = r.vars["name"]
+	agent.DockerURL = strings.TrimSpace(agent.DockerURL)
+	if len(agent.DockerURL) == 0 {
+		return badRequest("docker_url is required")
+	}
+	if agent.Capacity < 0 {
+		return badRequest("capacity should be a positive number of variants")
+	}
+	if agent.Capacity == 0 {
+		agent.Capacity = 1
+	}
+
+	if err := c.connector.RegisterAgent(&agent); err != nil {
+		return nil, err
+	}
+
+	return ok(&agent)
+}
+
+func (c *context) getAgents(r *request) (*response, error) {
+	agents, err := c.connector.GetAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	return ok(&agents)
+}
+
+func (c *context) removeAgent(r *request) (*response, error) {
+	if err := c.connector.RemoveAgent(r.vars["name"]); err != nil {
+		if _, notFound := err.(*store.NotFoundError); !notFound {
+			return nil, err
+		}
+		return notFound("agent not found")
+	}
+
+	return noContent()
+}
+
+// acquireAgentLease takes a slot of the capacity of an agent for a job, answering 409 while the agent is running at its capacity
+func (c *context) acquireAgentLease(r *request) (*response, error) {
+	acquired, err := c.connector.AcquireAgentLease(r.vars["name"], &lib.AgentLease{JobID: r.vars["job"], ID: r.vars["lease"]})
+	if err != nil {
+		if !store.IsNotFound(err) {
+			return nil, err
+		}
+		return notFound("agent not found")
+	}
+	if !acquired {
+		return conflict("the agent is running at its capacity")
+	}
+
+	return noContent()
+}
+
+func (c *context) releaseAgentLease(r *request) (*response, error) {
+	if err := c.connector.ReleaseAgentLease(r.vars["name"], &lib.AgentLease{JobID: r.vars["job"], ID: r.vars["lease"]}); err != nil {
+		if !store.IsNotFound(err) {
+			return nil, err
+		}
+		return notFound("agent not found")
+	}
+
+	return noContent()
+}
+
+// jobsAgents returns the registered build agents which ran some variants of the jobs
+func (c *context) jobsAgents(jobs []*lib.Job) ([]*lib.Agent, error) {
+	names := map[string]bool{}
+	for _, job := range jobs {
+		variants, err := c.connector.GetVariants(job.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, variant := range variants {
+			if len(variant.Agent) > 0 {
+				names[variant.Agent] = true
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	agents, err := c.connector.GetAgents()
+	if err != nil {
+		return nil, err
+	}
+	found := []*lib.Agent{}
+	for _, agent := range agents {
+		if names[agent.Name] {
+			found = append(found, agent)
+			delete(names, agent.Name)
+		}
+	}
+	for name := range names {
+		log.Warnf("The build agent %s is no longer registered, its containers can't be removed", name)
+	}
+	return found, nil
+}
+
+// agentClient returns a client of the Docker API of a build agent, over TLS with the client certificate of the server if it has one
+func (c *context) agentClient(agent *lib.Agent) (*dockerclient.Client, error) {
+	if len(c.paths.agentCerts.host) == 0 {
+		return dockerclient.NewClient(agent.DockerURL)
+	}
+	return dockerclient.NewTLSClient(agent.DockerURL,
+		filepath.Join(c.paths.agentCerts.container, "cert.pem"),
+		filepath.Join(c.paths.agentCerts.container, "key.pem"),
+		filepath.Join(c.paths.agentCerts.container, "ca.pem"))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentHandlers(t *testing.T) {
+	c := &context{connector: store.NewMemoryStore()}
+	r := mux.NewRouter()
+	r.Handle("/agent", mkHandler(c.getAgents)).Methods("GET")
+	r.Handle("/agent/{name}", mkHandler(c.registerAgent)).Methods("PUT")
+	r.Handle("/agent/{name}", mkHandler(c.removeAgent)).Methods("DELETE")
+
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+
+	w := serve("PUT", "/agent/builder-1", `{"labels": ["linux"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the docker url is required")
+
+	w = serve("PUT", "/agent/builder-1", `{"docker_url": "tcp://10.0.0.2:2376", "labels": ["linux"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var registered lib.Agent
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&registered))
+	assert.Equal(t, "builder-1", registered.Name)
+	assert.Equal(t, 1, registered.Capacity, "the capacity defaults to 1")
+
+	w = serve("GET", "/agent", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var agents []*lib.Agent
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&agents))
+	require.Len(t, agents, 1)
+	assert.Equal(t, []string{"linux"}, agents[0].Labels)
+
+	assert.Equal(t, http.StatusNoContent, serve("DELETE", "/agent/builder-1", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/agent/builder-1", "").Code)
+}
+
+func TestAgentLeaseHandlers(t *testing.T) {
+	c := &context{connector: store.NewMemoryStore()}
+	require.NoError(t, c.connector.RegisterAgent(&lib.Agent{Name: "builder-1", DockerURL: "tcp://10.0.0.2:2376", Capacity: 1}))
+	r := mux.NewRouter()
+	r.Handle("/agent/{name}/lease/{job}/{lease}", mkHandler(c.acquireAgentLease)).Methods("PUT")
+	r.Handle("/agent/{name}/lease/{job}/{lease}", mkHandler(c.releaseAgentLease)).Methods("DELETE")
+
+	serve := func(method, url string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		return w.Code
+	}
+
+	// two jobs competing for the single slot of the agent
+	assert.Equal(t, http.StatusNoContent, serve("PUT", "/agent/builder-1/lease/job-1/1"))
+	assert.Equal(t, http.StatusConflict, serve("PUT", "/agent/builder-1/lease/job-2/1"))
+	assert.Equal(t, http.StatusNoContent, serve("DELETE", "/agent/builder-1/lease/job-1/1"))
+	assert.Equal(t, http.StatusNoContent, serve("PUT", "/agent/builder-1/lease/job-2/1"))
+
+	// the leases of a finished job are released
+	require.NoError(t, c.connector.ReleaseJobAgentLeases("job-2"))
+	assert.Equal(t, http.StatusNoContent, serve("PUT", "/agent/builder-1/lease/job-1/2"))
+
+	assert.Equal(t, http.StatusNotFound, serve("PUT", "/agent/unknown/lease/job-1/3"))
+}
+
+func TestJobsAgents(t *testing.T) {
+	c := &context{connector: store.NewMemoryStore()}
+	require.NoError(t, c.connector.RegisterAgent(&lib.Agent{Name: "builder-1", DockerURL: "tcp://10.0.0.2:2376"}))
+	require.NoError(t, c.connector.RegisterAgent(&lib.Agent{Name: "builder-2", DockerURL: "tcp://10.0.0.3:2376"}))
+	project := &lib.Project{Name: "bazooka", ScmType: "git", ScmURI: "git@example.com:bazooka.git"}
+	require.NoError(t, c.connector.AddProject(project))
+	job := &lib.Job{ProjectID: project.ID}
+	require.NoError(t, c.connector.AddJob(job))
+	for _, variant := range []*lib.Variant{
+		{ProjectID: project.ID, JobID: job.ID, Number: 0},
+		{ProjectID: project.ID, JobID: job.ID, Number: 1, Agent: "builder-2"},
+		{ProjectID: project.ID, JobID: job.ID, Number: 2, Agent: "builder-2"},
+		{ProjectID: project.ID, JobID: job.ID, Number: 3, Agent: "removed"},
+	} {
+		require.NoError(t, c.connector.AddVariant(variant))
+	}
+
+	agents, err := c.jobsAgents([]*lib.Job{job})
+	require.NoError(t, err)
+	require.Len(t, agents, 1, "only the registered agents which ran some variants")
+	assert.Equal(t, "builder-2", agents[0].Name)
+
+	agents, err = c.jobsAgents(nil)
+	require.NoError(t, err)
+	assert.Empty(t, agents)
+}
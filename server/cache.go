@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+)
+
+const (
+	// the orchestration keeps the cache of each branch of a project in this folder of the project cache folder
+	cacheBranchesFolder = "branches"
+	// project config key naming the branch whose cache is used by the branches without one
+	defaultBranchConfigKey = "bzk.scm.default_branch"
+	defaultBranchName      = "master"
+)
+
+// cacheKey is the name of the cache folder of a branch
+func cacheKey(branch string) string {
+	return url.QueryEscape(branch)
+}
+
+func defaultBranch(project *lib.Project) string {
+	if branch := project.Config[defaultBranchConfigKey]; len(branch) > 0 {
+		return branch
+	}
+	return defaultBranchName
+}
+
+func (c *context) clearCache(r *request) (*response, error) {
+	project, err := c.connector.GetProjectById(r.vars["id"])
+	if err != nil {
+		if _, notFound := err.(*store.NotFoundError); !notFound {
+			return nil, err
+		}
+		return notFound("project not found")
+	}
+
+	folder := fmt.Sprintf(projectCacheFolderPattern, c.paths.home.container, project.ID) + "/" + cacheBranchesFolder
+	if branch := r.query("branch"); len(branch) > 0 {
+		folder += "/" + cacheKey(branch)
+	}
+	if err := os.RemoveAll(folder); err != nil {
+		return nil, err
+	}
+
+	return noContent()
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"fmt"
 
 	lib "github.com/bazooka-ci/bazooka/commons"
 	"github.com/bazooka-ci/bazooka/commons/mongo"
+	"github.com/bazooka-ci/bazooka/commons/store"
 )
 
 const (
@@ -17,21 +20,49 @@ const (
 	BazookaEnvDockerSock = "BZK_DOCKERSOCK"
 	BazookaEnvApiUrl     = "BZK_API_URL"
 	BazookaEnvSyslogUrl  = "BZK_SYSLOG_URL"
+	BazookaEnvLogStore   = "BZK_LOG_STORE"
+	BazookaEnvStore      = "BZK_STORE"
+	BazookaEnvStorePath  = "BZK_STORE_PATH"
+	BazookaEnvGCKeepJobs = "BZK_GC_KEEP_JOBS"
+	BazookaEnvGCKeepDays = "BZK_GC_KEEP_DAYS"
+	BazookaEnvAgentCerts = "BZK_AGENT_TLS_CERTS"
 	BazookaEnvMongoAddr  = "MONGO_PORT_27017_TCP_ADDR"
 	BazookaEnvMongoPort  = "MONGO_PORT_27017_TCP_PORT"
 
+	// default maximum number of variants of a job built and run at once
+	BazookaEnvMaxParallelVariants = "BZK_MAX_PARALLEL_VARIANTS"
+	// server-wide maximum resources of each variant
+	BazookaEnvMaxMemory = "BZK_MAX_MEMORY"
+	BazookaEnvMaxCPUs   = "BZK_MAX_CPUS"
+	BazookaEnvMaxPids   = "BZK_MAX_PIDS"
+
 	DockerSock     = "/var/run/docker.sock"
 	DockerEndpoint = "unix://" + DockerSock
 	BazookaHome    = "/bazooka"
+	AgentCerts     = "/bazooka-agent-certs"
+
+	StoreMongo  = "mongo"
+	StoreBolt   = "bolt"
+	StoreMemory = "memory"
+	// default location of the bolt store file
+	BoltStorePath = BazookaHome + "/bazooka.db"
 )
 
 type context struct {
-	apiUrl    string
-	syslogUrl string
-	mongoAddr string
-	mongoPort string
-	connector *mongo.MongoConnector
-	paths     paths
+	apiUrl      string
+	syslogUrl   string
+	mongoAddr   string
+	mongoPort   string
+	logStore    string
+	connector   store.Store
+	paths       paths
+	maskers     *maskers
+	archiveLock *sync.Mutex
+	retention   *lib.RetentionPolicy
+	gcLock      *sync.Mutex
+	maxParallel int
+	limits      *lib.Resources
+	registryKey []byte
 }
 
 type paths struct {
@@ -40,6 +71,7 @@ type paths struct {
 	cryptoKey      path
 	dockerSock     path
 	dockerEndpoint path
+	agentCerts     path
 }
 
 type path struct {
@@ -53,23 +85,93 @@ func initContext() *context {
 		syslogUrl: os.Getenv(BazookaEnvSyslogUrl),
 		mongoAddr: os.Getenv(BazookaEnvMongoAddr),
 		mongoPort: os.Getenv(BazookaEnvMongoPort),
+		logStore:  os.Getenv(BazookaEnvLogStore),
 		paths: paths{
 			home:           path{BazookaHome, os.Getenv(BazookaEnvHome)},
 			scmKey:         path{"", os.Getenv(BazookaEnvSCMKeyfile)},
 			dockerSock:     path{DockerSock, os.Getenv(BazookaEnvDockerSock)},
 			dockerEndpoint: path{DockerEndpoint, "unix://" + os.Getenv(BazookaEnvDockerSock)},
+			agentCerts:     path{AgentCerts, os.Getenv(BazookaEnvAgentCerts)},
 		},
+		maskers:     &maskers{byJob: map[string]*lib.Masker{}},
+		archiveLock: &sync.Mutex{},
+		retention:   serverRetentionPolicy(),
+		gcLock:      &sync.Mutex{},
+	}
+
+	if v := os.Getenv(BazookaEnvMaxParallelVariants); len(v) > 0 {
+		max, err := strconv.Atoi(v)
+		if err != nil || max < 0 {
+			log.Fatalf("%s should be a positive number of variants, got %s", BazookaEnvMaxParallelVariants, v)
+		}
+		c.maxParallel = max
 	}
 
-	if err := lib.WaitForTcpConnection(c.mongoAddr, c.mongoPort, 100*time.Millisecond, 5*time.Second); err != nil {
-		log.Fatalf("Cannot connect to the database: %v", err)
+	limits, err := lib.ParseResources(os.Getenv(BazookaEnvMaxMemory), os.Getenv(BazookaEnvMaxCPUs), os.Getenv(BazookaEnvMaxPids))
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.limits = limits
+
+	c.connector = c.openStore(os.Getenv(BazookaEnvStore))
+
+	if c.registryKey, err = loadRegistryKey(registryKeyFile); err != nil {
+		log.Fatalf("Cannot load the registry credentials key %s: %v", registryKeyFile, err)
 	}
-	c.connector = mongo.NewConnector()
 
 	fmt.Printf("server init, context=%#v\n", c)
 	return c
 }
 
+// serverRetentionPolicy reads the default retention policy of the projects from the environment
+func serverRetentionPolicy() *lib.RetentionPolicy {
+	policy := &lib.RetentionPolicy{}
+	if v := os.Getenv(BazookaEnvGCKeepJobs); len(v) > 0 {
+		keep, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("%s should be a number of jobs, got %s", BazookaEnvGCKeepJobs, v)
+		}
+		policy.KeepJobs = keep
+	}
+	if v := os.Getenv(BazookaEnvGCKeepDays); len(v) > 0 {
+		keep, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("%s should be a number of days, got %s", BazookaEnvGCKeepDays, v)
+		}
+		policy.KeepFor = time.Duration(keep) * 24 * time.Hour
+	}
+	return policy
+}
+
+func (c *context) openStore(kind string) store.Store {
+	switch kind {
+	case StoreBolt:
+		path := os.Getenv(BazookaEnvStorePath)
+		if len(path) == 0 {
+			path = BoltStorePath
+		}
+		s, err := store.NewBoltStore(path)
+		if err != nil {
+			log.Fatalf("Cannot open the bolt store %s: %v", path, err)
+		}
+		return s
+	case StoreMemory:
+		return store.NewMemoryStore()
+	case StoreMongo, "":
+		if err := lib.WaitForTcpConnection(c.mongoAddr, c.mongoPort, 100*time.Millisecond, 5*time.Second); err != nil {
+			log.Fatalf("Cannot connect to the database: %v", err)
+		}
+		connector := mongo.NewConnector()
+		if err := connector.Migrate(); err != nil {
+			log.Fatalf("Cannot migrate the database: %v", err)
+		}
+		return connector
+	default:
+		log.Fatalf("Unknown store %s, should be one of %s, %s or %s", kind, StoreMongo, StoreBolt, StoreMemory)
+		return nil
+	}
+}
+
 func (c *context) cleanup() {
 	c.connector.Close()
 }
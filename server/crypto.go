@@ -5,6 +5,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
 )
 
 func (c *context) encryptData(r *request) (*response, error) {
@@ -14,7 +15,7 @@ func (c *context) encryptData(r *request) (*response, error) {
 
 	_, err := c.connector.GetProjectById(r.vars["id"])
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("project not found")
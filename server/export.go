@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+)
+
+const exportFilePattern = "bazooka-%s.json.gz" // bazooka-$date.json.gz
+
+// export builds the state of the server: its projects with their keys, its users, its image mappings and its registry credentials.
+// The jobs and variants of the projects are only exported if withJobs is set, their logs never are
+func (c *context) export(withJobs bool) (*lib.Export, error) {
+	export := &lib.Export{
+		Version:  lib.ExportVersion,
+		Exported: time.Now(),
+	}
+
+	projects, err := c.connector.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		exported := &lib.ExportedProject{Project: project}
+
+		exported.Key, err = c.connector.GetProjectKey(project.ID)
+		if err != nil {
+			if _, keyNotFound := err.(*store.NotFoundError); !keyNotFound {
+				return nil, err
+			}
+		}
+		if exported.CryptoKeys, err = c.connector.GetCryptoKeys(project.ID); err != nil {
+			return nil, err
+		}
+		if exported.Registries, err = c.decryptedRegistryCredentials(project.ID); err != nil {
+			return nil, err
+		}
+
+		if withJobs {
+			if exported.Jobs, err = c.connector.GetJobs(project.ID); err != nil {
+				return nil, err
+			}
+			for _, job := range exported.Jobs {
+				variants, err := c.connector.GetVariants(job.ID)
+				if err != nil {
+					return nil, err
+				}
+				exported.Variants = append(exported.Variants, variants...)
+			}
+		}
+		export.Projects = append(export.Projects, exported)
+	}
+
+	if export.Users, err = c.connector.GetUsersWithPasswords(); err != nil {
+		return nil, err
+	}
+	if export.Images, err = c.connector.GetImages(); err != nil {
+		return nil, err
+	}
+	if export.Registries, err = c.decryptedRegistryCredentials(""); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func (c *context) exportState(r *request) (*response, error) {
+	export, err := c.export(len(r.query("jobs")) > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	r.w.Header().Set("Content-Type", "application/gzip")
+	r.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\""+exportFilePattern+"\"", export.Exported.Format("20060102-150405")))
+	r.w.WriteHeader(200)
+	if err := lib.WriteExport(r.w, export); err != nil {
+		log.Errorf("Error while writing the export archive: %v", err)
+	}
+	return nil, nil
+}
+
+// importState merges an export archive into the server.
+// Projects, users, images and global registry credentials already present on the server are kept as they are, their exported version being skipped.
+// The registry passwords are encrypted again with the key of the server
+func (c *context) importState(r *request) (*response, error) {
+	defer r.r.Body.Close()
+	export, err := lib.ReadExport(r.r.Body)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+
+	report := &lib.ImportReport{
+		Imported: []string{},
+		Skipped:  map[string]string{},
+	}
+
+	for _, image := range export.Images {
+		entry := "image " + image.Name
+		exists, err := c.connector.HasImage(image.Name)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			report.Skipped[entry] = "already exists"
+			continue
+		}
+		if err := c.connector.SetImage(image.Name, image.Image); err != nil {
+			return nil, err
+		}
+		report.Imported = append(report.Imported, entry)
+	}
+
+	for _, user := range export.Users {
+		entry := "user " + user.Email
+		exists, err := c.connector.HasUser(user.Email)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			report.Skipped[entry] = "already exists"
+			continue
+		}
+		if err := c.connector.RestoreUser(user); err != nil {
+			return nil, err
+		}
+		report.Imported = append(report.Imported, entry)
+	}
+
+	registries, err := c.connector.GetRegistryCredentials("")
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, credential := range registries {
+		existing[credential.Registry] = true
+	}
+	for _, credential := range export.Registries {
+		entry := "registry " + credential.Registry
+		if existing[credential.Registry] {
+			report.Skipped[entry] = "already exists"
+			continue
+		}
+		credential.ProjectID = ""
+		if err := c.storeRegistryCredential(credential); err != nil {
+			return nil, err
+		}
+		report.Imported = append(report.Imported, entry)
+	}
+
+	for _, project := range export.Projects {
+		entry := "project " + project.Name
+		skipped, err := c.importProject(project)
+		if err != nil {
+			return nil, err
+		}
+		if len(skipped) > 0 {
+			report.Skipped[entry] = skipped
+			continue
+		}
+		report.Imported = append(report.Imported, entry)
+	}
+
+	return ok(report)
+}
+
+// importProject restores an exported project with its keys, jobs and variants.
+// It returns why the project was skipped, if it was
+func (c *context) importProject(exported *lib.ExportedProject) (string, error) {
+	if exported.Project == nil {
+		return "no project data", nil
+	}
+	project := exported.Project
+
+	exists, err := c.connector.HasProject(project.Name)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "a project with the same name already exists", nil
+	}
+	if _, err := c.connector.GetProjectById(project.ID); err == nil {
+		return "a project with the same id already exists", nil
+	} else if _, notFound := err.(*store.NotFoundError); !notFound {
+		return "", err
+	}
+
+	if err := c.connector.RestoreProject(project); err != nil {
+		return "", err
+	}
+	if exported.Key != nil {
+		if err := c.connector.SetProjectKey(project.ID, exported.Key); err != nil {
+			return "", err
+		}
+	}
+	for _, key := range exported.CryptoKeys {
+		if err := c.connector.AddCryptoKey(key); err != nil {
+			return "", err
+		}
+	}
+	for _, credential := range exported.Registries {
+		credential.ProjectID = project.ID
+		if err := c.storeRegistryCredential(credential); err != nil {
+			return "", err
+		}
+	}
+
+	for _, job := range exported.Jobs {
+		// the orchestration of a job running during the export is not moved along
+		if job.Status == lib.JOB_RUNNING {
+			job.Status = lib.JOB_ERRORED
+		}
+		// the log archives are not part of the export, they may have been copied along with the bazooka home
+		archive := c.logArchivePath(job)
+		if archived, err := lib.FileExists(archive); err != nil {
+			return "", err
+		} else if archived {
+			job.LogArchive = archive
+		}
+		if err := c.connector.RestoreJob(job); err != nil {
+			return "", err
+		}
+	}
+	for _, variant := range exported.Variants {
+		if variant.Status == lib.JOB_RUNNING {
+			variant.Status = lib.JOB_ERRORED
+		}
+		if err := c.connector.RestoreVariant(variant); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportRegistryCredentials(t *testing.T) {
+	source := &context{connector: store.NewMemoryStore(), registryKey: []byte("0123456789abcdef0123456789abcdef")}
+	project := &lib.Project{Name: "bazooka", ScmType: "git", ScmURI: "git@example.com:bazooka.git"}
+	require.NoError(t, source.connector.AddProject(project))
+	require.NoError(t, source.storeRegistryCredential(&lib.RegistryCredential{Registry: "docker.io", Username: "bzk", Password: "hub-secret"}))
+	require.NoError(t, source.storeRegistryCredential(&lib.RegistryCredential{ProjectID: project.ID, Registry: "registry.example.com", Username: "ci", Password: "secret"}))
+
+	export, err := source.export(false)
+	require.NoError(t, err)
+	require.Len(t, export.Registries, 1)
+	assert.Equal(t, "hub-secret", export.Registries[0].Password, "the archive holds the decrypted passwords")
+	require.Len(t, export.Projects, 1)
+	require.Len(t, export.Projects[0].Registries, 1)
+	assert.Equal(t, "secret", export.Projects[0].Registries[0].Password)
+
+	var archive bytes.Buffer
+	require.NoError(t, lib.WriteExport(&archive, export))
+
+	target := &context{connector: store.NewMemoryStore(), registryKey: []byte("fedcba9876543210fedcba9876543210")}
+	r := mux.NewRouter()
+	r.Handle("/admin/import", mkHandler(target.importState)).Methods("POST")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/admin/import", &archive))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	stored, err := target.connector.GetRegistryCredentials(project.ID)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.NotEqual(t, "secret", stored[0].Password, "the imported passwords are stored encrypted")
+
+	credentials, err := target.registryCredentials(project.ID)
+	require.NoError(t, err)
+	require.Len(t, credentials, 2)
+	passwords := map[string]string{}
+	for _, credential := range credentials {
+		passwords[credential.Registry] = credential.Password
+	}
+	assert.Equal(t, map[string]string{"docker.io": "hub-secret", "registry.example.com": "secret"}, passwords)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+)
+
+const (
+	gcInterval = time.Hour
+
+	// project config keys overriding the retention policy of the server
+	keepJobsConfigKey = "bzk.gc.keep_jobs"
+	keepDaysConfigKey = "bzk.gc.keep_days"
+)
+
+// retentionPolicy returns the retention policy of a project: the server one, overridden by the project config
+func (c *context) retentionPolicy(project *lib.Project) (*lib.RetentionPolicy, error) {
+	policy := *c.retention
+	if v, set := project.Config[keepJobsConfigKey]; set {
+		keep, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s should be a number of jobs, got %s", keepJobsConfigKey, v)
+		}
+		policy.KeepJobs = keep
+	}
+	if v, set := project.Config[keepDaysConfigKey]; set {
+		keep, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s should be a number of days, got %s", keepDaysConfigKey, v)
+		}
+		policy.KeepFor = time.Duration(keep) * 24 * time.Hour
+	}
+	return &policy, nil
+}
+
+// startJanitor removes the build folders and variant images of the jobs not kept by the retention policies,
+// once when the server starts and then periodically
+func (c *context) startJanitor() {
+	c.runJanitor()
+	for range time.Tick(gcInterval) {
+		c.runJanitor()
+	}
+}
+
+func (c *context) runJanitor() {
+	report, err := c.collectGarbage(false)
+	if err != nil {
+		log.Errorf("Error while collecting the garbage: %v", err)
+		return
+	}
+	if len(report.Jobs) > 0 {
+		log.Infof("Garbage collected %d job(s), %d bytes freed", len(report.Jobs), report.Freed)
+	}
+	for project, reason := range report.Failed {
+		log.Errorf("Error while collecting the garbage of project %s: %v", project, reason)
+	}
+}
+
+// collectGarbage removes, unless dryRun is set, the build folders and variant images of the jobs not kept by the retention policies.
+// The log archives stored in the build folders are kept
+func (c *context) collectGarbage(dryRun bool) (*lib.GCReport, error) {
+	c.gcLock.Lock()
+	defer c.gcLock.Unlock()
+
+	report := &lib.GCReport{
+		DryRun: dryRun,
+		Jobs:   []*lib.GCJob{},
+		Failed: map[string]string{},
+	}
+
+	projects, err := c.connector.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+	images, err := c.imageIDs(buildImagePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// the jobs of all the projects are selected first: the images they share with the remaining jobs are kept
+	now := time.Now()
+	collectable := []*lib.Job{}
+	for _, project := range projects {
+		policy, err := c.retentionPolicy(project)
+		if err != nil {
+			report.Failed[project.ID] = err.Error()
+			continue
+		}
+		if !policy.Enabled() {
+			continue
+		}
+		jobs, err := c.connector.GetJobs(project.ID)
+		if err != nil {
+			report.Failed[project.ID] = err.Error()
+			continue
+		}
+		collectable = append(collectable, policy.Collectable(jobs, now)...)
+	}
+	prefixes := make([]string, len(collectable))
+	for i, job := range collectable {
+		prefixes[i] = fmt.Sprintf(jobImagePrefix, job.ProjectID, job.ID)
+	}
+
+	for i, job := range collectable {
+		collected := &lib.GCJob{
+			ProjectID: job.ProjectID,
+			JobID:     job.ID,
+			Number:    job.Number,
+			Images:    unreferencedImages(images, prefixes[i], prefixes),
+		}
+
+		folder := fmt.Sprintf(buildFolderPattern, c.paths.home.container, job.ProjectID, job.ID)
+		collected.Size, err = buildFolderSize(folder)
+		if err != nil {
+			report.Failed[job.ID] = err.Error()
+			continue
+		}
+		// already collected
+		if collected.Size == 0 && len(collected.Images) == 0 {
+			continue
+		}
+
+		if !dryRun {
+			if err := c.removeImageTags(collected.Images); err != nil {
+				report.Failed[job.ID] = err.Error()
+				continue
+			}
+			if err := cleanBuildFolder(folder); err != nil {
+				report.Failed[job.ID] = err.Error()
+				continue
+			}
+		}
+		report.Jobs = append(report.Jobs, collected)
+		report.Freed += collected.Size
+	}
+	return report, nil
+}
+
+// unreferencedImages returns the tags starting with prefix, among the tags of images (tag -> image id),
+// whose image is not tagged for a remaining job as well, i.e. with a tag starting with none of the collected prefixes
+func unreferencedImages(images map[string]string, prefix string, collected []string) []string {
+	referenced := map[string]bool{}
+	for tag, id := range images {
+		if !hasAnyPrefix(tag, collected) {
+			referenced[id] = true
+		}
+	}
+
+	tags := []string{}
+	for tag, id := range images {
+		if strings.HasPrefix(tag, prefix) && !referenced[id] {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildFolderSize returns the size of the files of a build folder, but its log archive
+func buildFolderSize(folder string) (int64, error) {
+	var size int64
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() && path != filepath.Join(folder, logArchiveFile) {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// cleanBuildFolder removes the content of a build folder, but its log archive
+func cleanBuildFolder(folder string) error {
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == logArchiveFile {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(folder, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *context) gc(r *request) (*response, error) {
+	report, err := c.collectGarbage(len(r.query("dry-run")) > 0)
+	if err != nil {
+		return nil, err
+	}
+	return ok(report)
+}
+
+func (c *context) pinJob(r *request) (*response, error) {
+	return c.setJobPinned(r, true)
+}
+
+func (c *context) unpinJob(r *request) (*response, error) {
+	return c.setJobPinned(r, false)
+}
+
+func (c *context) setJobPinned(r *request, pinned bool) (*response, error) {
+	job, err := c.connector.GetJobByID(r.vars["id"])
+	if err != nil {
+		if _, notFound := err.(*store.NotFoundError); !notFound {
+			return nil, err
+		}
+		return notFound("job not found")
+	}
+
+	if err := c.connector.SetJobPinned(job.ID, pinned); err != nil {
+		return nil, err
+	}
+	job.Pinned = pinned
+	return ok(job)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnreferencedImages(t *testing.T) {
+	images := map[string]string{
+		"bazooka-build/p1-j1-0": "a",
+		"bazooka-build/p1-j1-1": "b",
+		"bazooka-build/p1-j2-0": "c",
+		// built from the same layers as j1-1, for the kept job j3
+		"bazooka-build/p1-j3-0": "b",
+		// j2 and j4 are both collected
+		"bazooka-build/p2-j4-0": "c",
+	}
+	collected := []string{"bazooka-build/p1-j1-", "bazooka-build/p1-j2-", "bazooka-build/p2-j4-"}
+
+	assert.Equal(t, []string{"bazooka-build/p1-j1-0"}, unreferencedImages(images, "bazooka-build/p1-j1-", collected))
+	assert.Equal(t, []string{"bazooka-build/p1-j2-0"}, unreferencedImages(images, "bazooka-build/p1-j2-", collected))
+	assert.Equal(t, []string{"bazooka-build/p2-j4-0"}, unreferencedImages(images, "bazooka-build/p2-j4-", collected))
+	assert.Empty(t, unreferencedImages(images, "bazooka-build/p1-j5-", collected))
+}
@@ -76,6 +76,7 @@ func (ctx *context) startGithubJob(r *request) (*response, error) {
 	}
 
 	var ref string
+	tag := false
 	if branchRegexp.MatchString(payload.Ref) {
 		submatch := branchRegexp.FindStringSubmatch(payload.Ref)
 		if len(submatch) != 2 {
@@ -88,11 +89,13 @@ func (ctx *context) startGithubJob(r *request) (*response, error) {
 			return badRequest("Impossible to find submatch in regexp for tags")
 		}
 		ref = submatch[1]
+		tag = true
 	} else {
 		return badRequest("ref doesn't match any know regexp for tags or branch")
 	}
 
 	return ctx.startJob(r.vars, bazooka.StartJob{
 		ScmReference: ref,
+		Tag:          tag,
 	}, payload.HeadCommit.ID)
 }
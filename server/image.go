@@ -1,11 +1,19 @@
 package main
 
-import "strings"
+import (
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/bazooka-ci/bazooka/commons/store"
+	docker "github.com/bywan/go-dockercommand"
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
 
 func (c *context) getImage(r *request) (*response, error) {
 	image, err := c.connector.GetImage(r.vars["name"])
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("image not found")
@@ -39,3 +47,72 @@ func (c *context) setImage(r *request) (*response, error) {
 
 	return ok(b)
 }
+
+// prefixes of the tags of the images built for the variants of a project and of a job
+const (
+	buildImagePrefix   = "bazooka-build/"
+	projectImagePrefix = "bazooka-build/%s-"    // bazooka-build/$projectId-$jobId-$variantNumber
+	jobImagePrefix     = "bazooka-build/%s-%s-" // bazooka-build/$projectId-$jobId-$variantNumber
+)
+
+// imageTags returns the tags of the docker images starting with prefix
+func (c *context) imageTags(prefix string) ([]string, error) {
+	images, err := c.imageIDs(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(images))
+	for tag := range images {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// imageIDs returns the ids of the docker images, by their tags starting with prefix
+func (c *context) imageIDs(prefix string) (map[string]string, error) {
+	client, err := docker.NewDocker(c.paths.dockerEndpoint.container)
+	if err != nil {
+		return nil, err
+	}
+	images, err := client.Images(&docker.ImagesOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]string{}
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if strings.HasPrefix(tag, prefix) {
+				ids[tag] = image.ID
+			}
+		}
+	}
+	return ids, nil
+}
+
+// removeImages removes the docker images having a tag starting with prefix
+func (c *context) removeImages(prefix string) error {
+	tags, err := c.imageTags(prefix)
+	if err != nil {
+		return err
+	}
+	return c.removeImageTags(tags)
+}
+
+func (c *context) removeImageTags(tags []string) error {
+	api, err := dockerclient.NewClient(c.paths.dockerEndpoint.container)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, tag := range tags {
+		if err := api.RemoveImage(tag); err != nil {
+			log.Errorf("Error while removing the image %s: %v", tag, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 
+	log "github.com/Sirupsen/logrus"
 	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
 
 	"time"
 )
@@ -14,9 +16,15 @@ func (c *context) finishJob(r *request) (*response, error) {
 	if f.Time.IsZero() {
 		f.Time = time.Now()
 	}
-	if err := c.connector.FinishJob(r.vars["id"], f.Status, f.Time); err != nil {
+	if err := c.connector.FinishJob(r.vars["id"], f.Status, f.Time, f.Failure); err != nil {
 		return nil, err
 	}
+	c.forgetLogMasker(r.vars["id"])
+	go c.archiveJobLogsLater(r.vars["id"])
+	// the orchestration releases its leases as the variants finish, unless it failed before
+	if err := c.connector.ReleaseJobAgentLeases(r.vars["id"]); err != nil {
+		log.Errorf("Error while releasing the agent leases of job %s: %v", r.vars["id"], err)
+	}
 
 	return noContent()
 }
@@ -27,7 +35,7 @@ func (c *context) finishVariant(r *request) (*response, error) {
 	if f.Time.IsZero() {
 		f.Time = time.Now()
 	}
-	if err := c.connector.FinishVariant(r.vars["id"], f.Status, f.Time, f.Artifacts); err != nil {
+	if err := c.connector.FinishVariant(r.vars["id"], f.Status, f.Time, f.Artifacts, f.Failure); err != nil {
 		return nil, err
 	}
 
@@ -44,6 +52,41 @@ func (c *context) addJobScmData(r *request) (*response, error) {
 	return noContent()
 }
 
+func (c *context) setJobSecuredValues(r *request) (*response, error) {
+	var secured lib.SecuredValues
+	r.parseBody(&secured)
+
+	job, err := c.connector.GetJobByID(r.vars["id"])
+	if err != nil {
+		if !store.IsNotFound(err) {
+			return nil, err
+		}
+		return notFound("job not found")
+	}
+
+	if err := c.connector.SetJobSecuredValues(job.ID, secured.Values); err != nil {
+		return nil, err
+	}
+	// the secured values will be reloaded with the next log entry of this job
+	c.forgetLogMasker(job.ID)
+
+	return noContent()
+}
+
+func (c *context) setJobStages(r *request) (*response, error) {
+	var stages []*lib.JobStage
+	r.parseBody(&stages)
+
+	if err := c.connector.SetJobStages(r.vars["id"], stages); err != nil {
+		if _, notFound := err.(*store.NotFoundError); !notFound {
+			return nil, err
+		}
+		return notFound("job not found")
+	}
+
+	return noContent()
+}
+
 func (c *context) addVariant(r *request) (*response, error) {
 	var variant lib.Variant
 	r.parseBody(&variant)
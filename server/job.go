@@ -5,20 +5,26 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 
 	lib "github.com/bazooka-ci/bazooka/commons"
-	"github.com/bazooka-ci/bazooka/commons/mongo"
+	"github.com/bazooka-ci/bazooka/commons/store"
 	docker "github.com/bywan/go-dockercommand"
 )
 
 const (
+	projectFolderPattern      = "%s/build/%s"        // $bzk_home/build/$projectId
 	buildFolderPattern        = "%s/build/%s/%s"     // $bzk_home/build/$projectId/$buildId
 	sharedSourceFolderPattern = "%s/build/%s/source" // $bzk_home/build/$projectId/source
 	logFolderPattern          = "%s/build/%s/%s/log" // $bzk_home/build/$projectId/$buildId/log
+	projectCacheFolderPattern = "%s/build/%s/cache"  // $bzk_home/build/$projectId/cache
+	// out of the build folder, which is the context of the docker builds
+	registriesFilePattern = "%s/registries/%s" // $bzk_home/registries/$buildId
 )
 
 func (c *context) startBitbucketJob(r *request) (*response, error) {
@@ -39,6 +45,7 @@ func (c *context) startBitbucketJob(r *request) (*response, error) {
 		if changeType == "annotated_tag" || changeType == "tag" {
 			lastJobLaunchResponse, lastJobLaunchErr = c.startJob(r.vars, lib.StartJob{
 				ScmReference: change.New.Name,
+				Tag:          true,
 			}, "")
 		} else if changeType == "branch" {
 			lastJobLaunchResponse, lastJobLaunchErr = c.startJob(r.vars, lib.StartJob{
@@ -69,7 +76,7 @@ func (c *context) startJob(params map[string]string, startJob lib.StartJob, comm
 
 	project, err := c.connector.GetProjectById(params["id"])
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("project not found")
@@ -97,7 +104,7 @@ func (c *context) getJob(r *request) (*response, error) {
 
 	job, err := c.connector.GetJobByID(r.vars["id"])
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("job not found")
@@ -107,23 +114,36 @@ func (c *context) getJob(r *request) (*response, error) {
 }
 
 func (c *context) getJobs(r *request) (*response, error) {
-
-	jobs, err := c.connector.GetJobs(r.vars["id"])
-	if err != nil {
-		return nil, err
-	}
-
-	return ok(&jobs)
+	return c.findJobs(r, r.vars["id"])
 }
 
 func (c *context) getAllJobs(r *request) (*response, error) {
+	return c.findJobs(r, "")
+}
 
-	jobs, err := c.connector.GetAllJobs()
+// findJobs lists the jobs selected by the request query, the total count of matching jobs is sent in the X-Total-Count header
+func (c *context) findJobs(r *request, projectID string) (*response, error) {
+	query, err := lib.ParseJobQuery(r.r.URL.Query())
 	if err != nil {
-		return nil, err
+		return badRequest(err.Error())
+	}
+	query.ProjectID = projectID
+
+	jobs, total, err := c.connector.FindJobs(query)
+	if err != nil {
+		if _, notFound := err.(*store.NotFoundError); !notFound {
+			return nil, err
+		}
+		return notFound("project not found")
 	}
 
-	return ok(&jobs)
+	return &response{
+		Code:    200,
+		Payload: &jobs,
+		Headers: map[string]string{
+			lib.TotalCountHeader: strconv.Itoa(total),
+		},
+	}, nil
 }
 
 func (c *context) getJobLog(r *request) (*response, error) {
@@ -135,7 +155,7 @@ func (c *context) getJobLog(r *request) (*response, error) {
 	job, err := c.connector.GetJobByID(jid)
 
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("job not found")
@@ -146,11 +166,11 @@ func (c *context) getJobLog(r *request) (*response, error) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	logOutput := json.NewEncoder(w)
 
-	query := &mongo.LogExample{
-		JobID: jid,
+	query := &store.LogExample{
+		JobID: job.ID,
 	}
 
-	logs, err := c.connector.GetLog(query)
+	logs, err := c.getLogs(job, query)
 	if !follow {
 		logOutput.Encode(logs)
 		return nil, nil
@@ -267,7 +287,7 @@ func (c *context) runJob(startJob *lib.StartJob, runningJob *lib.Job, commitID s
 
 	projectSSHKey, err := c.connector.GetProjectKey(project.ID)
 	if err != nil {
-		_, keyNotFound := err.(*mongo.NotFoundError)
+		_, keyNotFound := err.(*store.NotFoundError)
 		if !keyNotFound {
 			log.Errorf("Error getting Project SSH Key from Mongo: %v", err)
 		}
@@ -291,7 +311,7 @@ func (c *context) runJob(startJob *lib.StartJob, runningJob *lib.Job, commitID s
 
 	projectCryptoKey, err := c.connector.GetProjectCryptoKey(project.ID)
 	if err != nil {
-		_, keyNotFound := err.(*mongo.NotFoundError)
+		_, keyNotFound := err.(*store.NotFoundError)
 		if !keyNotFound {
 			log.Errorf("Error getting Project Crypto Key from Mongo: %v", err)
 		}
@@ -309,10 +329,41 @@ func (c *context) runJob(startJob *lib.StartJob, runningJob *lib.Job, commitID s
 		orchestrationEnv["BZK_CRYPTO_KEYFILE"] = fmt.Sprintf("%s/crypto-key", buildFolder.host)
 	}
 
+	// the orchestration, the parsers and the variants pull their images from the private registries with these credentials
+	var registriesVolume string
+	registryCredentials, err := c.registryCredentials(project.ID)
+	if err != nil {
+		log.Errorf("Error getting the registry credentials of project %s: %v", project.ID, err)
+	} else if len(registryCredentials) > 0 {
+		registriesFile := path{
+			host:      fmt.Sprintf(registriesFilePattern, c.paths.home.host, runningJob.ID),
+			container: fmt.Sprintf(registriesFilePattern, c.paths.home.container, runningJob.ID),
+		}
+		err = os.MkdirAll(filepath.Dir(registriesFile.container), 0700)
+		if err != nil {
+			log.Errorf("Error creating registry credentials folder %s: %v", filepath.Dir(registriesFile.container), err)
+		}
+
+		if err := lib.WriteRegistryCredentials(registriesFile.container, registryCredentials); err != nil {
+			log.Errorf("Error writing registry credentials file in container %s: %v", registriesFile.container, err)
+		}
+		// the credentials are only needed while the orchestration runs
+		defer os.Remove(registriesFile.container)
+		orchestrationEnv["BZK_REGISTRY_CREDENTIALS"] = registriesFile.host
+		registriesVolume = fmt.Sprintf("%s:/bazooka-registries:ro", registriesFile.host)
+
+		if err := c.pullImage(registryCredentials, orchestrationImage.Image); err != nil {
+			log.Errorf("Failed to pull the orchestration image %s: %v", orchestrationImage.Image, err)
+		}
+	}
+
 	orchestrationVolumes := []string{
 		fmt.Sprintf("%s:/bazooka", buildFolder.host),
 		fmt.Sprintf("%s:/var/run/docker.sock", c.paths.dockerSock.host),
 	}
+	if len(registriesVolume) > 0 {
+		orchestrationVolumes = append(orchestrationVolumes, registriesVolume)
+	}
 
 	reuseScmCheckout := project.Config["bzk.scm.reuse"] == "true"
 	if reuseScmCheckout {
@@ -339,6 +390,47 @@ func (c *context) runJob(startJob *lib.StartJob, runningJob *lib.Job, commitID s
 		orchestrationVolumes = append(orchestrationVolumes, fmt.Sprintf("%s:/bazooka/source", sharedSourceFolder.host))
 	}
 
+	cacheFolder := path{
+		host:      fmt.Sprintf(projectCacheFolderPattern, c.paths.home.host, runningJob.ProjectID),
+		container: fmt.Sprintf(projectCacheFolderPattern, c.paths.home.container, runningJob.ProjectID),
+	}
+	if err := os.MkdirAll(cacheFolder.container, 0755); err != nil {
+		log.Errorf("Failed to create the cache directory for project %s, job %s: %v", runningJob.ProjectID, runningJob.ID, err)
+	} else {
+		orchestrationEnv["BZK_CACHE"] = cacheFolder.host
+		orchestrationEnv["BZK_CACHE_KEY"] = cacheKey(startJob.ScmReference)
+		orchestrationEnv["BZK_CACHE_FALLBACK_KEY"] = cacheKey(defaultBranch(project))
+		orchestrationVolumes = append(orchestrationVolumes, fmt.Sprintf("%s:/bazooka/cache", cacheFolder.host))
+	}
+
+	// the orchestration authenticates to the Docker API of the build agents with the client certificate of the server
+	if len(c.paths.agentCerts.host) > 0 {
+		orchestrationVolumes = append(orchestrationVolumes, fmt.Sprintf("%s:/bazooka-agent-certs:ro", c.paths.agentCerts.host))
+		orchestrationEnv[BazookaEnvAgentCerts] = c.paths.agentCerts.host
+	}
+
+	// the deploy conditions apply to the branch or tag name, even when a commit is built
+	orchestrationEnv["BZK_SCM_REFERENCE_NAME"] = startJob.ScmReference
+	if startJob.Tag {
+		orchestrationEnv["BZK_SCM_TAG"] = "1"
+	}
+
+	if max := c.maxParallelVariants(project); max > 0 {
+		orchestrationEnv["BZK_MAX_PARALLEL"] = strconv.Itoa(max)
+	}
+
+	// the variants of isolated projects have no outbound network access
+	if project.Config[isolatedConfigKey] == "true" {
+		orchestrationEnv["BZK_NETWORK_ISOLATED"] = "1"
+	}
+
+	maxResources, err := c.maxResources(project)
+	if err != nil {
+		log.Errorf("%v, using the server ones", err)
+		maxResources = c.limits
+	}
+	resourcesEnv(maxResources, orchestrationEnv)
+
 	container, err := client.Run(&docker.RunOptions{
 		Image:         orchestrationImage.Image,
 		VolumeBinds:   orchestrationVolumes,
@@ -379,3 +471,22 @@ func (c *context) runJob(startJob *lib.StartJob, runningJob *lib.Job, commitID s
 		log.Error(err.Error())
 	}
 }
+
+// project config key disabling the outbound network access of the variants
+const isolatedConfigKey = "bzk.network.isolated"
+
+// project config key overriding the server-wide maximum number of variants of a job built and run at once
+const maxParallelConfigKey = "bzk.variants.max_parallel"
+
+func (c *context) maxParallelVariants(project *lib.Project) int {
+	v, ok := project.Config[maxParallelConfigKey]
+	if !ok || len(v) == 0 {
+		return c.maxParallel
+	}
+	max, err := strconv.Atoi(v)
+	if err != nil || max < 0 {
+		log.Errorf("Invalid %s value %q for project %s, using the server default", maxParallelConfigKey, v, project.ID)
+		return c.maxParallel
+	}
+	return max
+}
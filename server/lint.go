@@ -0,0 +1,20 @@
+package main
+
+import (
+	lib "github.com/bazooka-ci/bazooka/commons"
+)
+
+func (c *context) lint(r *request) (*response, error) {
+	var req lib.LintRequest
+	r.parseBody(&req)
+
+	if len(req.Content) == 0 {
+		return badRequest("content is mandatory")
+	}
+
+	errs := req.Lint()
+	return ok(&lib.LintReport{
+		Valid:  len(errs) == 0,
+		Errors: errs,
+	})
+}
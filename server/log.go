@@ -3,6 +3,8 @@ package main
 import (
 	"bufio"
 	"net"
+	"sync"
+	"time"
 
 	"io"
 
@@ -28,8 +30,28 @@ func (c *context) startLogServer(iface string) {
 	}
 }
 
+const (
+	// a batch of log entries is written as soon as it reaches logBatchSize entries or is logBatchDelay old
+	logBatchSize  = 200
+	logBatchDelay = 500 * time.Millisecond
+	// number of parsed entries a connection can buffer before it stops being read
+	logBacklogSize = 4 * logBatchSize
+)
+
 func (c *context) handleLogConn(conn net.Conn) {
 	defer conn.Close()
+
+	// entries are read and written by different goroutines: when the database cannot keep up,
+	// the backlog fills up and the connection is not read anymore until some entries are written
+	entries := make(chan lib.LogEntry, logBacklogSize)
+	written := make(chan struct{})
+	go c.writeLogBatches(entries, written)
+	defer func() {
+		close(entries)
+		<-written
+	}()
+
+	var seq int64
 	r := bufio.NewReader(conn)
 	for {
 		line, err := r.ReadBytes('\n')
@@ -45,16 +67,129 @@ func (c *context) handleLogConn(conn net.Conn) {
 			return
 		}
 
+		seq++
 		template := lib.LogEntry{
 			ProjectID: p.Meta["project"],
 			JobID:     p.Meta["job"],
 			VariantID: p.Meta["variant"],
 			Image:     p.Meta["image"],
 			Time:      p.Timestamp,
+			Seq:       seq,
+		}
+		content := c.logMasker(template.JobID).Mask(p.Content)
+		entries <- lib.ConstructLog(content, template)
+	}
+}
+
+func (c *context) writeLogBatches(entries <-chan lib.LogEntry, written chan<- struct{}) {
+	defer close(written)
+
+	ticker := time.NewTicker(logBatchDelay)
+	defer ticker.Stop()
+
+	batch := make([]lib.LogEntry, 0, logBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
 		}
-		entry := lib.ConstructLog(p.Content, template)
-		if err := c.connector.AddLog(&entry); err != nil {
-			log.Errorf("Error adding log entry %v: %v", entry, err)
+		if err := c.connector.AddLogs(batch); err != nil {
+			log.Errorf("Error adding %d log entries: %v", len(batch), err)
 		}
+		for i := range batch {
+			if err := c.recordVariantMarkers(&batch[i]); err != nil {
+				log.Errorf("Error recording the markers of log entry %v: %v", batch[i], err)
+			}
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry, more := <-entries:
+			if !more {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= logBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// recordVariantMarkers persists on the variant the metadata, artifacts and summary
+// the build reported with the <META:...>, <ARTIFACT:...> and <SUMMARY:...> markers
+func (c *context) recordVariantMarkers(entry *lib.LogEntry) error {
+	if len(entry.VariantID) == 0 {
+		return nil
+	}
+	switch {
+	case len(entry.MetaName) > 0:
+		return c.connector.SetVariantMetadata(entry.VariantID, entry.MetaName, entry.MetaValue)
+	case len(entry.Artifact) > 0:
+		return c.connector.AddVariantArtifact(entry.VariantID, entry.Artifact)
+	case len(entry.Summary) > 0:
+		return c.connector.AppendVariantSummary(entry.VariantID, entry.Summary)
 	}
+	return nil
+}
+
+// maskers caches, for every running job, a masker hiding the job secured values
+type maskers struct {
+	sync.Mutex
+	byJob map[string]*lib.Masker
+}
+
+func (c *context) logMasker(jobID string) *lib.Masker {
+	if len(jobID) == 0 {
+		return nil
+	}
+
+	c.maskers.Lock()
+	defer c.maskers.Unlock()
+	if m, found := c.maskers.byJob[jobID]; found {
+		return m
+	}
+
+	job, err := c.connector.GetJobByID(jobID)
+	if err != nil {
+		// do not cache the failure, the next log entry will retry
+		log.Errorf("Error while loading the secured values of job %s: %v", jobID, err)
+		return nil
+	}
+	m, err := c.loadLogMasker(job)
+	if err != nil {
+		log.Errorf("Error while loading the secured values of job %s: %v", jobID, err)
+		return nil
+	}
+	// the entry of a finished job is never forgotten: only cache the running ones
+	if job.Status == lib.JOB_RUNNING {
+		c.maskers.byJob[jobID] = m
+	}
+	return m
+}
+
+func (c *context) loadLogMasker(job *lib.Job) (*lib.Masker, error) {
+	if len(job.SecuredValues) == 0 {
+		return lib.NewMasker(nil), nil
+	}
+
+	key, err := c.connector.GetProjectCryptoKey(job.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := lib.DecryptSecuredValues(key.Content, job.SecuredValues)
+	if err != nil {
+		return nil, err
+	}
+	return lib.NewMasker(secrets), nil
+}
+
+func (c *context) forgetLogMasker(jobID string) {
+	c.maskers.Lock()
+	defer c.maskers.Unlock()
+	delete(c.maskers.byJob, jobID)
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogMasker(t *testing.T) {
+	c := &context{connector: store.NewMemoryStore(), maskers: &maskers{byJob: map[string]*lib.Masker{}}}
+	project := &lib.Project{Name: "bazooka", ScmType: "git", ScmURI: "git@example.com:bazooka.git"}
+	require.NoError(t, c.connector.AddProject(project))
+	key := []byte("0123456789abcdef0123456789abcdef")
+	require.NoError(t, c.connector.AddCryptoKey(&lib.CryptoKey{ProjectID: project.ID, Content: key}))
+
+	job := &lib.Job{ProjectID: project.ID}
+	require.NoError(t, c.connector.AddJob(job))
+	encrypted, err := lib.Encrypt(key, []byte("TOKEN=s3cr3t"))
+	require.NoError(t, err)
+	require.NoError(t, c.connector.SetJobSecuredValues(job.ID, []string{hex.EncodeToString(encrypted)}))
+
+	assert.Equal(t, "token ****", c.logMasker(job.ID).Mask("token s3cr3t"))
+	assert.Contains(t, c.maskers.byJob, job.ID, "the masker of a running job is cached")
+
+	require.NoError(t, c.connector.FinishJob(job.ID, lib.JOB_SUCCESS, time.Now(), nil))
+	c.forgetLogMasker(job.ID)
+	assert.NotContains(t, c.maskers.byJob, job.ID)
+
+	// a log entry received once the job finished is still masked, without caching its masker again
+	assert.Equal(t, "token ****", c.logMasker(job.ID).Mask("token s3cr3t"))
+	assert.NotContains(t, c.maskers.byJob, job.ID)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+)
+
+const (
+	// leave some time to the last log entries of a finished job to reach the syslog server
+	logArchiveDelay   = 30 * time.Second
+	logArchivePattern = "%s/%s/%s.ndjson.gz" // $log_store/$projectId/$buildId.ndjson.gz
+	logArchiveFile    = "logs.ndjson.gz"
+)
+
+func (c *context) logArchivePath(job *lib.Job) string {
+	if len(c.logStore) > 0 {
+		return fmt.Sprintf(logArchivePattern, c.logStore, job.ProjectID, job.ID)
+	}
+	return fmt.Sprintf(buildFolderPattern, c.paths.home.container, job.ProjectID, job.ID) + "/" + logArchiveFile
+}
+
+func (c *context) archiveJobLogsLater(jobID string) {
+	time.Sleep(logArchiveDelay)
+	if err := c.archiveJobLogs(jobID); err != nil {
+		log.Errorf("Error while archiving the logs of job %s: %v", jobID, err)
+	}
+}
+
+// archiveJobLogs moves the log entries of a finished job from the logs collection to a compressed archive
+func (c *context) archiveJobLogs(jobID string) error {
+	c.archiveLock.Lock()
+	defer c.archiveLock.Unlock()
+
+	job, err := c.connector.GetJobByID(jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status == lib.JOB_RUNNING {
+		return fmt.Errorf("job %s is still running", job.ID)
+	}
+	if len(job.LogArchive) > 0 {
+		return nil
+	}
+
+	logs, err := c.connector.GetLog(&store.LogExample{
+		JobID: job.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	archive := c.logArchivePath(job)
+	if err := os.MkdirAll(filepath.Dir(archive), 0755); err != nil {
+		return err
+	}
+	tmp := archive + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := lib.WriteLogArchive(f, logs); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, archive); err != nil {
+		return err
+	}
+
+	if err := c.connector.SetJobLogArchive(job.ID, archive); err != nil {
+		return err
+	}
+
+	// only remove the archived entries, late ones stay in the logs collection and are still served
+	ids := make([]string, len(logs))
+	for i, l := range logs {
+		ids[i] = l.ID
+	}
+	return c.connector.RemoveLogs(job.ID, ids)
+}
+
+// getLogs returns the log entries of a job matching the query, reading its archive if any.
+// The ids in the query must be complete ids, not prefixes
+func (c *context) getLogs(job *lib.Job, query *store.LogExample) ([]lib.LogEntry, error) {
+	hot, err := c.connector.GetLog(query)
+	if err != nil || len(job.LogArchive) == 0 {
+		return hot, err
+	}
+
+	f, err := os.Open(job.LogArchive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	archived, err := lib.ReadLogArchive(f, func(l *lib.LogEntry) bool {
+		return query.Match(l)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(archived, hot...), nil
+}
+
+func (c *context) archiveLogs(r *request) (*response, error) {
+	jobs, err := c.connector.GetJobsWithHotLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &lib.LogArchiveReport{
+		Archived: []string{},
+		Failed:   map[string]string{},
+	}
+	for _, job := range jobs {
+		if err := c.archiveJobLogs(job.ID); err != nil {
+			report.Failed[job.ID] = err.Error()
+			continue
+		}
+		report.Archived = append(report.Archived, job.ID)
+	}
+
+	return ok(report)
+}
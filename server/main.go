@@ -10,8 +10,9 @@ import (
 	"syscall"
 
 	log "github.com/Sirupsen/logrus"
+	lib "github.com/bazooka-ci/bazooka/commons"
 	bzklog "github.com/bazooka-ci/bazooka/commons/logs"
-	"github.com/bazooka-ci/bazooka/commons/mongo"
+	"github.com/bazooka-ci/bazooka/commons/store"
 	"github.com/gorilla/mux"
 )
 
@@ -35,6 +36,7 @@ func main() {
 
 	r.HandleFunc("/project", context.mkAuthHandler(context.getProjects)).Methods("GET")
 	r.HandleFunc("/project/{id}", context.mkAuthHandler(context.getProject)).Methods("GET")
+	r.HandleFunc("/project/{id}", context.mkAuthHandler(context.deleteProject)).Methods("DELETE")
 	r.HandleFunc("/project/{id}/job", context.mkAuthHandler(context.startStandardJob)).Methods("POST")
 	r.HandleFunc("/project/{id}/job", context.mkAuthHandler(context.getJobs)).Methods("GET")
 
@@ -47,23 +49,47 @@ func main() {
 
 	r.HandleFunc("/project/{id}/crypto", context.mkAuthHandler(context.encryptData)).Methods("PUT")
 
+	r.HandleFunc("/project/{id}/registry", context.mkAuthHandler(context.getRegistryCredentials)).Methods("GET")
+	r.HandleFunc("/project/{id}/registry/{registry}", context.mkAuthHandler(context.setRegistryCredential)).Methods("PUT")
+	r.HandleFunc("/project/{id}/registry/{registry}", context.mkAuthHandler(context.removeRegistryCredential)).Methods("DELETE")
+
+	r.HandleFunc("/project/{id}/cache", context.mkAuthHandler(context.clearCache)).Methods("DELETE")
+
 	r.HandleFunc("/job", context.mkAuthHandler(context.getAllJobs)).Methods("GET")
 	r.HandleFunc("/job/{id}", context.mkAuthHandler(context.getJob)).Methods("GET")
 	r.HandleFunc("/job/{id}/log", context.mkAuthHandler(context.getJobLog)).Methods("GET")
 	r.HandleFunc("/job/{id}/variant", context.mkAuthHandler(context.getVariants)).Methods("GET")
+	r.HandleFunc("/job/{id}/pin", context.mkAuthHandler(context.pinJob)).Methods("PUT")
+	r.HandleFunc("/job/{id}/pin", context.mkAuthHandler(context.unpinJob)).Methods("DELETE")
 
 	r.HandleFunc("/variant/{id}", context.mkAuthHandler(context.getVariant)).Methods("GET")
 	r.HandleFunc("/variant/{id}/log", context.mkAuthHandler(context.getVariantLog)).Methods("GET")
+	r.HandleFunc("/variant/{id}/steps", context.mkAuthHandler(context.getVariantSteps)).Methods("GET")
 	r.HandleFunc("/variant/{id}/artifacts/{path:.*}", context.mkAuthHandler(context.getVariantArtifact)).Methods("GET")
 
 	r.HandleFunc("/image", context.mkAuthHandler(context.getImages)).Methods("GET")
 	r.HandleFunc("/image/{name:.*}", context.mkAuthHandler(context.getImage)).Methods("GET")
 	r.HandleFunc("/image/{name:.*}", context.mkAuthHandler(context.setImage)).Methods("PUT")
 
+	r.HandleFunc("/registry", context.mkAuthHandler(context.getRegistryCredentials)).Methods("GET")
+	r.HandleFunc("/registry/{registry}", context.mkAuthHandler(context.setRegistryCredential)).Methods("PUT")
+	r.HandleFunc("/registry/{registry}", context.mkAuthHandler(context.removeRegistryCredential)).Methods("DELETE")
+
+	r.HandleFunc("/agent", context.mkAuthHandler(context.getAgents)).Methods("GET")
+	r.HandleFunc("/agent/{name}", context.mkAuthHandler(context.registerAgent)).Methods("PUT")
+	r.HandleFunc("/agent/{name}", context.mkAuthHandler(context.removeAgent)).Methods("DELETE")
+
+	r.HandleFunc("/lint", context.mkAuthHandler(context.lint)).Methods("POST")
+
 	r.HandleFunc("/user", context.mkAuthHandler(context.getUsers)).Methods("GET")
 	r.HandleFunc("/user", context.mkAuthHandler(context.createUser)).Methods("POST")
 	r.HandleFunc("/user/{id}", context.mkAuthHandler(context.getUser)).Methods("GET")
 
+	r.HandleFunc("/admin/logs/archive", context.mkAuthHandler(context.archiveLogs)).Methods("POST")
+	r.HandleFunc("/admin/export", context.mkAuthHandler(context.exportState)).Methods("GET")
+	r.HandleFunc("/admin/import", context.mkAuthHandler(context.importState)).Methods("POST")
+	r.HandleFunc("/admin/gc", context.mkAuthHandler(context.gc)).Methods("POST")
+
 	r.HandleFunc("/project/{id}/bitbucket", context.mkAuthHandler(context.startBitbucketJob)).Methods("POST")
 	r.HandleFunc("/project/{id}/github", context.mkGithubAuthHandler(context.startGithubJob)).Methods("POST")
 
@@ -73,8 +99,13 @@ func main() {
 		i.HandleFunc("/project/{id}/crypto-key", context.mkInternalApiHandler(context.getCryptoKey)).Methods("GET")
 		i.HandleFunc("/job/{id}/finish", context.mkInternalApiHandler(context.finishJob)).Methods("POST")
 		i.HandleFunc("/job/{id}/scm", context.mkInternalApiHandler(context.addJobScmData)).Methods("PUT")
+		i.HandleFunc("/job/{id}/secured", context.mkInternalApiHandler(context.setJobSecuredValues)).Methods("PUT")
+		i.HandleFunc("/job/{id}/stages", context.mkInternalApiHandler(context.setJobStages)).Methods("PUT")
 		i.HandleFunc("/variant/{id}/finish", context.mkInternalApiHandler(context.finishVariant)).Methods("POST")
 		i.HandleFunc("/variant", context.mkInternalApiHandler(context.addVariant)).Methods("POST")
+		i.HandleFunc("/agent", context.mkInternalApiHandler(context.getAgents)).Methods("GET")
+		i.HandleFunc("/agent/{name}/lease/{job}/{lease}", context.mkInternalApiHandler(context.acquireAgentLease)).Methods("PUT")
+		i.HandleFunc("/agent/{name}/lease/{job}/{lease}", context.mkInternalApiHandler(context.releaseAgentLease)).Methods("DELETE")
 	}
 
 	http.Handle("/", r)
@@ -89,31 +120,16 @@ func main() {
 		context.startLogServer(":3001")
 	}()
 
+	go context.startJanitor()
+
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGTERM)
 	<-signals
 	log.Infof("Got SIGTERM, Exiting")
 }
 
-var (
-	defaultImages = map[string]string{
-		"orchestration":  "bazooka/orchestration",
-		"parser":         "bazooka/parser",
-		"scm/fetch/git":  "bazooka/scm-git",
-		"scm/fetch/hg":   "bazooka/scm-hg",
-		"parser/golang":  "bazooka/parser-golang",
-		"parser/go":      "bazooka/parser-golang",
-		"parser/java":    "bazooka/parser-java",
-		"parser/python":  "bazooka/parser-python",
-		"parser/ruby":    "bazooka/parser-ruby",
-		"parser/node_js": "bazooka/parser-nodejs",
-		"parser/nodejs":  "bazooka/parser-nodejs",
-		"parser/php":     "bazooka/parser-php",
-	}
-)
-
-func ensureDefaultImagesExist(c *mongo.MongoConnector) error {
-	for name, image := range defaultImages {
+func ensureDefaultImagesExist(c store.Store) error {
+	for name, image := range lib.DefaultImages {
 		exist, err := c.HasImage(name)
 		if err != nil {
 			return err
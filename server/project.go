@@ -3,10 +3,15 @@ package main
 import (
 	"fmt"
 	"math/rand"
+	"os"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+	docker "github.com/bywan/go-dockercommand"
+	dockerclient "github.com/fsouza/go-dockerclient"
 )
 
 func (p *context) createProject(r *request) (*response, error) {
@@ -64,7 +69,7 @@ func randSeq(n int) string {
 func (p *context) getProject(r *request) (*response, error) {
 	project, err := p.connector.GetProjectById(r.vars["id"])
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("project not found")
@@ -94,7 +99,7 @@ func (c *context) getProjects(r *request) (*response, error) {
 func (p *context) getProjectConfig(r *request) (*response, error) {
 	project, err := p.connector.GetProjectById(r.vars["id"])
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("project not found")
@@ -116,7 +121,7 @@ func (p *context) setProjectConfigKey(r *request) (*response, error) {
 
 func (p *context) unsetProjectConfigKey(r *request) (*response, error) {
 	if err := p.connector.UnsetProjectConfigKey(r.vars["id"], r.vars["key"]); err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("project not found")
@@ -124,3 +129,182 @@ func (p *context) unsetProjectConfigKey(r *request) (*response, error) {
 
 	return noContent()
 }
+
+func (c *context) deleteProject(r *request) (*response, error) {
+	force := len(r.query("force")) > 0
+
+	project, err := c.connector.GetProjectById(r.vars["id"])
+	if err != nil {
+		if _, notFound := err.(*store.NotFoundError); !notFound {
+			return nil, err
+		}
+		return notFound("project not found")
+	}
+
+	jobs, err := c.connector.GetJobs(project.ID)
+	if err != nil {
+		return nil, err
+	}
+	running := []*lib.Job{}
+	for _, job := range jobs {
+		if job.Status == lib.JOB_RUNNING {
+			running = append(running, job)
+		}
+	}
+	if len(running) > 0 && !force {
+		return conflict(fmt.Sprintf("project has %d running job(s), force the deletion to stop them", len(running)))
+	}
+
+	client, err := docker.NewDocker(c.paths.dockerEndpoint.container)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range running {
+		if len(job.OrchestrationID) == 0 {
+			continue
+		}
+		if err := client.Rm(&docker.RmOptions{
+			Container: []string{job.OrchestrationID},
+			Force:     true,
+		}); err != nil {
+			log.Errorf("Error while removing the orchestration container of job %s: %v", job.ID, err)
+		}
+	}
+	if len(running) > 0 {
+		if err := c.removeJobsContainers(project.ID, running); err != nil {
+			log.Errorf("Error while removing the containers of the running jobs of project %s: %v", project.ID, err)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"project": project,
+	}).Info("Deleting project")
+	if err := c.connector.DeleteProject(project.ID); err != nil {
+		return nil, err
+	}
+
+	// the project is gone from the database, failing to clean its files or images up is not fatal
+	folders := []string{fmt.Sprintf(projectFolderPattern, c.paths.home.container, project.ID)}
+	if len(c.logStore) > 0 {
+		folders = append(folders, fmt.Sprintf("%s/%s", c.logStore, project.ID))
+	}
+	for _, folder := range folders {
+		if err := os.RemoveAll(folder); err != nil {
+			log.Errorf("Error while removing the folder %s of project %s: %v", folder, project.ID, err)
+		}
+	}
+	if err := c.removeImages(fmt.Sprintf(projectImagePrefix, project.ID)); err != nil {
+		log.Errorf("Error while removing the build images of project %s: %v", project.ID, err)
+	}
+
+	return noContent()
+}
+
+// removeJobsContainers removes the variant, service and deploy containers of the running jobs of a project,
+// then the networks of their variants, from the Docker host of the server and from the build agents which ran some of their variants.
+// The images built on the agents are removed as well: the orchestration only removes them once the job finished
+func (c *context) removeJobsContainers(projectID string, running []*lib.Job) error {
+	api, err := dockerclient.NewClient(c.paths.dockerEndpoint.container)
+	if err != nil {
+		return err
+	}
+	lastErr := removeProjectContainers(api, projectID)
+
+	agents, err := c.jobsAgents(running)
+	if err != nil {
+		return err
+	}
+	for _, agent := range agents {
+		api, err := c.agentClient(agent)
+		if err != nil {
+			log.Errorf("Error while connecting to the Docker API of agent %s: %v", agent.Name, err)
+			lastErr = err
+			continue
+		}
+		if err := removeProjectContainers(api, projectID); err != nil {
+			log.Errorf("Error while removing the containers of project %s from agent %s: %v", projectID, agent.Name, err)
+			lastErr = err
+		}
+		if err := removeProjectImages(api, projectID); err != nil {
+			log.Errorf("Error while removing the build images of project %s from agent %s: %v", projectID, agent.Name, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// removeProjectContainers removes the variant, service and deploy containers of a project from a Docker host,
+// then the networks of its variants, whose names all start with the project id
+func removeProjectContainers(api *dockerclient.Client, projectID string) error {
+	containers, err := api.ListContainers(dockerclient.ListContainersOptions{All: true})
+	if err != nil {
+		return err
+	}
+	prefixes := []string{
+		fmt.Sprintf("/bazooka-variant-%s-", projectID),
+		fmt.Sprintf("/bazooka-service-%s-", projectID),
+		fmt.Sprintf("/bazooka-deploy-%s-", projectID),
+	}
+	var lastErr error
+	for _, container := range containers {
+		if !hasNamePrefix(container.Names, prefixes) {
+			continue
+		}
+		if err := api.RemoveContainer(dockerclient.RemoveContainerOptions{
+			ID:            container.ID,
+			Force:         true,
+			RemoveVolumes: true,
+		}); err != nil {
+			log.Errorf("Error while removing the container %v: %v", container.Names, err)
+			lastErr = err
+		}
+	}
+
+	networks, err := api.ListNetworks()
+	if err != nil {
+		return err
+	}
+	for _, network := range networks {
+		if !strings.HasPrefix(network.Name, fmt.Sprintf("bazooka-%s-", projectID)) {
+			continue
+		}
+		if err := api.RemoveNetwork(network.ID); err != nil {
+			log.Errorf("Error while removing the network %s: %v", network.Name, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// removeProjectImages removes the variant images of a project from a Docker host
+func removeProjectImages(api *dockerclient.Client, projectID string) error {
+	images, err := api.ListImages(dockerclient.ListImagesOptions{})
+	if err != nil {
+		return err
+	}
+	prefix := fmt.Sprintf(projectImagePrefix, projectID)
+	var lastErr error
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if !strings.HasPrefix(tag, prefix) {
+				continue
+			}
+			if err := api.RemoveImage(tag); err != nil {
+				log.Errorf("Error while removing the image %s: %v", tag, err)
+				lastErr = err
+			}
+		}
+	}
+	return lastErr
+}
+
+func hasNamePrefix(names, prefixes []string) bool {
+	for _, name := range names {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+// the key encrypting the passwords of the registry credentials, created with the home of the server
+const registryKeyFile = BazookaHome + "/registry-key"
+
+func loadRegistryKey(file string) ([]byte, error) {
+	key, err := ioutil.ReadFile(file)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(file, key, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// registryScope returns the id of the project of the request, or an empty id for the global credentials
+func (c *context) registryScope(r *request) (string, *response, error) {
+	id, scoped := r.vars["id"]
+	if !scoped {
+		return "", nil, nil
+	}
+	project, err := c.connector.GetProjectById(id)
+	if err != nil {
+		if _, notFound := err.(*store.NotFoundError); !notFound {
+			return "", nil, err
+		}
+		res, err := notFound("project not found")
+		return "", res, err
+	}
+	return project.ID, nil, nil
+}
+
+func (c *context) setRegistryCredential(r *request) (*response, error) {
+	projectID, res, err := c.registryScope(r)
+	if res != nil || err != nil {
+		return res, err
+	}
+
+	var credential lib.RegistryCredential
+	r.parseBody(&credential)
+	credential.ProjectID = projectID
+	credential.Registry = lib.NormalizeRegistry(r.vars["registry"])
+	credential.Username = strings.TrimSpace(credential.Username)
+	if len(credential.Username) == 0 || len(credential.Password) == 0 {
+		return badRequest("username and password are required")
+	}
+
+	if err := c.storeRegistryCredential(&credential); err != nil {
+		return nil, err
+	}
+
+	credential.Password = ""
+	return ok(&credential)
+}
+
+func (c *context) getRegistryCredentials(r *request) (*response, error) {
+	projectID, res, err := c.registryScope(r)
+	if res != nil || err != nil {
+		return res, err
+	}
+
+	credentials, err := c.connector.GetRegistryCredentials(projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, credential := range credentials {
+		credential.Password = ""
+	}
+
+	return ok(&credentials)
+}
+
+func (c *context) removeRegistryCredential(r *request) (*response, error) {
+	projectID, res, err := c.registryScope(r)
+	if res != nil || err != nil {
+		return res, err
+	}
+
+	if err := c.connector.RemoveRegistryCredential(projectID, lib.NormalizeRegistry(r.vars["registry"])); err != nil {
+		if _, notFound := err.(*store.NotFoundError); !notFound {
+			return nil, err
+		}
+		return notFound("registry credential not found")
+	}
+
+	return noContent()
+}
+
+// registryCredentials returns the decrypted credentials used by the jobs of a project: its own and the global ones
+func (c *context) registryCredentials(projectID string) (lib.RegistryCredentials, error) {
+	global, err := c.connector.GetRegistryCredentials("")
+	if err != nil {
+		return nil, err
+	}
+	project, err := c.connector.GetRegistryCredentials(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := lib.MergeRegistryCredentials(global, project)
+	if err := c.decryptRegistryPasswords(credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// decryptedRegistryCredentials returns the credentials of a project, or the global ones for an empty id,
+// with their passwords decrypted
+func (c *context) decryptedRegistryCredentials(projectID string) (lib.RegistryCredentials, error) {
+	credentials, err := c.connector.GetRegistryCredentials(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.decryptRegistryPasswords(credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// storeRegistryCredential stores the credential, its plain password being encrypted with the key of the server
+func (c *context) storeRegistryCredential(credential *lib.RegistryCredential) error {
+	encrypted, err := lib.Encrypt(c.registryKey, []byte(credential.Password))
+	if err != nil {
+		return err
+	}
+	stored := *credential
+	stored.Password = hex.EncodeToString(encrypted)
+	return c.connector.SetRegistryCredential(&stored)
+}
+
+func (c *context) decryptRegistryPasswords(credentials lib.RegistryCredentials) error {
+	for _, credential := range credentials {
+		encrypted, err := hex.DecodeString(credential.Password)
+		if err != nil {
+			return fmt.Errorf("Invalid password of the credential of registry %s: %v", credential.Registry, err)
+		}
+		password, err := lib.Decrypt(c.registryKey, encrypted)
+		if err != nil {
+			return fmt.Errorf("Failed to decrypt the password of the credential of registry %s: %v", credential.Registry, err)
+		}
+		credential.Password = string(password)
+	}
+	return nil
+}
+
+func (c *context) pullImage(credentials lib.RegistryCredentials, image string) error {
+	api, err := dockerclient.NewClient(c.paths.dockerEndpoint.container)
+	if err != nil {
+		return err
+	}
+	return credentials.PullImage(api, image)
+}
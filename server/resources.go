@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+)
+
+const (
+	// project config keys lowering the maximum resources of each variant
+	maxMemoryConfigKey = "bzk.resources.max_memory"
+	maxCPUsConfigKey   = "bzk.resources.max_cpus"
+	maxPidsConfigKey   = "bzk.resources.max_pids"
+)
+
+// maxResources returns the maximum resources of each variant of a project: those of its config, capped by the server ones
+func (c *context) maxResources(project *lib.Project) (*lib.Resources, error) {
+	res, err := lib.ParseResources(project.Config[maxMemoryConfigKey], project.Config[maxCPUsConfigKey], project.Config[maxPidsConfigKey])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid maximum resources of project %s: %v", project.ID, err)
+	}
+	return res.Cap(c.limits), nil
+}
+
+// resourcesEnv passes the maximum resources of the variants to the orchestration
+func resourcesEnv(max *lib.Resources, env map[string]string) {
+	if max.Memory > 0 {
+		env[BazookaEnvMaxMemory] = strconv.FormatInt(int64(max.Memory), 10)
+	}
+	if max.CPUs > 0 {
+		env[BazookaEnvMaxCPUs] = strconv.FormatFloat(max.CPUs, 'f', -1, 64)
+	}
+	if max.Pids > 0 {
+		env[BazookaEnvMaxPids] = strconv.FormatInt(max.Pids, 10)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlersMemoryStore(t *testing.T) {
+	testHandlers(t, store.NewMemoryStore())
+}
+
+func TestHandlersBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bzk-server")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := store.NewBoltStore(filepath.Join(dir, "bazooka.db"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	testHandlers(t, s)
+}
+
+func testHandlers(t *testing.T, s store.Store) {
+	c := &context{connector: s, maskers: &maskers{byJob: map[string]*lib.Masker{}}}
+	r := mux.NewRouter()
+	r.Handle("/image/{name:.*}", mkHandler(c.setImage)).Methods("PUT")
+	r.Handle("/image/{name:.*}", mkHandler(c.getImage)).Methods("GET")
+	r.Handle("/project", mkHandler(c.createProject)).Methods("POST")
+	r.Handle("/project", mkHandler(c.getProjects)).Methods("GET")
+	r.Handle("/project/{id}", mkHandler(c.getProject)).Methods("GET")
+	r.Handle("/project/{id}", mkHandler(c.deleteProject)).Methods("DELETE")
+	r.Handle("/project/{id}/config", mkHandler(c.getProjectConfig)).Methods("GET")
+	r.Handle("/project/{id}/config/{key}", mkHandler(c.setProjectConfigKey)).Methods("PUT")
+	r.Handle("/project/{id}/config/{key}", mkHandler(c.unsetProjectConfigKey)).Methods("DELETE")
+	r.Handle("/project/{id}/job", mkHandler(c.getJobs)).Methods("GET")
+	r.Handle("/job/{id}", mkHandler(c.getJob)).Methods("GET")
+	r.Handle("/job/{id}/variant", mkHandler(c.getVariants)).Methods("GET")
+	r.Handle("/job/{id}/finish", mkHandler(c.finishJob)).Methods("POST")
+	r.Handle("/job/{id}/stages", mkHandler(c.setJobStages)).Methods("PUT")
+	r.Handle("/variant", mkHandler(c.addVariant)).Methods("POST")
+	r.Handle("/variant/{id}", mkHandler(c.getVariant)).Methods("GET")
+	r.Handle("/variant/{id}/finish", mkHandler(c.finishVariant)).Methods("POST")
+
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, into interface{}) {
+		require.NoError(t, json.NewDecoder(w.Body).Decode(into))
+	}
+
+	// images
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/image/scm/fetch/git", "").Code)
+	require.Equal(t, http.StatusOK, serve("PUT", "/image/scm/fetch/git", `{"image": "bazooka/scm-git"}`).Code)
+	w := serve("GET", "/image/scm/fetch/git", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var image lib.Image
+	decode(w, &image)
+	assert.Equal(t, "bazooka/scm-git", image.Image)
+
+	// projects
+	assert.Equal(t, http.StatusBadRequest, serve("POST", "/project", `{"name": "bazooka", "scm_type": "svn", "scm_uri": "svn://example.com/bazooka"}`).Code)
+	w = serve("POST", "/project", `{"name": "bazooka", "scm_type": "git", "scm_uri": "git@example.com:bazooka.git"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var project lib.Project
+	decode(w, &project)
+	require.NotEmpty(t, project.ID)
+	assert.Equal(t, http.StatusConflict, serve("POST", "/project", `{"name": "bazooka", "scm_type": "git", "scm_uri": "git@example.com:other.git"}`).Code)
+
+	assert.Equal(t, http.StatusOK, serve("GET", "/project/"+project.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/project/unknown", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/project/unknown", "").Code)
+	w = serve("GET", "/project", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var projects []*lib.ProjectWithStatus
+	decode(w, &projects)
+	require.Len(t, projects, 1)
+	assert.Equal(t, "bazooka", projects[0].Name)
+
+	// project configuration
+	assert.Equal(t, http.StatusNoContent, serve("PUT", "/project/"+project.ID+"/config/bzk.build.max_parallel", "2").Code)
+	w = serve("GET", "/project/"+project.ID+"/config", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var config map[string]string
+	decode(w, &config)
+	assert.Equal(t, map[string]string{"bzk.build.max_parallel": "2"}, config)
+	assert.Equal(t, http.StatusNoContent, serve("DELETE", "/project/"+project.ID+"/config/bzk.build.max_parallel", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/project/unknown/config", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/project/unknown/config/bzk.build.max_parallel", "").Code)
+
+	// jobs, started by the server and reported by the orchestration through the internal api
+	job := &lib.Job{ProjectID: project.ID}
+	require.NoError(t, s.AddJob(job))
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/job/unknown", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/project/unknown/job", "").Code)
+	w = serve("GET", "/project/"+project.ID+"/job", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(lib.TotalCountHeader))
+
+	assert.Equal(t, http.StatusNotFound, serve("PUT", "/job/unknown/stages", `[{"name": "test"}]`).Code)
+	assert.Equal(t, http.StatusNoContent, serve("PUT", "/job/"+job.ID+"/stages", `[{"name": "test"}]`).Code)
+
+	w = serve("POST", "/variant", `{"project_id": "`+project.ID+`", "job_id": "`+job.ID+`", "number": 1, "status": "RUNNING"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var variant lib.Variant
+	decode(w, &variant)
+	require.NotEmpty(t, variant.ID)
+	assert.Equal(t, http.StatusNoContent, serve("POST", "/variant/"+variant.ID+"/finish", `{"status": "SUCCESS", "artifacts": ["report.xml"]}`).Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/variant/unknown", "").Code)
+	w = serve("GET", "/job/"+job.ID+"/variant", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var variants []*lib.Variant
+	decode(w, &variants)
+	require.Len(t, variants, 1)
+	assert.Equal(t, lib.JOB_SUCCESS, variants[0].Status)
+	assert.Equal(t, []string{"report.xml"}, variants[0].Artifacts)
+
+	assert.Equal(t, http.StatusNoContent, serve("POST", "/job/"+job.ID+"/finish", `{"status": "SUCCESS"}`).Code)
+	w = serve("GET", "/job/"+job.ID, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var finished lib.Job
+	decode(w, &finished)
+	assert.Equal(t, lib.JOB_SUCCESS, finished.Status)
+	require.Len(t, finished.Stages, 1)
+	assert.Equal(t, "test", finished.Stages[0].Name)
+}
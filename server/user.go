@@ -1,6 +1,9 @@
 package main
 
-import lib "github.com/bazooka-ci/bazooka/commons"
+import (
+	lib "github.com/bazooka-ci/bazooka/commons"
+	"github.com/bazooka-ci/bazooka/commons/store"
+)
 
 func (p *context) createUser(r *request) (*response, error) {
 	var user lib.User
@@ -31,7 +34,7 @@ func (p *context) createUser(r *request) (*response, error) {
 func (p *context) getUser(r *request) (*response, error) {
 	user, err := p.connector.GetUserByEmail(r.vars["email"])
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("user not found")
@@ -6,7 +6,7 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/bazooka-ci/bazooka/commons/mongo"
+	"github.com/bazooka-ci/bazooka/commons/store"
 
 	log "github.com/Sirupsen/logrus"
 
@@ -16,7 +16,7 @@ import (
 func (c *context) getVariant(r *request) (*response, error) {
 	variant, err := c.connector.GetVariantByID(r.vars["id"])
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("variant not found")
@@ -34,6 +34,31 @@ func (c *context) getVariants(r *request) (*response, error) {
 	return ok(&variants)
 }
 
+func (c *context) getVariantSteps(r *request) (*response, error) {
+	vid := r.vars["id"]
+
+	variant, err := c.connector.GetVariantByID(vid)
+	if err != nil {
+		if !store.IsNotFound(err) {
+			return nil, err
+		}
+		return notFound("variant not found")
+	}
+	job, err := c.connector.GetJobByID(variant.JobID)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := c.getLogs(job, &store.LogExample{
+		VariantID: variant.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ok(lib.BuildSteps(logs))
+}
+
 func (c *context) getVariantLog(r *request) (*response, error) {
 	follow := len(r.query("follow")) > 0
 	strictJson := len(r.query("strict-json")) > 0
@@ -43,22 +68,26 @@ func (c *context) getVariantLog(r *request) (*response, error) {
 	variant, err := c.connector.GetVariantByID(vid)
 
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("variant not found")
 	}
+	job, err := c.connector.GetJobByID(variant.JobID)
+	if err != nil {
+		return nil, err
+	}
 
 	w := r.w
 	w.WriteHeader(200)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	logOutput := json.NewEncoder(w)
 
-	query := &mongo.LogExample{
-		VariantID: vid,
+	query := &store.LogExample{
+		VariantID: variant.ID,
 	}
 
-	logs, err := c.connector.GetLog(query)
+	logs, err := c.getLogs(job, query)
 	if !follow {
 		logOutput.Encode(logs)
 		return nil, nil
@@ -128,7 +157,7 @@ func (c *context) getVariantArtifact(r *request) (*response, error) {
 	variant, err := c.connector.GetVariantByID(vid)
 
 	if err != nil {
-		if err.Error() != "not found" {
+		if !store.IsNotFound(err) {
 			return nil, err
 		}
 		return notFound("variant not found")